@@ -3,6 +3,7 @@ package myjson
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"time"
 
 	"github.com/autom8ter/myjson/kv"
@@ -40,6 +41,10 @@ type CollectionSchema interface {
 	Immutable() bool
 	// PreventDeletes returns whether the collection prevents deletes
 	PreventDeletes() bool
+	// TTL returns the collection's document expiration configuration (if it exists)
+	TTL() *TTL
+	// Compression returns the codec used to compress the collection's documents
+	Compression() Compression
 	// Equals returns whether the given collection schema is equal to the current schema
 	Equals(schema CollectionSchema) bool
 	// MarshalYAML returns the collection schema as yaml bytes
@@ -82,6 +87,9 @@ type Database interface {
 	NewTx(opts kv.TxOpts) (Txn, error)
 	// ChangeStream streams changes to documents in the given collection. CDC Persistence must be enabled to use this method.
 	ChangeStream(ctx context.Context, collection string, filter []Where, fn ChangeStreamHandler) error
+	// ChangeStreamFrom replays the changes to documents in the given collection that were persisted after the cursor position, then
+	// streams new changes as they are committed. Changes are delivered at most once. CDC Persistence must be enabled to use this method.
+	ChangeStreamFrom(ctx context.Context, collection string, cursor ChangeStreamCursor, filter []Where, fn ChangeStreamHandler) error
 	// Get gets a single document by id
 	Get(ctx context.Context, collection, id string) (*Document, error)
 	// ForEach scans the optimal index for a collection's documents passing its filters.
@@ -96,6 +104,18 @@ type Database interface {
 	// 'ctx' - the context passed to RunScript,
 	// and 'params' - the params passed to RunScript
 	RunScript(ctx context.Context, script string, params map[string]any) (any, error)
+	// Backup writes a portable, newline delimited json snapshot of every collection schema & document to the writer.
+	// Documents are read from a single read only transaction, so the backup is consistent
+	Backup(ctx context.Context, w io.Writer, opts BackupOpts) error
+	// Restore configures the collection schemas & replays the documents from a backup created by Backup in batch transactions.
+	// Collections that are not in the backup are kept, and triggers are not executed against restored documents
+	Restore(ctx context.Context, r io.Reader) error
+	// BackupSince writes an incremental backup of the cdc entries committed after the cursor & the current image of every document they
+	// changed. It returns the cursor of the last cdc entry in the backup - it should be used as the cursor of the next incremental backup
+	BackupSince(ctx context.Context, cursor ChangeStreamCursor, w io.Writer) (ChangeStreamCursor, error)
+	// RestoreIncremental applies an incremental backup created by BackupSince in order. It should be applied on top of the full
+	// backup (and any previous incremental backups) it was taken after
+	RestoreIncremental(ctx context.Context, r io.Reader) error
 	// RawKV returns the database key value provider - it should be used with caution and only when standard database functionality is insufficient.
 	RawKV() kv.DB
 	// Serve serves the database over the given transport
@@ -129,16 +149,30 @@ type Tx interface {
 	Cmd(ctx context.Context, cmd TxCmd) TxResponse
 	// Query executes a query against the database
 	Query(ctx context.Context, collection string, query Query) (Page, error)
+	// QueryIter executes a query against the database & streams the results. If the index chosen by the optimizer returns documents in the
+	// order of the order by clauses, the documents are read from the index as the iterator advances. Otherwise the results are ordered in memory -
+	// only the documents that may be on the page are kept if the query has a limit. The iterator must be closed before the transaction
+	QueryIter(ctx context.Context, collection string, query Query) (DocumentIterator, error)
 	// Get returns a document by id
 	Get(ctx context.Context, collection string, id string) (*Document, error)
 	// Create creates a new document - if the documents primary key is unset, it will be set as a sortable unique id
 	Create(ctx context.Context, collection string, document *Document) (string, error)
-	// Update updates a value in the database
+	// Update updates a value in the database. The update may contain update operators (see UpdateOp) that are applied against the
+	// current value of the document ex: {"$inc": {"count": 1}}
 	Update(ctx context.Context, collection, id string, document map[string]any) error
 	// Set sets the specified key/value in the database
 	Set(ctx context.Context, collection string, document *Document) error
+	// Upsert updates the document with the given id if it exists - otherwise the document is created from the onInsert fields & the update.
+	// Unlike Set, the created/updated document follows the same default & immutable field semantics as Create/Update
+	Upsert(ctx context.Context, collection, id string, update map[string]any, onInsert map[string]any) error
 	// Delete deletes the specified key from the database
 	Delete(ctx context.Context, collection string, id string) error
+	// UpdateIfVersion updates a value in the database if the document is at the given version - otherwise an errors.Conflict error is returned
+	UpdateIfVersion(ctx context.Context, collection, id string, version int64, document map[string]any) error
+	// SetIfVersion sets the specified key/value in the database if the document is at the given version - otherwise an errors.Conflict error is returned
+	SetIfVersion(ctx context.Context, collection string, version int64, document *Document) error
+	// DeleteIfVersion deletes the specified key from the database if the document is at the given version - otherwise an errors.Conflict error is returned
+	DeleteIfVersion(ctx context.Context, collection string, id string, version int64) error
 	// ForEach scans the optimal index for a collection's documents passing its filters.
 	// results will not be ordered unless an index supporting the order by(s) was found by the optimizer
 	// Query should be used when order is more important than performance/resource-usage
@@ -153,6 +187,18 @@ type Tx interface {
 	DB() Database
 }
 
+// DocumentIterator iterates over the results of a query (see Tx.QueryIter)
+type DocumentIterator interface {
+	// Next advances the iterator to the next document. It returns false once there are no more documents or an error occurred
+	Next() bool
+	// Doc returns the current document
+	Doc() *Document
+	// Err returns the error that stopped the iterator (if any)
+	Err() error
+	// Close releases the resources held by the iterator
+	Close()
+}
+
 // Transport serves the database over a network (optional for integration with different transport mechanisms)
 type Transport interface {
 	Serve(ctx context.Context, db Database) error
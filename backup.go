@@ -0,0 +1,425 @@
+package myjson
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/samber/lo"
+)
+
+// backupVersion is the version of the backup stream format
+const backupVersion = 1
+
+// backupBatchSize is the maximum number of records restored per transaction
+const backupBatchSize = 1000
+
+// BackupOpts configures a logical backup
+type BackupOpts struct {
+	// Namespaces limits the backup to the given namespaces (default: every namespace)
+	Namespaces []string `json:"namespaces,omitempty"`
+	// IncludeCDC includes the system_cdc change history in the backup
+	IncludeCDC bool `json:"includeCDC,omitempty"`
+}
+
+// BackupRecordKind is the kind of record in a backup stream
+type BackupRecordKind string
+
+const (
+	// BackupRecordHeader is the first record in a backup stream
+	BackupRecordHeader BackupRecordKind = "header"
+	// BackupRecordSchema holds a collection schema
+	BackupRecordSchema BackupRecordKind = "schema"
+	// BackupRecordDocument holds a document in a namespace
+	BackupRecordDocument BackupRecordKind = "document"
+	// BackupRecordChange holds a cdc entry in a namespace (incremental backups only)
+	BackupRecordChange BackupRecordKind = "change"
+	// BackupRecordDelete indicates that a document no longer exists in a namespace (incremental backups only)
+	BackupRecordDelete BackupRecordKind = "delete"
+)
+
+// BackupRecord is a single line of a backup stream. Backup streams are newline delimited json - they begin with a header,
+// followed by every collection schema. Full backups are followed by every document grouped by namespace & collection.
+// Incremental backups are followed by the cdc entries after the cursor in the order they were committed, then the current
+// image of every document that changed (or a delete record if it no longer exists)
+type BackupRecord struct {
+	// Kind is the kind of record
+	Kind BackupRecordKind `json:"kind"`
+	// Version is the version of the backup format (header only)
+	Version int `json:"version,omitempty"`
+	// Timestamp is the time the backup was started in unix nanoseconds (header only)
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Since is the cursor that an incremental backup starts after (incremental header only)
+	Since *ChangeStreamCursor `json:"since,omitempty"`
+	// Namespace is the namespace the document or change belongs to
+	Namespace string `json:"namespace,omitempty"`
+	// Collection is the collection the schema, document, or change belongs to
+	Collection string `json:"collection,omitempty"`
+	// Schema is the json collection schema (schemas only)
+	Schema json.RawMessage `json:"schema,omitempty"`
+	// Document is the document (documents only)
+	Document *Document `json:"document,omitempty"`
+	// DocumentID is the id of the deleted document (deletes only)
+	DocumentID string `json:"documentID,omitempty"`
+	// Change is the cdc entry (changes only)
+	Change *CDC `json:"change,omitempty"`
+}
+
+func (d *defaultDB) Backup(ctx context.Context, w io.Writer, opts BackupOpts) error {
+	collections, err := d.backupCollections(ctx, opts.IncludeCDC)
+	if err != nil {
+		return err
+	}
+	namespaces, err := d.indexedNamespaces(ctx, collections)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	if err := writeBackupHeader(enc, collections, nil); err != nil {
+		return err
+	}
+	// every document is read from a single read only transaction so that the backup is a consistent snapshot
+	return d.Tx(ctx, kv.TxOpts{IsReadOnly: true}, func(ctx context.Context, tx Tx) error {
+		for _, c := range collections {
+			ns := namespaces[c.Collection()]
+			if len(opts.Namespaces) > 0 {
+				ns = lo.Intersect(ns, opts.Namespaces)
+			}
+			sort.Strings(ns)
+			for _, namespace := range ns {
+				if _, err := tx.ForEach(SetIsInternal(SetMetadataNamespace(ctx, namespace)), c.Collection(), ForEachOpts{}, func(doc *Document) (bool, error) {
+					if err := enc.Encode(BackupRecord{
+						Kind:       BackupRecordDocument,
+						Namespace:  namespace,
+						Collection: c.Collection(),
+						Document:   doc,
+					}); err != nil {
+						return false, errors.Wrap(err, errors.Internal, "failed to write backup document")
+					}
+					return true, nil
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (d *defaultDB) BackupSince(ctx context.Context, cursor ChangeStreamCursor, w io.Writer) (ChangeStreamCursor, error) {
+	if cursor.ID == "" && cursor.Timestamp == 0 {
+		return cursor, errors.New(errors.Validation, "incremental backups require a cdc id or timestamp")
+	}
+	collections, err := d.backupCollections(ctx, true)
+	if err != nil {
+		return cursor, err
+	}
+	namespaces, err := d.indexedNamespaces(ctx, []CollectionSchema{d.GetSchema(ctx, cdcCollectionName)})
+	if err != nil {
+		return cursor, err
+	}
+	ns := namespaces[cdcCollectionName]
+	sort.Strings(ns)
+	enc := json.NewEncoder(w)
+	if err := writeBackupHeader(enc, collections, &cursor); err != nil {
+		return cursor, err
+	}
+	next := cursor
+	if err := d.Tx(ctx, kv.TxOpts{IsReadOnly: true}, func(ctx context.Context, tx Tx) error {
+		from := cursor.Timestamp
+		if cursor.ID != "" {
+			found := false
+			for _, namespace := range ns {
+				doc, err := tx.Get(SetIsInternal(SetMetadataNamespace(ctx, namespace)), cdcCollectionName, cursor.ID)
+				if err != nil {
+					if errors.Extract(err).Code == errors.NotFound {
+						continue
+					}
+					return err
+				}
+				var c CDC
+				if err := doc.Scan(&c); err != nil {
+					return errors.Wrap(err, errors.Internal, "failed to unmarshal cdc")
+				}
+				from = c.Timestamp
+				found = true
+				break
+			}
+			if !found {
+				return errors.New(errors.NotFound, "cdc entry not found: %s", cursor.ID)
+			}
+		}
+		for _, namespace := range ns {
+			ctx := SetIsInternal(SetMetadataNamespace(ctx, namespace))
+			type changed struct {
+				collection string
+				id         string
+			}
+			var (
+				docs []changed
+				seen = map[changed]struct{}{}
+			)
+			if _, err := tx.ForEach(ctx, cdcCollectionName, ForEachOpts{
+				Where: []Where{
+					{
+						Field: "timestamp",
+						Op:    WhereOpGte,
+						Value: from,
+					},
+				},
+			}, func(doc *Document) (bool, error) {
+				var c CDC
+				if err := doc.Scan(&c); err != nil {
+					return false, errors.Wrap(err, errors.Internal, "failed to unmarshal cdc")
+				}
+				// entries are ordered by timestamp & then by id - skip the cursor & every entry that sorts before it
+				if c.Timestamp < from || (cursor.ID != "" && c.Timestamp == from && c.ID <= cursor.ID) {
+					return true, nil
+				}
+				if err := enc.Encode(BackupRecord{
+					Kind:       BackupRecordChange,
+					Namespace:  namespace,
+					Collection: cdcCollectionName,
+					Change:     &c,
+				}); err != nil {
+					return false, errors.Wrap(err, errors.Internal, "failed to write backup change")
+				}
+				if c.Timestamp > next.Timestamp || (c.Timestamp == next.Timestamp && c.ID > next.ID) {
+					next = ChangeStreamCursor{ID: c.ID, Timestamp: c.Timestamp}
+				}
+				key := changed{collection: c.Collection, id: c.DocumentID}
+				if _, ok := seen[key]; !ok {
+					seen[key] = struct{}{}
+					docs = append(docs, key)
+				}
+				return true, nil
+			}); err != nil {
+				return err
+			}
+			for _, c := range docs {
+				if !d.HasCollection(ctx, c.collection) {
+					continue
+				}
+				record := BackupRecord{
+					Kind:       BackupRecordDocument,
+					Namespace:  namespace,
+					Collection: c.collection,
+				}
+				doc, err := tx.Get(ctx, c.collection, c.id)
+				switch {
+				case err == nil:
+					record.Document = doc
+				case errors.Extract(err).Code == errors.NotFound:
+					record.Kind = BackupRecordDelete
+					record.DocumentID = c.id
+				default:
+					return err
+				}
+				if err := enc.Encode(record); err != nil {
+					return errors.Wrap(err, errors.Internal, "failed to write backup document")
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return cursor, err
+	}
+	return next, nil
+}
+
+// backupCollections returns the collections that may be backed up, sorted by name
+func (d *defaultDB) backupCollections(ctx context.Context, includeCDC bool) ([]CollectionSchema, error) {
+	collections := lo.Filter(d.getCachedCollections(), func(c CollectionSchema, i int) bool {
+		return c.Collection() != cdcCollectionName || includeCDC
+	})
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].Collection() < collections[j].Collection()
+	})
+	for _, c := range collections {
+		pass, err := d.authorizeConfigure(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if !pass {
+			return nil, errors.New(errors.Forbidden, "not authorized to backup collection: %s", c.Collection())
+		}
+	}
+	return collections, nil
+}
+
+// writeBackupHeader writes the backup header followed by the collection schemas (the cdc schema always exists so it is skipped)
+func writeBackupHeader(enc *json.Encoder, collections []CollectionSchema, since *ChangeStreamCursor) error {
+	if err := enc.Encode(BackupRecord{
+		Kind:      BackupRecordHeader,
+		Version:   backupVersion,
+		Timestamp: time.Now().UnixNano(),
+		Since:     since,
+	}); err != nil {
+		return errors.Wrap(err, errors.Internal, "failed to write backup header")
+	}
+	for _, c := range collections {
+		if c.Collection() == cdcCollectionName {
+			continue
+		}
+		bits, err := c.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(BackupRecord{
+			Kind:       BackupRecordSchema,
+			Collection: c.Collection(),
+			Schema:     bits,
+		}); err != nil {
+			return errors.Wrap(err, errors.Internal, "failed to write backup schema: %s", c.Collection())
+		}
+	}
+	return nil
+}
+
+func (d *defaultDB) Restore(ctx context.Context, r io.Reader) error {
+	return d.restore(ctx, r, false)
+}
+
+func (d *defaultDB) RestoreIncremental(ctx context.Context, r io.Reader) error {
+	return d.restore(ctx, r, true)
+}
+
+// restore configures the schemas in the backup stream & then applies its records in order. Consecutive records in the same
+// namespace & collection are applied in batch transactions
+func (d *defaultDB) restore(ctx context.Context, r io.Reader, incremental bool) error {
+	dec := json.NewDecoder(r)
+	var header BackupRecord
+	if err := dec.Decode(&header); err != nil {
+		return errors.Wrap(err, errors.Validation, "failed to read backup header")
+	}
+	if header.Kind != BackupRecordHeader {
+		return errors.New(errors.Validation, "invalid backup: missing header")
+	}
+	if header.Version > backupVersion {
+		return errors.New(errors.Validation, "unsupported backup version: %v", header.Version)
+	}
+	if incremental != (header.Since != nil) {
+		if incremental {
+			return errors.New(errors.Validation, "invalid backup: expected an incremental backup")
+		}
+		return errors.New(errors.Validation, "invalid backup: expected a full backup")
+	}
+	var (
+		schemas    = map[string]string{}
+		configured bool
+		batch      []BackupRecord
+	)
+	configure := func() error {
+		if configured {
+			return nil
+		}
+		configured = true
+		if len(schemas) == 0 {
+			return nil
+		}
+		// collections that exist in the database but not in the backup are kept
+		for _, c := range d.getCachedCollections() {
+			if _, ok := schemas[c.Collection()]; !ok {
+				bits, err := c.MarshalJSON()
+				if err != nil {
+					return err
+				}
+				schemas[c.Collection()] = string(bits)
+			}
+		}
+		if err := d.Configure(ctx, "", lo.Values(schemas)); err != nil {
+			return errors.Wrap(err, 0, "failed to restore collection schemas")
+		}
+		return nil
+	}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		namespace, collection := batch[0].Namespace, batch[0].Collection
+		ctx := setIsRestoring(SetIsInternal(SetMetadataNamespace(ctx, namespace)))
+		if err := d.Tx(ctx, kv.TxOpts{IsBatch: true}, func(ctx context.Context, tx Tx) error {
+			for _, record := range batch {
+				switch record.Kind {
+				case BackupRecordDocument:
+					if err := tx.Set(ctx, collection, record.Document); err != nil {
+						return err
+					}
+				case BackupRecordChange:
+					doc, err := NewDocumentFrom(record.Change)
+					if err != nil {
+						return err
+					}
+					if err := tx.Set(ctx, cdcCollectionName, doc); err != nil {
+						return err
+					}
+				case BackupRecordDelete:
+					// the document may have never been restored
+					if _, err := tx.Get(ctx, collection, record.DocumentID); err != nil {
+						if errors.Extract(err).Code == errors.NotFound {
+							continue
+						}
+						return err
+					}
+					if err := tx.Delete(ctx, collection, record.DocumentID); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, 0, "failed to restore documents: %s/%s", namespace, collection)
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		var record BackupRecord
+		if err := dec.Decode(&record); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return errors.Wrap(err, errors.Validation, "failed to read backup record")
+		}
+		switch record.Kind {
+		case BackupRecordSchema:
+			if configured {
+				return errors.New(errors.Validation, "invalid backup: schema %s found after documents", record.Collection)
+			}
+			schemas[record.Collection] = string(record.Schema)
+			continue
+		case BackupRecordDocument:
+			if record.Document == nil {
+				return errors.New(errors.Validation, "invalid backup: empty document in collection %s", record.Collection)
+			}
+		case BackupRecordChange:
+			if !incremental || record.Change == nil {
+				return errors.New(errors.Validation, "invalid backup: unexpected change record")
+			}
+			record.Collection = cdcCollectionName
+		case BackupRecordDelete:
+			if !incremental || record.DocumentID == "" {
+				return errors.New(errors.Validation, "invalid backup: unexpected delete record")
+			}
+		default:
+			return errors.New(errors.Validation, "invalid backup: unsupported record kind: %s", record.Kind)
+		}
+		if err := configure(); err != nil {
+			return err
+		}
+		if len(batch) > 0 && (record.Namespace != batch[0].Namespace || record.Collection != batch[0].Collection || len(batch) >= backupBatchSize) {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		batch = append(batch, record)
+	}
+	if err := configure(); err != nil {
+		return err
+	}
+	return flush()
+}
@@ -0,0 +1,172 @@
+package myjson_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/autom8ter/myjson"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func count(ctx context.Context, t *testing.T, db myjson.Database, collection string, where ...myjson.Where) int {
+	var count int
+	_, err := db.ForEach(ctx, collection, myjson.ForEachOpts{Where: where}, func(d *myjson.Document) (bool, error) {
+		count++
+		return true, nil
+	})
+	assert.NoError(t, err)
+	return count
+}
+
+func TestBackup(t *testing.T) {
+	namespaces := []string{"default", "tenant"}
+	t.Run("backup & restore", testutil.Test(t, testutil.TestConfig{
+		Collections: testutil.AllCollections,
+		Roles:       []string{"super_user"},
+	}, func(ctx context.Context, t *testing.T, db myjson.Database) {
+		for _, namespace := range namespaces {
+			ctx := myjson.SetMetadataNamespace(ctx, namespace)
+			assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				for i := 0; i < 3; i++ {
+					assert.NoError(t, tx.Set(ctx, "account", myjson.D().Set(map[string]any{
+						"_id":  fmt.Sprint(i),
+						"name": fmt.Sprintf("%s-%v", namespace, i),
+					}).Doc()))
+				}
+				for i := 0; i < 10; i++ {
+					usr := testutil.NewUserDoc()
+					assert.NoError(t, usr.Set("account_id", fmt.Sprint(i%3)))
+					assert.NoError(t, tx.Set(ctx, "user", usr))
+					assert.NoError(t, tx.Set(ctx, "task", testutil.NewTaskDoc(usr.GetString("_id"))))
+				}
+				return nil
+			}))
+		}
+		var buf bytes.Buffer
+		assert.NoError(t, db.Backup(ctx, &buf, myjson.BackupOpts{IncludeCDC: true}))
+		assert.True(t, strings.HasPrefix(buf.String(), `{"kind":"header"`))
+
+		restored, err := myjson.Open(ctx, "memory", map[string]any{})
+		assert.NoError(t, err)
+		defer restored.Close(ctx)
+		assert.NoError(t, restored.Restore(ctx, bytes.NewReader(buf.Bytes())))
+		assert.ElementsMatch(t, db.Collections(ctx), restored.Collections(ctx))
+		for _, namespace := range namespaces {
+			ctx := myjson.SetMetadataNamespace(ctx, namespace)
+			for _, collection := range []string{"account", "user", "task", "system_cdc"} {
+				assert.Equal(t, count(ctx, t, db, collection), count(ctx, t, restored, collection), "%s/%s", namespace, collection)
+			}
+			// secondary indexes are rebuilt
+			where := myjson.Where{Field: "account_id", Op: myjson.WhereOpEq, Value: "1"}
+			assert.Equal(t, count(ctx, t, db, "user", where), count(ctx, t, restored, "user", where))
+			// computed values are restored as is
+			before, err := db.Get(ctx, "account", "1")
+			assert.NoError(t, err)
+			after, err := restored.Get(ctx, "account", "1")
+			assert.NoError(t, err)
+			assert.JSONEq(t, before.String(), after.String())
+		}
+	}))
+	t.Run("namespaces & cdc", testutil.Test(t, testutil.TestConfig{
+		Collections: testutil.AllCollections,
+		Roles:       []string{"super_user"},
+	}, func(ctx context.Context, t *testing.T, db myjson.Database) {
+		for _, namespace := range namespaces {
+			ctx := myjson.SetMetadataNamespace(ctx, namespace)
+			assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				return tx.Set(ctx, "account", myjson.D().Set(map[string]any{
+					"_id":  "1",
+					"name": namespace,
+				}).Doc())
+			}))
+		}
+		var buf bytes.Buffer
+		assert.NoError(t, db.Backup(ctx, &buf, myjson.BackupOpts{Namespaces: []string{"tenant"}}))
+		restored, err := myjson.Open(ctx, "memory", map[string]any{})
+		assert.NoError(t, err)
+		defer restored.Close(ctx)
+		assert.NoError(t, restored.Restore(ctx, &buf))
+		assert.Equal(t, 0, count(ctx, t, restored, "account"))
+		assert.Equal(t, 1, count(myjson.SetMetadataNamespace(ctx, "tenant"), t, restored, "account"))
+		assert.Equal(t, 0, count(myjson.SetMetadataNamespace(ctx, "tenant"), t, restored, "system_cdc"))
+	}))
+	t.Run("incremental", testutil.Test(t, testutil.TestConfig{
+		Collections: testutil.AllCollections,
+		Roles:       []string{"super_user"},
+	}, func(ctx context.Context, t *testing.T, db myjson.Database) {
+		assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+			for i := 0; i < 3; i++ {
+				assert.NoError(t, tx.Set(ctx, "account", myjson.D().Set(map[string]any{
+					"_id":  fmt.Sprint(i),
+					"name": fmt.Sprint(i),
+				}).Doc()))
+			}
+			return nil
+		}))
+		var full bytes.Buffer
+		assert.NoError(t, db.Backup(ctx, &full, myjson.BackupOpts{IncludeCDC: true}))
+		restored, err := myjson.Open(ctx, "memory", map[string]any{})
+		assert.NoError(t, err)
+		defer restored.Close(ctx)
+		assert.NoError(t, restored.Restore(ctx, &full))
+		assert.Error(t, restored.RestoreIncremental(ctx, bytes.NewReader(full.Bytes())))
+
+		since := time.Now().UnixNano()
+		assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+			assert.NoError(t, tx.Update(ctx, "account", "0", map[string]any{"status": "active"}))
+			assert.NoError(t, tx.Delete(ctx, "account", "1"))
+			assert.NoError(t, tx.Set(ctx, "account", myjson.D().Set(map[string]any{
+				"_id":  "3",
+				"name": "3",
+			}).Doc()))
+			return nil
+		}))
+		var inc bytes.Buffer
+		next, err := db.BackupSince(ctx, myjson.ChangeStreamCursor{Timestamp: since}, &inc)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, next.ID)
+		assert.Equal(t, 3, strings.Count(inc.String(), `"kind":"change"`))
+		assert.NoError(t, restored.RestoreIncremental(ctx, &inc))
+
+		assert.Equal(t, count(ctx, t, db, "account"), count(ctx, t, restored, "account"))
+		assert.Equal(t, count(ctx, t, db, "system_cdc"), count(ctx, t, restored, "system_cdc"))
+		doc, err := restored.Get(ctx, "account", "0")
+		assert.NoError(t, err)
+		assert.Equal(t, "active", doc.GetString("status"))
+		_, err = restored.Get(ctx, "account", "1")
+		assert.Error(t, err)
+		_, err = restored.Get(ctx, "account", "3")
+		assert.NoError(t, err)
+
+		// the returned cursor is used for the next incremental backup
+		inc.Reset()
+		assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+			return tx.Delete(ctx, "account", "3")
+		}))
+		last, err := db.BackupSince(ctx, next, &inc)
+		assert.NoError(t, err)
+		assert.NotEqual(t, next.ID, last.ID)
+		assert.Equal(t, 1, strings.Count(inc.String(), `"kind":"change"`))
+		assert.Equal(t, 1, strings.Count(inc.String(), `"kind":"delete"`))
+		assert.NoError(t, restored.RestoreIncremental(ctx, &inc))
+		_, err = restored.Get(ctx, "account", "3")
+		assert.Error(t, err)
+
+		_, err = db.BackupSince(ctx, myjson.ChangeStreamCursor{ID: "missing"}, &inc)
+		assert.Error(t, err)
+	}))
+	t.Run("invalid backup", testutil.Test(t, testutil.TestConfig{
+		Roles: []string{"super_user"},
+	}, func(ctx context.Context, t *testing.T, db myjson.Database) {
+		assert.Error(t, db.Restore(ctx, strings.NewReader("")))
+		assert.Error(t, db.Restore(ctx, strings.NewReader(`{"kind":"document"}`)))
+		assert.Error(t, db.Restore(ctx, strings.NewReader(`{"kind":"header","version":1000}`)))
+		assert.Error(t, db.Restore(ctx, strings.NewReader(`{"kind":"header","version":1}`+"\n"+`{"kind":"unknown"}`)))
+	}))
+}
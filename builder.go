@@ -27,6 +27,18 @@ func (q *QueryBuilder) Where(where ...Where) *QueryBuilder {
 	return q
 }
 
+// Or adds a Where clause to the query that matches documents that match any of the where clause(s)
+func (q *QueryBuilder) Or(where ...Where) *QueryBuilder {
+	q.query.Where = append(q.query.Where, Where{Or: where})
+	return q
+}
+
+// Not adds a Where clause to the query that matches documents that don't match the where clause
+func (q *QueryBuilder) Not(where Where) *QueryBuilder {
+	q.query.Where = append(q.query.Where, Where{Not: &where})
+	return q
+}
+
 // Join adds the Join clause(s) to the query
 func (q *QueryBuilder) Join(join ...Join) *QueryBuilder {
 	q.query.Join = append(q.query.Join, join...)
@@ -51,6 +63,12 @@ func (q *QueryBuilder) Page(page int) *QueryBuilder {
 	return q
 }
 
+// Cursor resumes the query after the last document of a previous page (Page.NextCursor)
+func (q *QueryBuilder) Cursor(cursor string) *QueryBuilder {
+	q.query.Cursor = cursor
+	return q
+}
+
 // GroupBy adds the GroupBy clause(s) to the query
 func (q *QueryBuilder) GroupBy(groups ...string) *QueryBuilder {
 	q.query.GroupBy = append(q.query.GroupBy, groups...)
@@ -1,6 +1,7 @@
 package myjson
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -50,4 +51,27 @@ func TestQueryBuilder(t *testing.T) {
 		assert.Equal(t, 1, len(q.Having))
 		assert.Equal(t, 1, len(q.Join))
 	})
+	t.Run("query builder or/not", func(t *testing.T) {
+		q := Q().
+			Select(Select{Field: "*"}).
+			Or(Where{
+				Field: "age",
+				Op:    WhereOpGt,
+				Value: 50,
+			}, Where{
+				Field: "age",
+				Op:    WhereOpLt,
+				Value: 10,
+			}).
+			Not(Where{
+				Field: "name",
+				Op:    WhereOpEq,
+				Value: "john",
+			}).
+			Query()
+		assert.Equal(t, 2, len(q.Where))
+		assert.Equal(t, 2, len(q.Where[0].Or))
+		assert.Equal(t, "name", q.Where[1].Not.Field)
+		assert.NoError(t, q.Validate(context.Background()))
+	})
 }
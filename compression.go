@@ -0,0 +1,75 @@
+package myjson
+
+import (
+	"github.com/autom8ter/myjson/errors"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is a codec used to compress documents before they are written to the primary index
+type Compression string
+
+const (
+	// CompressionNone stores documents as raw json
+	CompressionNone Compression = "none"
+	// CompressionSnappy compresses documents with snappy - it is fast with a moderate compression ratio
+	CompressionSnappy Compression = "snappy"
+	// CompressionZstd compresses documents with zstd - it is slower than snappy with a much higher compression ratio
+	CompressionZstd Compression = "zstd"
+)
+
+// compression headers are prepended to compressed documents. Uncompressed documents are stored as raw json (which always begins
+// with '{'), so documents written before a collection enabled compression may still be read
+const (
+	snappyHeader byte = 0x01
+	zstdHeader   byte = 0x02
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+func (c Compression) valid() bool {
+	switch c {
+	case "", CompressionNone, CompressionSnappy, CompressionZstd:
+		return true
+	}
+	return false
+}
+
+// encodeDocument encodes the document with the given compression codec
+func encodeDocument(compression Compression, doc *Document) []byte {
+	bits := doc.Bytes()
+	switch compression {
+	case CompressionSnappy:
+		encoded := make([]byte, snappy.MaxEncodedLen(len(bits))+1)
+		encoded[0] = snappyHeader
+		return encoded[:len(snappy.Encode(encoded[1:], bits))+1]
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(bits, []byte{zstdHeader})
+	default:
+		return bits
+	}
+}
+
+// decodeDocument decodes a document that was encoded with any compression codec
+func decodeDocument(bits []byte) (*Document, error) {
+	if len(bits) == 0 {
+		return NewDocumentFromBytes(bits)
+	}
+	var err error
+	switch bits[0] {
+	case snappyHeader:
+		bits, err = snappy.Decode(nil, bits[1:])
+		if err != nil {
+			return nil, errors.Wrap(err, errors.Internal, "failed to decompress document (snappy)")
+		}
+	case zstdHeader:
+		bits, err = zstdDecoder.DecodeAll(bits[1:], nil)
+		if err != nil {
+			return nil, errors.Wrap(err, errors.Internal, "failed to decompress document (zstd)")
+		}
+	}
+	return NewDocumentFromBytes(bits)
+}
@@ -0,0 +1,36 @@
+package myjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompression(t *testing.T) {
+	doc := NewDocument()
+	assert.NoError(t, doc.SetAll(map[string]any{
+		"_id":         "1",
+		"description": "a very repetitive description a very repetitive description a very repetitive description",
+	}))
+	for _, compression := range []Compression{"", CompressionNone, CompressionSnappy, CompressionZstd} {
+		t.Run(string(compression), func(t *testing.T) {
+			bits := encodeDocument(compression, doc)
+			switch compression {
+			case CompressionSnappy, CompressionZstd:
+				assert.Less(t, len(bits), len(doc.Bytes()))
+			default:
+				assert.Equal(t, doc.Bytes(), bits)
+			}
+			decoded, err := decodeDocument(bits)
+			assert.NoError(t, err)
+			assert.Equal(t, doc.String(), decoded.String())
+		})
+	}
+	t.Run("corrupt", func(t *testing.T) {
+		_, err := decodeDocument([]byte{zstdHeader, 0xff})
+		assert.Error(t, err)
+	})
+	t.Run("invalid codec", func(t *testing.T) {
+		assert.False(t, Compression("gzip").valid())
+	})
+}
@@ -0,0 +1,126 @@
+package myjson
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/autom8ter/myjson/errors"
+)
+
+// queryCursor is the position of the last document of a page. It is encoded as an opaque token (Page.NextCursor) that resumes
+// the query from where the page ended (Query.Cursor)
+type queryCursor struct {
+	// Index is the name of the index that was scanned
+	Index string `json:"index,omitempty"`
+	// Key is the index key of the last document - it is set if the results are in index order so that the next page can seek
+	// the index directly
+	Key []byte `json:"key,omitempty"`
+	// Values are the order by values of the last document - they are set if the results are ordered in memory
+	Values []any `json:"values,omitempty"`
+}
+
+// encode encodes the cursor as an opaque token
+func (c queryCursor) encode() string {
+	bits, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(bits)
+}
+
+// decodeQueryCursor decodes an opaque token that was encoded by queryCursor.encode
+func decodeQueryCursor(cursor string) (queryCursor, error) {
+	var c queryCursor
+	bits, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, errors.Wrap(err, errors.Validation, "invalid cursor")
+	}
+	if err := json.Unmarshal(bits, &c); err != nil {
+		return c, errors.Wrap(err, errors.Validation, "invalid cursor")
+	}
+	if len(c.Key) == 0 && len(c.Values) == 0 {
+		return c, errors.New(errors.Validation, "invalid cursor")
+	}
+	return c, nil
+}
+
+// cursorOrderBy returns the order by clauses used to paginate results that are ordered in memory - the primary key is appended
+// so that documents with the same order by values are always in the same order
+func cursorOrderBy(c CollectionSchema, orderBy []OrderBy) []OrderBy {
+	for _, o := range orderBy {
+		if o.Field == c.PrimaryKey() {
+			return orderBy
+		}
+	}
+	return append(append([]OrderBy{}, orderBy...), OrderBy{Field: c.PrimaryKey(), Direction: OrderByDirectionAsc})
+}
+
+// cursorValues returns the order by values of the document
+func cursorValues(d *Document, orderBy []OrderBy) []any {
+	var values []any
+	for _, o := range orderBy {
+		values = append(values, d.Get(o.Field))
+	}
+	return values
+}
+
+// after returns true if the document comes after the cursor in the order of the order by clauses
+func (c queryCursor) after(schema CollectionSchema, d *Document, orderBy []OrderBy) bool {
+	for i, o := range orderBy {
+		if i >= len(c.Values) {
+			break
+		}
+		cmp := compareValues(typedValue(schema, o.Field, d.Get(o.Field)), typedValue(schema, o.Field, c.Values[i]))
+		if cmp == 0 {
+			continue
+		}
+		if o.Direction == OrderByDirectionDesc {
+			return cmp < 0
+		}
+		return cmp > 0
+	}
+	return false
+}
+
+// documentHeap is a heap of documents whose root is the document that comes last in the order of the order by clauses
+type documentHeap struct {
+	c         CollectionSchema
+	orderBy   []OrderBy
+	documents Documents
+}
+
+func (h *documentHeap) Len() int {
+	return len(h.documents)
+}
+
+func (h *documentHeap) Less(i, j int) bool {
+	return compareDocs(h.c, h.documents[i], h.documents[j], h.orderBy) > 0
+}
+
+func (h *documentHeap) Swap(i, j int) {
+	h.documents[i], h.documents[j] = h.documents[j], h.documents[i]
+}
+
+func (h *documentHeap) Push(x any) {
+	h.documents = append(h.documents, x.(*Document))
+}
+
+func (h *documentHeap) Pop() any {
+	last := h.documents[len(h.documents)-1]
+	h.documents = h.documents[:len(h.documents)-1]
+	return last
+}
+
+// keep adds the document to the heap if it is one of the first size documents in the order of the order by clauses - the
+// document that comes last is evicted once the heap holds more than size documents. Every document is kept if size is 0
+func (h *documentHeap) keep(d *Document, size int) {
+	if size == 0 {
+		h.documents = append(h.documents, d)
+		return
+	}
+	if h.Len() >= size && compareDocs(h.c, d, h.documents[0], h.orderBy) >= 0 {
+		return
+	}
+	heap.Push(h, d)
+	if h.Len() > size {
+		heap.Pop(h)
+	}
+}
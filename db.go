@@ -38,6 +38,8 @@ type defaultDB struct {
 	collections   sync.Map
 	collectionDag *collectionDag
 	globalScripts string
+	ttlReaper     ttlReaperOpts
+	retryPolicy   RetryPolicy
 }
 
 // Open opens a new database instance from the given config
@@ -58,6 +60,11 @@ func Open(ctx context.Context, provider string, providerParams map[string]any, o
 		vmPool:        make(chan *goja.Runtime, 20),
 		collections:   sync.Map{},
 		collectionDag: newCollectionDag(),
+		ttlReaper: ttlReaperOpts{
+			interval:   time.Minute,
+			batchSize:  100,
+			namespaces: []string{"default"},
+		},
 	}
 
 	for _, o := range opts {
@@ -71,6 +78,9 @@ func Open(ctx context.Context, provider string, providerParams map[string]any, o
 	if err := d.collectionDag.SetSchemas(existing); err != nil {
 		return nil, err
 	}
+	if err := d.migrateIndexes(context.WithValue(ctx, internalKey, true), existing); err != nil {
+		return nil, err
+	}
 	if len(existing) == 0 {
 		if err := d.Configure(context.WithValue(ctx, internalKey, true), "", []string{cdcSchema}); err != nil {
 			return nil, errors.Wrap(err, errors.Internal, "failed to configure cdc collection")
@@ -111,6 +121,22 @@ func Open(ctx context.Context, provider string, providerParams map[string]any, o
 		}
 	}()
 	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(d.ttlReaper.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := d.reapExpired(ctx); err != nil && ctx.Err() == nil {
+					fmt.Println(err)
+				}
+			}
+		}
+	}()
+	d.wg.Add(1)
 	go func() {
 		defer d.wg.Done()
 		for {
@@ -151,6 +177,27 @@ func (d *defaultDB) NewTx(opts kv.TxOpts) (Txn, error) {
 }
 
 func (d *defaultDB) Tx(ctx context.Context, opts kv.TxOpts, fn TxFunc) error {
+	policy, ok := getTxRetryPolicy(ctx)
+	if !ok {
+		policy = d.retryPolicy
+	}
+	for attempt := 1; ; attempt++ {
+		err := d.runTx(ctx, opts, fn)
+		if !policy.shouldRetry(attempt, err) {
+			return err
+		}
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// runTx runs the function in a single transaction & commits it
+func (d *defaultDB) runTx(ctx context.Context, opts kv.TxOpts, fn TxFunc) error {
 	tx, err := d.NewTx(opts)
 	if err != nil {
 		return err
@@ -558,6 +605,10 @@ func (d *defaultDB) GetSchema(ctx context.Context, collection string) Collection
 }
 
 func (d *defaultDB) ChangeStream(ctx context.Context, collection string, filter []Where, fn ChangeStreamHandler) error {
+	return d.ChangeStreamFrom(ctx, collection, ChangeStreamCursor{}, filter, fn)
+}
+
+func (d *defaultDB) ChangeStreamFrom(ctx context.Context, collection string, cursor ChangeStreamCursor, filter []Where, fn ChangeStreamHandler) error {
 	if collection != "*" && !d.HasCollection(ctx, collection) {
 		return errors.New(errors.Validation, "collection does not exist: %s", collection)
 	}
@@ -573,25 +624,12 @@ func (d *defaultDB) ChangeStream(ctx context.Context, collection string, filter
 			return errors.New(errors.Forbidden, "not authorized: %s", ChangeStreamAction)
 		}
 	}
-
-	pfx := indexPrefix(ctx, cdcCollectionName, "_id.primaryidx")
-	return d.kv.ChangeStream(ctx, pfx, func(cdc kv.CDC) (bool, error) {
-		doc, _ := NewDocumentFromBytes(cdc.Value)
-		pass, err := doc.Where(filter)
-		if err != nil {
-			return false, err
-		}
-		if pass {
-			var c CDC
-			if err := doc.Scan(&c); err != nil {
-				return false, errors.Wrap(err, errors.Internal, "failed to unmarshal cdc")
-			}
-			if c.Collection == collection || collection == "*" {
-				return fn(ctx, c)
-			}
-		}
-		return true, nil
-	})
+	if cursor.ID == "" && cursor.Timestamp == 0 {
+		return d.tailChangeStream(ctx, collection, filter, func(cdc CDC) (bool, error) {
+			return fn(ctx, cdc)
+		})
+	}
+	return d.resumeChangeStream(ctx, collection, cursor, filter, fn)
 }
 
 func (d *defaultDB) RawKV() kv.DB {
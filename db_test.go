@@ -3,11 +3,14 @@ package myjson_test
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/autom8ter/myjson"
+	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/kv"
 	"github.com/autom8ter/myjson/testutil"
 	"github.com/brianvoe/gofakeit/v6"
@@ -122,6 +125,55 @@ func Test(t *testing.T) {
 			<-received
 		}))
 	})
+	t.Run("resume stream", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			start := time.Now()
+			var ids []string
+			for i := 0; i < 3; i++ {
+				assert.Nil(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+					id, err := tx.Create(ctx, "user", testutil.NewUserDoc())
+					ids = append(ids, id)
+					return err
+				}))
+			}
+			stream := func(cursor myjson.ChangeStreamCursor, expected int) []myjson.CDC {
+				ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				defer cancel()
+				var received []myjson.CDC
+				assert.NoError(t, db.ChangeStreamFrom(ctx, "user", cursor, nil, func(ctx context.Context, cdc myjson.CDC) (bool, error) {
+					received = append(received, cdc)
+					if len(received) == 3 {
+						// create a document once the replay has completed - it should be received from the live stream
+						go func() {
+							assert.Nil(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+								_, err := tx.Create(ctx, "user", testutil.NewUserDoc())
+								return err
+							}))
+						}()
+					}
+					return len(received) < expected, nil
+				}))
+				return received
+			}
+			received := stream(myjson.ChangeStreamCursor{Timestamp: start.UnixNano()}, 4)
+			assert.Len(t, received, 4)
+			for i, id := range ids {
+				assert.Equal(t, id, received[i].DocumentID)
+				assert.Equal(t, myjson.CreateAction, received[i].Action)
+			}
+			unique := lo.UniqBy(received, func(cdc myjson.CDC) string {
+				return cdc.ID
+			})
+			assert.Len(t, unique, 4)
+
+			// resuming from an id skips the entry
+			resumed := stream(myjson.ChangeStreamCursor{ID: received[0].ID}, 4)
+			assert.Len(t, resumed, 4)
+			assert.Equal(t, received[1].ID, resumed[0].ID)
+			assert.Equal(t, received[2].ID, resumed[1].ID)
+			assert.Equal(t, received[3].ID, resumed[2].ID)
+		}))
+	})
 	t.Run("set", func(t *testing.T) {
 		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
 			timer := timer()
@@ -803,10 +855,174 @@ func TestIndexing1(t *testing.T) {
 				assert.Equal(t, 0, count)
 			}))
 		})
+		t.Run("some results (between)", func(t *testing.T) {
+			assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+				var seed = func() {
+					assert.Nil(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+						for i := 0; i < 5; i++ {
+							if err := tx.Set(ctx, "user", testutil.NewUserDoc()); err != nil {
+								return err
+							}
+						}
+						return nil
+					}))
+				}
+				seed()
+				time.Sleep(10 * time.Millisecond)
+				start := time.Now().UnixNano()
+				seed()
+				end := time.Now().UnixNano()
+				time.Sleep(10 * time.Millisecond)
+				seed()
+				count := 0
+				o, err := db.ForEach(ctx, "system_cdc", myjson.ForEachOpts{
+					Where: []myjson.Where{{
+						Field: "timestamp",
+						Op:    myjson.WhereOpBetween,
+						Value: []int64{start, end},
+					}},
+				}, func(d *myjson.Document) (bool, error) {
+					assert.GreaterOrEqual(t, d.GetFloat("timestamp"), float64(start))
+					assert.LessOrEqual(t, d.GetFloat("timestamp"), float64(end))
+					count++
+					return true, nil
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, false, o.Index.Primary)
+				assert.False(t, o.Reverse)
+				assert.Equal(t, "timestamp", o.SeekFields[0])
+				assert.NotEmpty(t, o.UpperBoundValues["timestamp"])
+				assert.Equal(t, 5, count)
+			}))
+		})
 	})
 
 }
 
+func TestWhereOps(t *testing.T) {
+	t.Run("reverse scan (lte)", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+				for _, language := range []string{"a", "a", "b", "b", "c", "c"} {
+					u := testutil.NewUserDoc()
+					assert.NoError(t, u.Set("language", language))
+					if err := tx.Set(ctx, "user", u); err != nil {
+						return err
+					}
+				}
+				return nil
+			}))
+			page, err := db.Query(ctx, "user", myjson.Q().
+				Select(myjson.Select{Field: "language"}).
+				Where(myjson.Where{Field: "language", Op: myjson.WhereOpLte, Value: "b"}).
+				Query())
+			assert.NoError(t, err)
+			assert.Equal(t, "language_idx", page.Stats.Explain.Index.Name)
+			assert.True(t, page.Stats.Explain.Reverse)
+			// rows equal to the bound must be included
+			assert.Equal(t, []string{"b", "b", "a", "a"}, lo.Map(page.Documents, func(d *myjson.Document, _ int) string {
+				return d.GetString("language")
+			}))
+			page, err = db.Query(ctx, "user", myjson.Q().
+				Select(myjson.Select{Field: "language"}).
+				Where(myjson.Where{Field: "language", Op: myjson.WhereOpLt, Value: "b"}).
+				Query())
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"a", "a"}, lo.Map(page.Documents, func(d *myjson.Document, _ int) string {
+				return d.GetString("language")
+			}))
+		}))
+	})
+	t.Run("date range (date-time)", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			var seed = func() []string {
+				var ids []string
+				assert.Nil(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+					for i := 0; i < 5; i++ {
+						id, err := tx.Create(ctx, "user", testutil.NewUserDoc())
+						if err != nil {
+							return err
+						}
+						ids = append(ids, id)
+					}
+					return nil
+				}))
+				time.Sleep(10 * time.Millisecond)
+				return ids
+			}
+			// the bounds are in a different time zone than the (utc) document timestamps - they only match chronologically
+			zone := time.FixedZone("", 5*3600)
+			seed()
+			start := time.Now().In(zone).Format(time.RFC3339Nano)
+			ids := seed()
+			end := time.Now().In(zone).Format(time.RFC3339Nano)
+			seed()
+			page, err := db.Query(ctx, "user", myjson.Q().
+				Select(myjson.Select{Field: "_id"}, myjson.Select{Field: "timestamp"}).
+				Where(myjson.Where{Field: "timestamp", Op: myjson.WhereOpBetween, Value: []string{start, end}}).
+				OrderBy(myjson.OrderBy{Field: "timestamp", Direction: myjson.OrderByDirectionDesc}).
+				Query())
+			assert.NoError(t, err)
+			assert.Equal(t, "timestamp_idx", page.Stats.Explain.Index.Name)
+			assert.ElementsMatch(t, ids, lo.Map(page.Documents, func(d *myjson.Document, _ int) string {
+				return d.GetString("_id")
+			}))
+			for i := 1; i < len(page.Documents); i++ {
+				assert.False(t, page.Documents[i].GetTime("timestamp").After(page.Documents[i-1].GetTime("timestamp")))
+			}
+			page, err = db.Query(ctx, "user", myjson.Q().
+				Select(myjson.Select{Field: "_id"}).
+				Where(myjson.Where{Field: "timestamp", Op: myjson.WhereOpGt, Value: end}).
+				Query())
+			assert.NoError(t, err)
+			assert.Equal(t, 5, page.Count)
+		}))
+	})
+	t.Run("line items (elemMatch)", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			var docs myjson.Documents
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+				for i := 0; i < 5; i++ {
+					usr := testutil.NewUserDoc()
+					if err := usr.Set("orders", []map[string]any{
+						{"sku": fmt.Sprintf("sku-%v", i), "quantity": i},
+						{"sku": "sku-shared", "quantity": 1},
+					}); err != nil {
+						return err
+					}
+					docs = append(docs, usr)
+					if err := tx.Set(ctx, "user", usr); err != nil {
+						return err
+					}
+				}
+				return nil
+			}))
+			page, err := db.Query(ctx, "user", myjson.Q().
+				Select(myjson.Select{Field: "_id"}).
+				Where(myjson.Where{
+					Field: "orders",
+					Op:    myjson.WhereOpElemMatch,
+					Value: []myjson.Where{
+						{Field: "sku", Op: myjson.WhereOpHasPrefix, Value: "sku-"},
+						{Field: "quantity", Op: myjson.WhereOpGte, Value: 3},
+					},
+				}).
+				Query())
+			assert.NoError(t, err)
+			assert.Equal(t, 2, page.Count)
+			page, err = db.Query(ctx, "user", myjson.Q().
+				Select(myjson.Select{Field: "_id"}).
+				Where(
+					myjson.Where{Field: "orders", Op: myjson.WhereOpSize, Value: 2},
+					myjson.Where{Field: "_id", Op: myjson.WhereOpNotIn, Value: []string{docs[0].GetString("_id")}},
+				).
+				Query())
+			assert.NoError(t, err)
+			assert.Equal(t, 4, page.Count)
+		}))
+	})
+}
+
 func TestOrderBy(t *testing.T) {
 	t.Run("basic asc/desc", func(t *testing.T) {
 		assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
@@ -845,6 +1061,176 @@ func TestOrderBy(t *testing.T) {
 }
 
 func TestPagination(t *testing.T) {
+	var pages = func(t *testing.T, ctx context.Context, db myjson.Database, query myjson.Query) ([]int, []string) {
+		var (
+			counts []int
+			ids    []string
+		)
+		for {
+			page, err := db.Query(ctx, "user", query)
+			assert.NoError(t, err)
+			counts = append(counts, page.Count)
+			for _, d := range page.Documents {
+				ids = append(ids, d.GetString("_id"))
+			}
+			if page.NextCursor == "" || err != nil || len(counts) > 100 {
+				return counts, ids
+			}
+			query.Cursor = page.NextCursor
+		}
+	}
+	t.Run("cursor (index order)", func(t *testing.T) {
+		assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			var (
+				english []string
+				all     []string
+			)
+			assert.NoError(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+				for i := 0; i < 25; i++ {
+					u := testutil.NewUserDoc()
+					if i%2 == 0 {
+						assert.NoError(t, u.Set("language", "english"))
+						english = append(english, u.GetString("_id"))
+					} else {
+						assert.NoError(t, u.Set("language", "french"))
+					}
+					all = append(all, u.GetString("_id"))
+					assert.NoError(t, tx.Set(ctx, "user", u))
+				}
+				return nil
+			}))
+			counts, ids := pages(t, ctx, db, myjson.Q().Select(myjson.Select{Field: "_id"}).Limit(10).Query())
+			assert.Equal(t, []int{10, 10, 5}, counts)
+			assert.ElementsMatch(t, all, ids)
+
+			counts, ids = pages(t, ctx, db, myjson.Q().
+				Select(myjson.Select{Field: "_id"}).
+				Where(myjson.Where{Field: "language", Op: myjson.WhereOpEq, Value: "english"}).
+				Limit(5).
+				Query())
+			assert.Equal(t, []int{5, 5, 3}, counts)
+			assert.ElementsMatch(t, english, ids)
+
+			// reverse scan
+			counts, ids = pages(t, ctx, db, myjson.Q().
+				Select(myjson.Select{Field: "_id"}).
+				Where(myjson.Where{Field: "timestamp", Op: myjson.WhereOpLte, Value: time.Now().Add(time.Minute).Format(time.RFC3339Nano)}).
+				Limit(10).
+				Query())
+			assert.Equal(t, []int{10, 10, 5}, counts)
+			assert.ElementsMatch(t, all, ids)
+
+			page, err := db.Query(ctx, "user", myjson.Q().Select(myjson.Select{Field: "_id"}).Limit(25).Query())
+			assert.NoError(t, err)
+			assert.Equal(t, 25, page.Count)
+			assert.Empty(t, page.NextCursor)
+		}))
+	})
+	t.Run("cursor (order by)", func(t *testing.T) {
+		assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			assert.NoError(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+				for i := 0; i < 10; i++ {
+					u := testutil.NewUserDoc()
+					assert.NoError(t, u.Set("age", i%3))
+					assert.NoError(t, tx.Set(ctx, "user", u))
+				}
+				return nil
+			}))
+			var ages []float64
+			query := myjson.Q().
+				Select(myjson.Select{Field: "_id"}, myjson.Select{Field: "age"}).
+				OrderBy(myjson.OrderBy{Field: "age", Direction: myjson.OrderByDirectionDesc}).
+				Limit(4).
+				Query()
+			for {
+				page, err := db.Query(ctx, "user", query)
+				assert.NoError(t, err)
+				for _, d := range page.Documents {
+					ages = append(ages, d.GetFloat("age"))
+				}
+				if page.NextCursor == "" || err != nil || len(ages) > 10 {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			assert.Equal(t, []float64{2, 2, 2, 1, 1, 1, 0, 0, 0, 0}, ages)
+
+			counts, ids := pages(t, ctx, db, myjson.Q().
+				Select(myjson.Select{Field: "_id"}).
+				OrderBy(myjson.OrderBy{Field: "age", Direction: myjson.OrderByDirectionAsc}).
+				Limit(3).
+				Query())
+			assert.Equal(t, []int{3, 3, 3, 1}, counts)
+			assert.Len(t, lo.Uniq(ids), 10)
+		}))
+	})
+	t.Run("cursor (order by index)", func(t *testing.T) {
+		assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			assert.NoError(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+				for i := 0; i < 25; i++ {
+					assert.NoError(t, tx.Set(ctx, "user", testutil.NewUserDoc()))
+				}
+				return nil
+			}))
+			var (
+				counts     []int
+				ids        []string
+				timestamps []time.Time
+			)
+			// the order by matches the timestamp index, so the pages are read from the index in order
+			query := myjson.Q().
+				Select(myjson.Select{Field: "_id"}, myjson.Select{Field: "timestamp"}).
+				Where(myjson.Where{Field: "timestamp", Op: myjson.WhereOpLte, Value: time.Now().Add(time.Minute).Format(time.RFC3339Nano)}).
+				OrderBy(myjson.OrderBy{Field: "timestamp", Direction: myjson.OrderByDirectionDesc}).
+				Limit(10).
+				Query()
+			for len(counts) < 10 {
+				page, err := db.Query(ctx, "user", query)
+				assert.NoError(t, err)
+				assert.Equal(t, "timestamp_idx", page.Stats.Explain.Index.Name)
+				counts = append(counts, page.Count)
+				for _, d := range page.Documents {
+					ids = append(ids, d.GetString("_id"))
+					timestamps = append(timestamps, d.GetTime("timestamp"))
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			assert.Equal(t, []int{10, 10, 5}, counts)
+			assert.Len(t, lo.Uniq(ids), 25)
+			assert.True(t, sort.SliceIsSorted(timestamps, func(i, j int) bool {
+				return timestamps[i].After(timestamps[j])
+			}))
+		}))
+	})
+	t.Run("bad cursor", func(t *testing.T) {
+		assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			_, err := db.Query(ctx, "user", myjson.Q().Select(myjson.Select{Field: "*"}).Cursor("not a cursor").Limit(1).Query())
+			assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+			_, err = db.Query(ctx, "user", myjson.Q().Select(myjson.Select{Field: "*"}).Cursor("not a cursor").Page(1).Limit(1).Query())
+			assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+
+			assert.NoError(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+				for i := 0; i < 2; i++ {
+					assert.NoError(t, tx.Set(ctx, "user", testutil.NewUserDoc()))
+				}
+				return nil
+			}))
+			page, err := db.Query(ctx, "user", myjson.Q().Select(myjson.Select{Field: "*"}).Limit(1).Query())
+			assert.NoError(t, err)
+			assert.NotEmpty(t, page.NextCursor)
+			// index order cursors can't resume queries that are ordered in memory
+			_, err = db.Query(ctx, "user", myjson.Q().
+				Select(myjson.Select{Field: "*"}).
+				OrderBy(myjson.OrderBy{Field: "age", Direction: myjson.OrderByDirectionAsc}).
+				Cursor(page.NextCursor).
+				Limit(1).
+				Query())
+			assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+		}))
+	})
 	t.Run("order by asc + pagination", func(t *testing.T) {
 		assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
 			var usrs []*myjson.Document
@@ -1033,6 +1419,157 @@ db.ForEach(ctx, 'account', undefined, params.fn)
 	})
 }
 
+func TestWhereGroups(t *testing.T) {
+	var seed = func(ctx context.Context, db myjson.Database) myjson.Documents {
+		var docs myjson.Documents
+		assert.NoError(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+			for i := 0; i < 10; i++ {
+				usr := testutil.NewUserDoc()
+				language := "french"
+				if i < 3 {
+					language = "english"
+				}
+				assert.NoError(t, usr.Set("language", language))
+				docs = append(docs, usr)
+				if err := tx.Set(ctx, "user", usr); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+		return docs
+	}
+	t.Run("union of index scans (or)", func(t *testing.T) {
+		assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			docs := seed(ctx, db)
+			page, err := db.Query(ctx, "user", myjson.Q().
+				Select(myjson.Select{Field: "*"}).
+				Or(
+					myjson.Where{Field: "language", Op: myjson.WhereOpEq, Value: "english"},
+					myjson.Where{Field: "contact.email", Op: myjson.WhereOpEq, Value: docs[0].Get("contact.email")},
+					myjson.Where{Field: "_id", Op: myjson.WhereOpEq, Value: docs[5].Get("_id")},
+				).
+				Query())
+			assert.NoError(t, err)
+			assert.Equal(t, 4, page.Count)
+			assert.Len(t, page.Stats.Explain.Union, 3)
+			ids := lo.Map(page.Documents, func(d *myjson.Document, _ int) string {
+				return d.GetString("_id")
+			})
+			assert.ElementsMatch(t, []string{
+				docs[0].GetString("_id"),
+				docs[1].GetString("_id"),
+				docs[2].GetString("_id"),
+				docs[5].GetString("_id"),
+			}, ids)
+		}))
+	})
+	t.Run("or & not", func(t *testing.T) {
+		assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			docs := seed(ctx, db)
+			page, err := db.Query(ctx, "user", myjson.Q().
+				Select(myjson.Select{Field: "*"}).
+				Or(
+					myjson.Where{Field: "language", Op: myjson.WhereOpEq, Value: "english"},
+					myjson.Where{Field: "_id", Op: myjson.WhereOpEq, Value: docs[5].Get("_id")},
+				).
+				Not(myjson.Where{Field: "_id", Op: myjson.WhereOpEq, Value: docs[0].Get("_id")}).
+				Query())
+			assert.NoError(t, err)
+			assert.Equal(t, 3, page.Count)
+			for _, d := range page.Documents {
+				assert.NotEqual(t, docs[0].GetString("_id"), d.GetString("_id"))
+			}
+		}))
+	})
+	t.Run("having (or)", func(t *testing.T) {
+		assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			seed(ctx, db)
+			page, err := db.Query(ctx, "user", myjson.Q().
+				Select(
+					myjson.Select{Field: "language"},
+					myjson.Select{Field: "age", Aggregate: myjson.AggregateFunctionCount, As: "count"},
+				).
+				GroupBy("language").
+				Having(myjson.Where{
+					Or: []myjson.Where{
+						{Field: "language", Op: myjson.WhereOpEq, Value: "english"},
+						{Field: "language", Op: myjson.WhereOpEq, Value: "spanish"},
+					},
+				}).
+				Query())
+			assert.NoError(t, err)
+			assert.Equal(t, 1, page.Count)
+			assert.Equal(t, "english", page.Documents[0].GetString("language"))
+			assert.Equal(t, 3.0, page.Documents[0].GetFloat("count"))
+		}))
+	})
+	t.Run("join on (or)", func(t *testing.T) {
+		assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			docs := seed(ctx, db)
+			page, err := db.Query(ctx, "user", myjson.Q().
+				Select(
+					myjson.Select{Field: "_id"},
+					myjson.Select{Field: "acc._id", As: "account_id"},
+				).
+				Where(myjson.Where{Field: "_id", Op: myjson.WhereOpEq, Value: docs[0].Get("_id")}).
+				Join(myjson.Join{
+					Collection: "account",
+					On: []myjson.Where{
+						{
+							Or: []myjson.Where{
+								{Field: "_id", Op: myjson.WhereOpEq, Value: "$account_id"},
+								{Field: "_id", Op: myjson.WhereOpEq, Value: "does-not-exist"},
+							},
+						},
+					},
+					As: "acc",
+				}).
+				Query())
+			assert.NoError(t, err)
+			assert.Equal(t, 1, page.Count)
+			assert.Equal(t, docs[0].GetString("account_id"), page.Documents[0].GetString("account_id"))
+		}))
+	})
+	t.Run("change stream filter (or)", func(t *testing.T) {
+		assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			var (
+				received = make(chan string, 10)
+				usr      = testutil.NewUserDoc()
+			)
+			go func() {
+				//nolint:errcheck
+				db.ChangeStream(ctx, "user", []myjson.Where{
+					{
+						Or: []myjson.Where{
+							{Field: "documentID", Op: myjson.WhereOpEq, Value: usr.GetString("_id")},
+							{Field: "documentID", Op: myjson.WhereOpEq, Value: "does-not-exist"},
+						},
+					},
+				}, func(ctx context.Context, cdc myjson.CDC) (bool, error) {
+					received <- cdc.DocumentID
+					return true, nil
+				})
+			}()
+			time.Sleep(100 * time.Millisecond)
+			assert.NoError(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+				if err := tx.Set(ctx, "user", testutil.NewUserDoc()); err != nil {
+					return err
+				}
+				return tx.Set(ctx, "user", usr)
+			}))
+			select {
+			case id := <-received:
+				assert.Equal(t, usr.GetString("_id"), id)
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for cdc")
+			}
+		}))
+	})
+}
+
 func TestJoin(t *testing.T) {
 	t.Run("join user to account", func(t *testing.T) {
 		assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
@@ -1391,3 +1928,549 @@ func TestConfigure(t *testing.T) {
 		}))
 	})
 }
+
+const sessionSchema = `
+type: object
+x-collection: session
+x-ttl:
+  field: expires_at
+required:
+  - _id
+properties:
+  _id:
+    type: string
+    x-primary: true
+  user:
+    type: string
+    x-index:
+      session_user_idx:
+        enabled: true
+  expires_at:
+    type: string
+`
+
+const tokenSchema = `
+type: object
+x-collection: token
+x-ttl:
+  duration: 500ms
+required:
+  - _id
+properties:
+  _id:
+    type: string
+    x-primary: true
+  _expires_at:
+    type: string
+`
+
+func TestTTL(t *testing.T) {
+	t.Run("expired documents are hidden", testutil.Test(t, testutil.TestConfig{
+		Collections: []string{sessionSchema},
+		Roles:       []string{"super_user"},
+	}, func(ctx context.Context, t *testing.T, db myjson.Database) {
+		assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+			assert.NoError(t, tx.Set(ctx, "session", myjson.D().Set(map[string]any{
+				"_id":        "expired",
+				"user":       "1",
+				"expires_at": time.Now().Add(-time.Minute).Format(time.RFC3339Nano),
+			}).Doc()))
+			assert.NoError(t, tx.Set(ctx, "session", myjson.D().Set(map[string]any{
+				"_id":        "active",
+				"user":       "1",
+				"expires_at": time.Now().Add(time.Hour).Format(time.RFC3339Nano),
+			}).Doc()))
+			return nil
+		}))
+		_, err := db.Get(ctx, "session", "expired")
+		assert.Error(t, err)
+		doc, err := db.Get(ctx, "session", "active")
+		assert.NoError(t, err)
+		assert.Equal(t, "active", doc.GetString("_id"))
+		results, err := db.Query(ctx, "session", myjson.Q().Where(myjson.Where{
+			Field: "user",
+			Op:    myjson.WhereOpEq,
+			Value: "1",
+		}).Query())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, results.Count)
+		assert.Equal(t, "active", results.Documents[0].GetString("_id"))
+		assert.Error(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+			return tx.Update(ctx, "session", "expired", map[string]any{"user": "2"})
+		}))
+	}))
+	t.Run("duration", testutil.Test(t, testutil.TestConfig{
+		Collections: []string{tokenSchema},
+		Roles:       []string{"super_user"},
+	}, func(ctx context.Context, t *testing.T, db myjson.Database) {
+		var id string
+		assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+			var err error
+			id, err = tx.Create(ctx, "token", myjson.D().Set(map[string]any{}).Doc())
+			return err
+		}))
+		doc, err := db.Get(ctx, "token", id)
+		assert.NoError(t, err)
+		assert.True(t, doc.GetTime("_expires_at").After(time.Now()))
+		assert.Eventually(t, func() bool {
+			_, err := db.Get(ctx, "token", id)
+			return err != nil
+		}, 3*time.Second, 50*time.Millisecond)
+	}))
+	t.Run("reaper", testutil.Test(t, testutil.TestConfig{
+		Opts:        []myjson.DBOpt{myjson.WithTTLReaper(50*time.Millisecond, 2)},
+		Collections: []string{sessionSchema},
+		Roles:       []string{"super_user"},
+	}, func(ctx context.Context, t *testing.T, db myjson.Database) {
+		assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+			for i := 0; i < 5; i++ {
+				assert.NoError(t, tx.Set(ctx, "session", myjson.D().Set(map[string]any{
+					"_id":        fmt.Sprint(i),
+					"user":       "1",
+					"expires_at": time.Now().Add(-time.Minute).Format(time.RFC3339Nano),
+				}).Doc()))
+			}
+			return nil
+		}))
+		assert.Eventually(t, func() bool {
+			results, err := db.Query(ctx, "system_cdc", myjson.Q().Where(myjson.Where{
+				Field: "action",
+				Op:    myjson.WhereOpEq,
+				Value: myjson.DeleteAction,
+			}).Query())
+			return err == nil && results.Count == 5
+		}, 5*time.Second, 50*time.Millisecond)
+	}))
+}
+
+const eventSchema = `
+type: object
+x-collection: event
+x-compression: snappy
+required:
+  - _id
+properties:
+  _id:
+    type: string
+    x-primary: true
+  kind:
+    type: string
+    x-index:
+      event_kind_idx:
+        enabled: true
+  payload:
+    type: string
+`
+
+func TestCompression(t *testing.T) {
+	t.Run("compressed documents", testutil.Test(t, testutil.TestConfig{
+		Collections: []string{eventSchema},
+		Roles:       []string{"super_user"},
+	}, func(ctx context.Context, t *testing.T, db myjson.Database) {
+		assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+			for i := 0; i < 10; i++ {
+				assert.NoError(t, tx.Set(ctx, "event", myjson.D().Set(map[string]any{
+					"_id":     fmt.Sprint(i),
+					"kind":    fmt.Sprint(i % 2),
+					"payload": strings.Repeat("payload ", 100),
+				}).Doc()))
+			}
+			return nil
+		}))
+		doc, err := db.Get(ctx, "event", "1")
+		assert.NoError(t, err)
+		assert.Equal(t, strings.Repeat("payload ", 100), doc.GetString("payload"))
+		results, err := db.Query(ctx, "event", myjson.Q().Where(myjson.Where{
+			Field: "kind",
+			Op:    myjson.WhereOpEq,
+			Value: "1",
+		}).Query())
+		assert.NoError(t, err)
+		assert.Equal(t, 5, results.Count)
+		assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+			return tx.Update(ctx, "event", "1", map[string]any{"kind": "2"})
+		}))
+		doc, err = db.Get(ctx, "event", "1")
+		assert.NoError(t, err)
+		assert.Equal(t, "2", doc.GetString("kind"))
+	}))
+}
+
+const playerSchema = `
+type: object
+x-collection: player
+required:
+  - _id
+properties:
+  _id:
+    type: string
+    x-primary: true
+  score:
+    type: number
+    x-index:
+      player_score_idx:
+        enabled: true
+`
+
+func TestIndexEncoding(t *testing.T) {
+	ctx := myjson.SetMetadataRoles(context.Background(), []string{"super_user"})
+	dir := t.TempDir()
+	open := func() myjson.Database {
+		db, err := myjson.Open(ctx, "badger", map[string]any{
+			"storage_path": dir,
+		})
+		assert.NoError(t, err)
+		return db
+	}
+	scoresGreaterThan := func(db myjson.Database, score float64) []string {
+		results, err := db.Query(ctx, "player", myjson.Q().Where(myjson.Where{
+			Field: "score",
+			Op:    myjson.WhereOpGt,
+			Value: score,
+		}).OrderBy(myjson.OrderBy{Field: "score", Direction: myjson.OrderByDirectionAsc}).Query())
+		assert.NoError(t, err)
+		assert.Equal(t, "player_score_idx", results.Stats.Explain.Index.Name)
+		return lo.Map(results.Documents, func(d *myjson.Document, i int) string {
+			return d.GetString("_id")
+		})
+	}
+	db := open()
+	assert.NoError(t, db.Configure(ctx, "", []string{playerSchema}))
+	assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+		for id, score := range map[string]float64{"a": -10, "b": -1.5, "c": 0, "d": 2.5, "e": 10} {
+			assert.NoError(t, tx.Set(ctx, "player", myjson.D().Set(map[string]any{
+				"_id":   id,
+				"score": score,
+			}).Doc()))
+		}
+		return nil
+	}))
+	t.Run("negative numbers & fractions", func(t *testing.T) {
+		assert.Equal(t, []string{"b", "c", "d", "e"}, scoresGreaterThan(db, -2))
+		assert.Equal(t, []string{"d", "e"}, scoresGreaterThan(db, 0.5))
+	})
+	t.Run("migrate legacy indexes", func(t *testing.T) {
+		assert.NoError(t, db.RawKV().Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			// simulate a database written with the legacy encoding
+			if err := tx.Set(ctx, []byte("cache.internal.index_version"), []byte("0")); err != nil {
+				return err
+			}
+			return tx.Set(ctx, []byte("default\x00index\x00player\x00_id.primaryidx\x00_id\x00f\x00f"), []byte(`{"_id":"f","score":5}`))
+		}))
+		assert.NoError(t, db.RawKV().DropPrefix(ctx, []byte("default\x00index\x00player\x00player_score_idx")))
+		assert.Empty(t, scoresGreaterThan(db, -2))
+		assert.NoError(t, db.Close(ctx))
+
+		db = open()
+		defer db.Close(ctx)
+		assert.Equal(t, []string{"b", "c", "d", "f", "e"}, scoresGreaterThan(db, -2))
+		doc, err := db.Get(ctx, "player", "f")
+		assert.NoError(t, err)
+		assert.Equal(t, 5.0, doc.GetFloat("score"))
+		// the legacy key is deleted once the document is written with the current encoding
+		assert.NoError(t, db.RawKV().Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			bits, err := tx.Get(ctx, []byte("default\x00index\x00player\x00_id.primaryidx\x00_id\x00f\x00f"))
+			assert.Nil(t, bits)
+			return err
+		}))
+	})
+}
+
+const handleSchema = `
+type: object
+x-collection: handle
+required:
+  - _id
+properties:
+  _id:
+    type: string
+    x-primary: true
+  name:
+    type: string
+    x-unique: true
+`
+
+func TestIndexKeyEscaping(t *testing.T) {
+	t.Run("separator bytes in ids & values", testutil.Test(t, testutil.TestConfig{
+		Collections: []string{handleSchema},
+		Roles:       []string{"super_user"},
+	}, func(ctx context.Context, t *testing.T, db myjson.Database) {
+		assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+			assert.NoError(t, tx.Set(ctx, "handle", myjson.D().Set(map[string]any{
+				"_id":  "a\x00b",
+				"name": "a",
+			}).Doc()))
+			// "a" is a prefix of "ab" - it must not be treated as a duplicate
+			assert.NoError(t, tx.Set(ctx, "handle", myjson.D().Set(map[string]any{
+				"_id":  "a",
+				"name": "ab",
+			}).Doc()))
+			assert.NoError(t, tx.Set(ctx, "handle", myjson.D().Set(map[string]any{
+				"_id":  "c",
+				"name": "c\x00\x01",
+			}).Doc()))
+			return nil
+		}))
+		doc, err := db.Get(ctx, "handle", "a\x00b")
+		assert.NoError(t, err)
+		assert.Equal(t, "a", doc.GetString("name"))
+		for name, id := range map[string]string{"a": "a\x00b", "ab": "a", "c\x00\x01": "c"} {
+			results, err := db.Query(ctx, "handle", myjson.Q().Where(myjson.Where{
+				Field: "name",
+				Op:    myjson.WhereOpEq,
+				Value: name,
+			}).Query())
+			assert.NoError(t, err)
+			assert.Equal(t, 1, results.Count)
+			assert.Equal(t, id, results.Documents[0].GetString("_id"))
+			assert.False(t, results.Stats.Explain.Index.Primary)
+		}
+		assert.Error(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+			return tx.Set(ctx, "handle", myjson.D().Set(map[string]any{
+				"_id":  "d",
+				"name": "ab",
+			}).Doc())
+		}))
+	}))
+}
+
+func TestSecondaryIndexBatches(t *testing.T) {
+	ctx := myjson.SetMetadataRoles(context.Background(), []string{"super_user"})
+	db, err := myjson.Open(ctx, "badger", map[string]any{})
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+	assert.NoError(t, db.Configure(ctx, "", []string{playerSchema}))
+	// more documents than are looked up in a single batch
+	const count = 250
+	assert.NoError(t, db.Tx(ctx, kv.TxOpts{IsBatch: true}, func(ctx context.Context, tx myjson.Tx) error {
+		for i := 0; i < count; i++ {
+			if err := tx.Set(ctx, "player", myjson.D().Set(map[string]any{
+				"_id":   fmt.Sprint(i),
+				"score": i,
+			}).Doc()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	t.Run("every batch is scanned", func(t *testing.T) {
+		results, err := db.Query(ctx, "player", myjson.Q().Where(myjson.Where{
+			Field: "score",
+			Op:    myjson.WhereOpGte,
+			Value: 0,
+		}).Query())
+		assert.NoError(t, err)
+		assert.Equal(t, "player_score_idx", results.Stats.Explain.Index.Name)
+		assert.Equal(t, count, results.Count)
+		for i, doc := range results.Documents {
+			assert.Equal(t, float64(i), doc.GetFloat("score"))
+		}
+	})
+	t.Run("scan stops at the limit", func(t *testing.T) {
+		results, err := db.Query(ctx, "player", myjson.Q().Where(myjson.Where{
+			Field: "score",
+			Op:    myjson.WhereOpGte,
+			Value: 120,
+		}).Limit(5).Query())
+		assert.NoError(t, err)
+		assert.Equal(t, 5, results.Count)
+		assert.Equal(t, 120.0, results.Documents[0].GetFloat("score"))
+	})
+}
+
+func TestBatchReadOwnWrites(t *testing.T) {
+	assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+		usr := testutil.NewUserDoc()
+		assert.NoError(t, usr.Set("account_id", "batch"))
+		assert.NoError(t, db.Tx(ctx, kv.TxOpts{IsBatch: true}, func(ctx context.Context, tx myjson.Tx) error {
+			if err := tx.Set(ctx, "account", myjson.D().Set(map[string]any{
+				"_id":  "batch",
+				"name": "batch",
+			}).Doc()); err != nil {
+				return err
+			}
+			// the account is only visible to the foreign key check if the batch reads its own writes
+			if err := tx.Set(ctx, "user", usr); err != nil {
+				return err
+			}
+			account, err := tx.Get(ctx, "account", "batch")
+			assert.NoError(t, err)
+			assert.Equal(t, "batch", account.GetString("name"))
+			results, err := tx.Query(ctx, "user", myjson.Q().Where(myjson.Where{
+				Field: "account_id",
+				Op:    myjson.WhereOpEq,
+				Value: "batch",
+			}).Query())
+			assert.NoError(t, err)
+			assert.Equal(t, 1, results.Count)
+			return nil
+		}))
+		_, err := db.Get(ctx, "user", usr.GetString("_id"))
+		assert.NoError(t, err)
+	}))
+}
+
+func TestTxRetry(t *testing.T) {
+	// conflicting returns a transaction function that commits a concurrent write to the document it updates the first n times it runs
+	conflicting := func(db myjson.Database, n int, attempts *int) myjson.TxFunc {
+		return func(ctx context.Context, tx myjson.Tx) error {
+			*attempts++
+			if err := tx.Set(ctx, "account", myjson.D().Set(map[string]any{
+				"_id":  "retry",
+				"name": "outer",
+			}).Doc()); err != nil {
+				return err
+			}
+			if *attempts > n {
+				return nil
+			}
+			return db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				return tx.Set(ctx, "account", myjson.D().Set(map[string]any{
+					"_id":  "retry",
+					"name": "inner",
+				}).Doc())
+			})
+		}
+	}
+	t.Run("conflicts are not retried by default", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			var attempts int
+			err := db.Tx(ctx, kv.TxOpts{}, conflicting(db, 1, &attempts))
+			assert.Error(t, err)
+			assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+			assert.Equal(t, 1, attempts)
+		}))
+	})
+	t.Run("conflicts are retried", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			var attempts int
+			assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, conflicting(db, 2, &attempts)))
+			assert.Equal(t, 3, attempts)
+			doc, err := db.Get(ctx, "account", "retry")
+			assert.NoError(t, err)
+			assert.Equal(t, "outer", doc.GetString("name"))
+		}, myjson.WithRetryPolicy(myjson.DefaultRetryPolicy)))
+	})
+	t.Run("retry policy is overridden per call", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			var attempts int
+			ctx = myjson.SetTxRetryPolicy(ctx, myjson.RetryPolicy{
+				MaxAttempts:    2,
+				InitialBackoff: time.Millisecond,
+			})
+			err := db.Tx(ctx, kv.TxOpts{}, conflicting(db, 5, &attempts))
+			assert.Error(t, err)
+			assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+			assert.Equal(t, 2, attempts)
+		}, myjson.WithRetryPolicy(myjson.DefaultRetryPolicy)))
+	})
+	t.Run("other errors are not retried", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			var attempts int
+			assert.Error(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				attempts++
+				return errors.New(errors.Validation, "invalid")
+			}))
+			assert.Equal(t, 1, attempts)
+		}, myjson.WithRetryPolicy(myjson.DefaultRetryPolicy)))
+	})
+}
+
+func TestQueryIter(t *testing.T) {
+	var iterate = func(t *testing.T, ctx context.Context, db myjson.Database, query myjson.Query) ([]*myjson.Document, error) {
+		var documents []*myjson.Document
+		err := db.Tx(ctx, kv.TxOpts{IsReadOnly: true}, func(ctx context.Context, tx myjson.Tx) error {
+			iter, err := tx.QueryIter(ctx, "user", query)
+			if err != nil {
+				return err
+			}
+			defer iter.Close()
+			for iter.Next() {
+				documents = append(documents, iter.Doc())
+			}
+			return iter.Err()
+		})
+		return documents, err
+	}
+	var ids = func(documents []*myjson.Document) []string {
+		return lo.Map(documents, func(d *myjson.Document, _ int) string {
+			return d.GetString("_id")
+		})
+	}
+	assert.NoError(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+		assert.NoError(t, db.Tx(ctx, kv.TxOpts{IsReadOnly: false}, func(ctx context.Context, tx myjson.Tx) error {
+			for i := 0; i < 20; i++ {
+				u := testutil.NewUserDoc()
+				assert.NoError(t, u.Set("age", i%5))
+				assert.NoError(t, tx.Set(ctx, "user", u))
+			}
+			return nil
+		}))
+		t.Run("index order", func(t *testing.T) {
+			query := myjson.Q().Select(myjson.Select{Field: "*"}).Query()
+			documents, err := iterate(t, ctx, db, query)
+			assert.NoError(t, err)
+			page, err := db.Query(ctx, "user", query)
+			assert.NoError(t, err)
+			assert.Len(t, documents, 20)
+			assert.Equal(t, ids(page.Documents), ids(documents))
+		})
+		t.Run("index order (desc)", func(t *testing.T) {
+			query := myjson.Q().
+				Select(myjson.Select{Field: "*"}).
+				OrderBy(myjson.OrderBy{Field: "_id", Direction: myjson.OrderByDirectionDesc}).
+				Query()
+			documents, err := iterate(t, ctx, db, query)
+			assert.NoError(t, err)
+			page, err := db.Query(ctx, "user", query)
+			assert.NoError(t, err)
+			assert.Len(t, documents, 20)
+			assert.Equal(t, ids(page.Documents), ids(documents))
+		})
+		t.Run("index order (limit + page)", func(t *testing.T) {
+			query := myjson.Q().Select(myjson.Select{Field: "_id"}).Limit(5).Page(1).Query()
+			documents, err := iterate(t, ctx, db, query)
+			assert.NoError(t, err)
+			page, err := db.Query(ctx, "user", query)
+			assert.NoError(t, err)
+			assert.Len(t, documents, 5)
+			assert.Equal(t, ids(page.Documents), ids(documents))
+			assert.Empty(t, documents[0].GetString("name"))
+		})
+		t.Run("order by (limit + page)", func(t *testing.T) {
+			documents, err := iterate(t, ctx, db, myjson.Q().
+				Select(myjson.Select{Field: "*"}).
+				OrderBy(myjson.OrderBy{Field: "age", Direction: myjson.OrderByDirectionDesc}).
+				Limit(6).
+				Page(1).
+				Query())
+			assert.NoError(t, err)
+			assert.Equal(t, []float64{3, 3, 2, 2, 2, 2}, lo.Map(documents, func(d *myjson.Document, _ int) float64 {
+				return d.GetFloat("age")
+			}))
+		})
+		t.Run("order by", func(t *testing.T) {
+			documents, err := iterate(t, ctx, db, myjson.Q().
+				Select(myjson.Select{Field: "*"}).
+				Where(myjson.Where{Field: "age", Op: myjson.WhereOpGte, Value: 3}).
+				OrderBy(myjson.OrderBy{Field: "age", Direction: myjson.OrderByDirectionAsc}).
+				Query())
+			assert.NoError(t, err)
+			assert.Equal(t, []float64{3, 3, 3, 3, 4, 4, 4, 4}, lo.Map(documents, func(d *myjson.Document, _ int) float64 {
+				return d.GetFloat("age")
+			}))
+		})
+		t.Run("aggregate", func(t *testing.T) {
+			documents, err := iterate(t, ctx, db, myjson.Q().
+				Select(myjson.Select{Field: "age", Aggregate: myjson.AggregateFunctionMax, As: "max_age"}).
+				Query())
+			assert.NoError(t, err)
+			assert.Len(t, documents, 1)
+			assert.Equal(t, 4.0, documents[0].GetFloat("max_age"))
+		})
+		t.Run("cursor", func(t *testing.T) {
+			_, err := iterate(t, ctx, db, myjson.Q().Select(myjson.Select{Field: "*"}).Cursor("cursor").Limit(1).Query())
+			assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+		})
+	}))
+}
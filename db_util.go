@@ -1,12 +1,15 @@
 package myjson
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/kv"
+	"github.com/segmentio/ksuid"
 )
 
 func (d *defaultDB) lockCollection(ctx context.Context, collection string) (func(), error) {
@@ -200,3 +203,262 @@ func (d *defaultDB) getCachedCollections() []CollectionSchema {
 	})
 	return existing
 }
+
+const (
+	// changeStreamLookback is the maximum expected duration between a cdc entry being created & its transaction being committed.
+	// Entries are ordered by the time they were created, so a stream resumed from an entry also replays the entries created within
+	// the lookback before it since they may have been committed after it
+	changeStreamLookback = 5 * time.Second
+	// changeStreamProbeInterval is how often a resumed change stream re-sends its probe until its live subscription receives it
+	changeStreamProbeInterval = 10 * time.Millisecond
+)
+
+// tailChangeStream streams cdc entries as they are committed to the given collection
+func (d *defaultDB) tailChangeStream(ctx context.Context, collection string, filter []Where, fn func(cdc CDC) (bool, error)) error {
+	pfx := indexPrefix(ctx, cdcCollectionName, "_id.primaryidx")
+	return d.kv.ChangeStream(ctx, pfx, func(cdc kv.CDC) (bool, error) {
+		c, ok, err := changeStreamEntry(collection, filter, cdc)
+		if err != nil || !ok {
+			return err == nil, err
+		}
+		return fn(c)
+	})
+}
+
+// changeStreamEntry decodes the cdc entry written by a kv change. ok is false if the change isn't a cdc entry of the collection
+// that passes the filter
+func changeStreamEntry(collection string, filter []Where, cdc kv.CDC) (CDC, bool, error) {
+	if cdc.Operation != kv.SETOP {
+		return CDC{}, false, nil
+	}
+	doc, _ := NewDocumentFromBytes(cdc.Value)
+	pass, err := doc.Where(filter)
+	if err != nil || !pass {
+		return CDC{}, false, err
+	}
+	var c CDC
+	if err := doc.Scan(&c); err != nil {
+		return CDC{}, false, errors.Wrap(err, errors.Internal, "failed to unmarshal cdc")
+	}
+	return c, c.Collection == collection || collection == "*", nil
+}
+
+// cdcQueue is an unbounded queue of cdc entries - it buffers live entries while a resumed change stream replays persisted entries
+// without blocking the publisher
+type cdcQueue struct {
+	mu     sync.Mutex
+	items  []CDC
+	signal chan struct{}
+}
+
+func (q *cdcQueue) push(cdc CDC) {
+	q.mu.Lock()
+	q.items = append(q.items, cdc)
+	q.mu.Unlock()
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (q *cdcQueue) drain() []CDC {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := q.items
+	q.items = nil
+	return items
+}
+
+// resumeChangeStream replays the persisted cdc entries after the cursor and then switches to the live stream.
+// The replay only starts once the live subscription is active, so every entry committed after the replay's snapshot is received
+// live - live entries that were already emitted by the replay are dropped by id.
+func (d *defaultDB) resumeChangeStream(ctx context.Context, collection string, cursor ChangeStreamCursor, filter []Where, fn ChangeStreamHandler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		pfx = indexPrefix(ctx, cdcCollectionName, "_id.primaryidx")
+		// probe is a key that is deleted (it never exists) until the live subscription receives the deletion
+		probe     = append(append([]byte{}, pfx...), []byte(fmt.Sprintf("probe.%s", ksuid.New().String()))...)
+		ready     = make(chan struct{})
+		queue     = &cdcQueue{signal: make(chan struct{}, 1)}
+		errChan   = make(chan error, 1)
+		startedAt = time.Now()
+	)
+	go func() {
+		errChan <- d.kv.ChangeStream(ctx, pfx, func(cdc kv.CDC) (bool, error) {
+			if bytes.Equal(cdc.Key, probe) {
+				select {
+				case <-ready:
+				default:
+					close(ready)
+				}
+				return true, nil
+			}
+			c, ok, err := changeStreamEntry(collection, filter, cdc)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				queue.push(c)
+			}
+			return true, nil
+		})
+	}()
+	ticker := time.NewTicker(changeStreamProbeInterval)
+	defer ticker.Stop()
+	for active := false; !active; {
+		if err := d.kv.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+			return tx.Delete(ctx, probe)
+		}); err != nil {
+			return errors.Wrap(err, errors.Internal, "failed to probe change stream")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errChan:
+			return err
+		case <-ready:
+			active = true
+		case <-ticker.C:
+		}
+	}
+	internalCtx := SetIsInternal(ctx)
+	from := cursor.Timestamp
+	if cursor.ID != "" {
+		doc, err := d.Get(internalCtx, cdcCollectionName, cursor.ID)
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			return errors.New(errors.NotFound, "cdc entry not found: %s", cursor.ID)
+		}
+		var c CDC
+		if err := doc.Scan(&c); err != nil {
+			return errors.Wrap(err, errors.Internal, "failed to unmarshal cdc")
+		}
+		from = c.Timestamp - changeStreamLookback.Nanoseconds()
+	}
+	var (
+		// replayed holds the ids of the replayed entries that may also be received live - entries created more than the lookback
+		// before the subscription started were committed before it
+		replayed = map[string]struct{}{}
+		liveFrom = startedAt.Add(-changeStreamLookback).UnixNano()
+		stopped  = false
+	)
+	if _, err := d.ForEach(internalCtx, cdcCollectionName, ForEachOpts{
+		Where: []Where{
+			{
+				Field: "timestamp",
+				Op:    WhereOpGte,
+				Value: from,
+			},
+		},
+	}, func(doc *Document) (bool, error) {
+		var c CDC
+		if err := doc.Scan(&c); err != nil {
+			return false, errors.Wrap(err, errors.Internal, "failed to unmarshal cdc")
+		}
+		if c.ID == cursor.ID || c.Collection != collection && collection != "*" {
+			return true, nil
+		}
+		pass, err := doc.Where(filter)
+		if err != nil {
+			return false, err
+		}
+		if !pass {
+			return true, nil
+		}
+		if c.Timestamp >= liveFrom {
+			replayed[c.ID] = struct{}{}
+		}
+		cont, err := fn(ctx, c)
+		if err != nil {
+			return false, err
+		}
+		stopped = !cont
+		return cont, nil
+	}); err != nil || stopped {
+		return err
+	}
+	for {
+		for _, cdc := range queue.drain() {
+			if _, ok := replayed[cdc.ID]; ok {
+				// an entry is received from the live stream at most once
+				delete(replayed, cdc.ID)
+				continue
+			}
+			cont, err := fn(ctx, cdc)
+			if err != nil || !cont {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errChan:
+			return err
+		case <-queue.signal:
+		}
+	}
+}
+
+// ttlReaperOpts configures the expired document reaper
+type ttlReaperOpts struct {
+	interval   time.Duration
+	batchSize  int
+	namespaces []string
+}
+
+// reapExpired deletes expired documents from every collection with a ttl. Documents are deleted in batches through the
+// transaction api so that cdc, cascades & secondary indexes are kept consistent
+func (d *defaultDB) reapExpired(ctx context.Context) error {
+	for _, namespace := range d.ttlReaper.namespaces {
+		ctx := setIncludeExpired(SetIsInternal(SetMetadataNamespace(ctx, namespace)))
+		for _, c := range d.getCachedCollections() {
+			ttl := c.TTL()
+			if ttl == nil {
+				continue
+			}
+			for {
+				var (
+					expired []string
+					now     = time.Now()
+				)
+				// the ttl index is range scanned up to now
+				if _, err := d.ForEach(ctx, c.Collection(), ForEachOpts{
+					Where: []Where{
+						{
+							Field: ttl.Field,
+							Op:    WhereOpLte,
+							Value: now,
+						},
+					},
+				}, func(doc *Document) (bool, error) {
+					if ttl.IsExpired(doc, now) {
+						expired = append(expired, c.GetPrimaryKey(doc))
+					}
+					return len(expired) < d.ttlReaper.batchSize, nil
+				}); err != nil {
+					return errors.Wrap(err, 0, "failed to scan for expired documents: %s", c.Collection())
+				}
+				if len(expired) == 0 {
+					break
+				}
+				if err := d.Tx(ctx, kv.TxOpts{IsBatch: true}, func(ctx context.Context, tx Tx) error {
+					for _, id := range expired {
+						if err := tx.Delete(ctx, c.Collection(), id); err != nil {
+							return err
+						}
+					}
+					return nil
+				}); err != nil {
+					return errors.Wrap(err, 0, "failed to delete expired documents: %s", c.Collection())
+				}
+				if len(expired) < d.ttlReaper.batchSize {
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
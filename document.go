@@ -6,6 +6,7 @@ import (
 	"io"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -93,6 +94,10 @@ var modifiers = map[string]func(json, arg string) string{
 
 const selfRefPrefix = "$"
 
+// VersionField is the document field that holds the document's version. It is maintained by the database - it starts at 1 when
+// the document is created & is incremented every time the document is written
+const VersionField = "_version"
+
 // Document is a concurrency safe JSON document
 type Document struct {
 	result gjson.Result
@@ -243,6 +248,11 @@ func (d *Document) GetArray(field string) []any {
 	return cast.ToSlice(d.Get(field))
 }
 
+// Version returns the document's version (0 if the document hasn't been persisted)
+func (d *Document) Version() int64 {
+	return cast.ToInt64(d.Get(VersionField))
+}
+
 // Set sets a field on the document. Set has SJSON syntax support (dot notation)
 // For information on sjson syntax, check out https://github.com/tidwall/sjson#path-syntax
 func (d *Document) Set(field string, val any) error {
@@ -362,152 +372,288 @@ func (d *Document) DelAll(fields ...string) error {
 
 // Where executes the where clauses against the document and returns true if it passes the clauses.
 // If the value of a where clause is prefixed with $. it will compare where.field to the same document's $.{field}.
+// Or groups pass if any of their clauses pass & not groups pass if their clause doesn't pass.
 func (d *Document) Where(wheres []Where) (bool, error) {
+	return d.whereSchema(nil, wheres)
+}
+
+// whereSchema executes the where clauses against the document. Field values are compared based on the type of their property
+// in the collection schema (if one is given)
+func (d *Document) whereSchema(c CollectionSchema, wheres []Where) (bool, error) {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 	for _, w := range wheres {
-		var (
-			isSelf    = strings.HasPrefix(cast.ToString(w.Value), selfRefPrefix)
-			selfField = strings.TrimPrefix(cast.ToString(w.Value), selfRefPrefix)
-		)
-
-		switch w.Op {
-		case WhereOpEq:
-			if isSelf {
-				if d.Get(w.Field) != d.Get(selfField) || w.Value == "null" && d.Get(selfField) != nil {
-					return false, nil
-				}
-			} else {
-				if w.Value != d.Get(w.Field) || w.Value == "null" && d.Get(w.Field) != nil {
-					return false, nil
-				}
+		pass, err := d.where(c, w)
+		if err != nil || !pass {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// where evaluates a single where clause against the document - the caller must hold the document's lock
+func (d *Document) where(c CollectionSchema, w Where) (bool, error) {
+	switch {
+	case len(w.Or) > 0:
+		for _, or := range w.Or {
+			pass, err := d.where(c, or)
+			if err != nil {
+				return false, err
 			}
-		case WhereOpNeq:
-			if isSelf {
-				if d.Get(w.Field) == d.Get(selfField) || w.Value == "null" && d.Get(selfField) == nil {
-					return false, nil
-				}
-			} else {
-				if w.Value == d.Get(w.Field) || w.Value == "null" && d.Get(w.Field) == nil {
-					return false, nil
-				}
+			if pass {
+				return true, nil
 			}
-		case WhereOpLt:
-			if isSelf {
-				if d.GetFloat(w.Field) >= d.GetFloat(selfField) {
-					return false, nil
-				}
-			} else {
-				if d.GetFloat(w.Field) >= cast.ToFloat64(w.Value) {
-					return false, nil
-				}
+		}
+		return false, nil
+	case w.Not != nil:
+		pass, err := d.where(c, *w.Not)
+		if err != nil {
+			return false, err
+		}
+		return !pass, nil
+	}
+	var (
+		isSelf    = strings.HasPrefix(cast.ToString(w.Value), selfRefPrefix)
+		selfField = strings.TrimPrefix(cast.ToString(w.Value), selfRefPrefix)
+		// fieldVal & value are converted to the types of their schema properties for comparisons
+		fieldVal = typedValue(c, w.Field, d.Get(w.Field))
+		value    = typedValue(c, w.Field, w.Value)
+	)
+	if isSelf {
+		value = typedValue(c, selfField, d.Get(selfField))
+	}
+	_, isTime := value.(time.Time)
+	switch w.Op {
+	case WhereOpEq:
+		if isTime {
+			if compareValues(fieldVal, value) != 0 {
+				return false, nil
 			}
-		case WhereOpLte:
-			if isSelf {
-				if d.GetFloat(w.Field) > d.GetFloat(selfField) {
-					return false, nil
-				}
-			} else {
-				if d.GetFloat(w.Field) > cast.ToFloat64(w.Value) {
-					return false, nil
-				}
+		} else if isSelf {
+			if d.Get(w.Field) != d.Get(selfField) || w.Value == "null" && d.Get(selfField) != nil {
+				return false, nil
 			}
-		case WhereOpGt:
-			if isSelf {
-				if d.GetFloat(w.Field) <= d.GetFloat(selfField) {
-					return false, nil
-				}
-			} else {
-				if d.GetFloat(w.Field) <= cast.ToFloat64(w.Value) {
-					return false, nil
-				}
+		} else {
+			if w.Value != d.Get(w.Field) || w.Value == "null" && d.Get(w.Field) != nil {
+				return false, nil
 			}
-		case WhereOpGte:
-			if isSelf {
-				if d.GetFloat(w.Field) < d.GetFloat(selfField) {
-					return false, nil
-				}
-			} else {
-				if d.GetFloat(w.Field) < cast.ToFloat64(w.Value) {
-					return false, nil
-				}
+		}
+	case WhereOpNeq:
+		if isTime {
+			if compareValues(fieldVal, value) == 0 {
+				return false, nil
 			}
-		case WhereOpIn:
-			bits, _ := json.Marshal(w.Value)
-			arr := gjson.ParseBytes(bits).Array()
-			value := d.Get(w.Field)
-			match := false
-			for _, element := range arr {
-				if element.Value() == value {
-					match = true
-				}
+		} else if isSelf {
+			if d.Get(w.Field) == d.Get(selfField) || w.Value == "null" && d.Get(selfField) == nil {
+				return false, nil
 			}
-			if !match {
+		} else {
+			if w.Value == d.Get(w.Field) || w.Value == "null" && d.Get(w.Field) == nil {
 				return false, nil
 			}
-
-		case WhereOpContains:
-			fieldVal := d.Get(w.Field)
-			switch fieldVal := fieldVal.(type) {
-			case []bool:
-				if !lo.Contains(fieldVal, cast.ToBool(w.Value)) {
-					return false, nil
-				}
-			case []float64:
-				if !lo.Contains(fieldVal, cast.ToFloat64(w.Value)) {
-					return false, nil
-				}
-			case []string:
-				if !lo.Contains(fieldVal, cast.ToString(w.Value)) {
-					return false, nil
-				}
-			case string:
-				if !strings.Contains(fieldVal, cast.ToString(w.Value)) {
-					return false, nil
-				}
-			default:
-				if !strings.Contains(util.JSONString(fieldVal), util.JSONString(w.Value)) {
-					return false, nil
-				}
+		}
+	case WhereOpLt:
+		if compareValues(fieldVal, value) >= 0 {
+			return false, nil
+		}
+	case WhereOpLte:
+		if compareValues(fieldVal, value) > 0 {
+			return false, nil
+		}
+	case WhereOpGt:
+		if compareValues(fieldVal, value) <= 0 {
+			return false, nil
+		}
+	case WhereOpGte:
+		if compareValues(fieldVal, value) < 0 {
+			return false, nil
+		}
+	case WhereOpIn:
+		value := d.Get(w.Field)
+		match := false
+		for _, element := range whereValues(w.Value) {
+			if element.Value() == value {
+				match = true
 			}
+		}
+		if !match {
+			return false, nil
+		}
 
-		case WhereOpContainsAll:
-			fieldVal := cast.ToStringSlice(d.Get(w.Field))
-			for _, v := range cast.ToStringSlice(w.Value) {
-				if !lo.Contains(fieldVal, v) {
-					return false, nil
-				}
-			}
-		case WhereOpContainsAny:
-			fieldVal := cast.ToStringSlice(d.Get(w.Field))
-			for _, v := range cast.ToStringSlice(w.Value) {
-				if lo.Contains(fieldVal, v) {
-					return true, nil
-				}
+	case WhereOpContains:
+		fieldVal := d.Get(w.Field)
+		switch fieldVal := fieldVal.(type) {
+		case []bool:
+			if !lo.Contains(fieldVal, cast.ToBool(w.Value)) {
+				return false, nil
 			}
-		case WhereOpHasPrefix:
-			fieldVal := d.GetString(w.Field)
-			if !strings.HasPrefix(fieldVal, cast.ToString(w.Value)) {
+		case []float64:
+			if !lo.Contains(fieldVal, cast.ToFloat64(w.Value)) {
 				return false, nil
 			}
-		case WhereOpHasSuffix:
-			fieldVal := d.GetString(w.Field)
-			if !strings.HasSuffix(fieldVal, cast.ToString(w.Value)) {
+		case []string:
+			if !lo.Contains(fieldVal, cast.ToString(w.Value)) {
 				return false, nil
 			}
-		case WhereOpRegex:
-			fieldVal := d.Get(w.Field)
-			match, _ := regexp.Match(cast.ToString(w.Value), []byte(cast.ToString(fieldVal)))
-			if !match {
+		case string:
+			if !strings.Contains(fieldVal, cast.ToString(w.Value)) {
 				return false, nil
 			}
 		default:
-			return false, errors.New(errors.Validation, "unsupported operator: %s", w.Op)
+			if !strings.Contains(util.JSONString(fieldVal), util.JSONString(w.Value)) {
+				return false, nil
+			}
+		}
+
+	case WhereOpContainsAll:
+		fieldVal := cast.ToStringSlice(d.Get(w.Field))
+		for _, v := range cast.ToStringSlice(w.Value) {
+			if !lo.Contains(fieldVal, v) {
+				return false, nil
+			}
+		}
+	case WhereOpContainsAny:
+		fieldVal := cast.ToStringSlice(d.Get(w.Field))
+		match := false
+		for _, v := range cast.ToStringSlice(w.Value) {
+			if lo.Contains(fieldVal, v) {
+				match = true
+			}
+		}
+		if !match {
+			return false, nil
+		}
+	case WhereOpHasPrefix:
+		fieldVal := d.GetString(w.Field)
+		if !strings.HasPrefix(fieldVal, cast.ToString(w.Value)) {
+			return false, nil
+		}
+	case WhereOpHasSuffix:
+		fieldVal := d.GetString(w.Field)
+		if !strings.HasSuffix(fieldVal, cast.ToString(w.Value)) {
+			return false, nil
+		}
+	case WhereOpRegex:
+		fieldVal := d.Get(w.Field)
+		match, _ := regexp.Match(cast.ToString(w.Value), []byte(cast.ToString(fieldVal)))
+		if !match {
+			return false, nil
+		}
+	case WhereOpNotIn:
+		value := d.Get(w.Field)
+		for _, element := range whereValues(w.Value) {
+			if element.Value() == value {
+				return false, nil
+			}
+		}
+	case WhereOpExists:
+		if !d.result.Get(w.Field).Exists() {
+			return false, nil
+		}
+	case WhereOpNotExists:
+		if d.result.Get(w.Field).Exists() {
+			return false, nil
+		}
+	case WhereOpType:
+		result := d.result.Get(w.Field)
+		if !result.Exists() || jsonType(result) != cast.ToString(w.Value) {
+			return false, nil
+		}
+	case WhereOpBetween:
+		min, max, err := betweenValues(w.Value)
+		if err != nil {
+			return false, err
 		}
+		if compareValues(fieldVal, typedValue(c, w.Field, min)) < 0 || compareValues(fieldVal, typedValue(c, w.Field, max)) > 0 {
+			return false, nil
+		}
+	case WhereOpSize:
+		result := d.result.Get(w.Field)
+		if !result.IsArray() || len(result.Array()) != cast.ToInt(w.Value) {
+			return false, nil
+		}
+	case WhereOpElemMatch:
+		wheres, err := elemMatchValue(w.Value)
+		if err != nil {
+			return false, err
+		}
+		match := false
+		for _, element := range d.result.Get(w.Field).Array() {
+			if !element.IsObject() {
+				continue
+			}
+			elementDoc, err := NewDocumentFromBytes([]byte(element.Raw))
+			if err != nil {
+				return false, err
+			}
+			pass, err := elementDoc.Where(wheres)
+			if err != nil {
+				return false, err
+			}
+			if pass {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false, nil
+		}
+	default:
+		return false, errors.New(errors.Validation, "unsupported operator: %s", w.Op)
 	}
 	return true, nil
 }
 
+// whereValues returns the elements of an array where clause value
+func whereValues(value any) []gjson.Result {
+	bits, _ := json.Marshal(value)
+	return gjson.ParseBytes(bits).Array()
+}
+
+// betweenValues returns the min & max of a between where clause value
+func betweenValues(value any) (any, any, error) {
+	values := whereValues(value)
+	if len(values) != 2 {
+		return nil, nil, errors.New(errors.Validation, "'between' requires a [min, max] value")
+	}
+	return values[0].Value(), values[1].Value(), nil
+}
+
+// elemMatchValue returns the where clauses of an elemMatch where clause value
+func elemMatchValue(value any) ([]Where, error) {
+	if wheres, ok := value.([]Where); ok {
+		return wheres, nil
+	}
+	var wheres []Where
+	if err := util.Decode(value, &wheres); err != nil {
+		return nil, errors.Wrap(err, errors.Validation, "'elemMatch' requires a list of where clauses")
+	}
+	if len(wheres) == 0 {
+		return nil, errors.New(errors.Validation, "'elemMatch' requires a list of where clauses")
+	}
+	return wheres, nil
+}
+
+// jsonType returns the json type of a value (string, number, boolean, array, object, null)
+func jsonType(result gjson.Result) string {
+	switch {
+	case result.IsArray():
+		return "array"
+	case result.IsObject():
+		return "object"
+	}
+	switch result.Type {
+	case gjson.True, gjson.False:
+		return "boolean"
+	case gjson.String:
+		return "string"
+	case gjson.Number:
+		return "number"
+	default:
+		return "null"
+	}
+}
+
 // Diff calculates a json diff between the document and the input document
 func (d *Document) Diff(before *Document) []JSONFieldOp {
 	if before != nil && before.String() == d.String() {
@@ -578,6 +724,159 @@ func (d *Document) ApplyOps(ops []JSONFieldOp) error {
 	return nil
 }
 
+// ApplyUpdate applies an update to the document. Top level keys of the update that are update operators (see UpdateOp) are
+// applied against the document's current values - every other key is merged into the document
+func (d *Document) ApplyUpdate(update map[string]any) error {
+	// round trip the update through json so that its values are comparable with the document's values
+	normalized, err := NewDocumentFrom(update)
+	if err != nil {
+		return errors.Wrap(err, errors.Validation, "invalid update")
+	}
+	var (
+		fields    = map[string]any{}
+		operators = map[UpdateOp]map[string]any{}
+	)
+	for key, value := range normalized.Value() {
+		if !strings.HasPrefix(key, "$") {
+			fields[key] = value
+			continue
+		}
+		if !lo.Contains(updateOps, UpdateOp(key)) {
+			return errors.New(errors.Validation, "unsupported update operator: %s", key)
+		}
+		args, ok := value.(map[string]any)
+		if !ok {
+			return errors.New(errors.Validation, "update operator %s expects an object of fields", key)
+		}
+		operators[UpdateOp(key)] = args
+	}
+	flattened, err := flat2.Flatten(fields, nil)
+	if err != nil {
+		return err
+	}
+	if err := d.SetAll(flattened); err != nil {
+		return err
+	}
+	for _, op := range updateOps {
+		fields := lo.Keys(operators[op])
+		sort.Strings(fields)
+		for _, field := range fields {
+			if err := d.applyUpdateOp(op, field, operators[op][field]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateOps are the supported update operators in the order they are applied - the order is fixed so that the result of an
+// update doesn't depend on map iteration
+var updateOps = []UpdateOp{
+	UpdateOpUnset,
+	UpdateOpInc,
+	UpdateOpMul,
+	UpdateOpMin,
+	UpdateOpMax,
+	UpdateOpPush,
+	UpdateOpAddToSet,
+	UpdateOpPull,
+	UpdateOpCurrentDate,
+}
+
+func (d *Document) applyUpdateOp(op UpdateOp, field string, arg any) error {
+	current := d.Get(field)
+	switch op {
+	case UpdateOpUnset:
+		return d.Del(field)
+	case UpdateOpInc, UpdateOpMul:
+		amount, ok := arg.(float64)
+		if !ok {
+			return errors.New(errors.Validation, "%s: %s expects a number", op, field)
+		}
+		value, ok := current.(float64)
+		if current != nil && !ok {
+			return errors.New(errors.Validation, "%s: %s is not a number", op, field)
+		}
+		if op == UpdateOpInc {
+			return d.Set(field, value+amount)
+		}
+		return d.Set(field, value*amount)
+	case UpdateOpMin, UpdateOpMax:
+		if current == nil {
+			return d.Set(field, arg)
+		}
+		less, err := lessUpdateValue(current, arg)
+		if err != nil {
+			return errors.Wrap(err, 0, "%s: %s", op, field)
+		}
+		greater, err := lessUpdateValue(arg, current)
+		if err != nil {
+			return errors.Wrap(err, 0, "%s: %s", op, field)
+		}
+		if (op == UpdateOpMin && greater) || (op == UpdateOpMax && less) {
+			return d.Set(field, arg)
+		}
+		return nil
+	case UpdateOpPush, UpdateOpAddToSet, UpdateOpPull:
+		values, ok := current.([]any)
+		if current != nil && !ok {
+			return errors.New(errors.Validation, "%s: %s is not an array", op, field)
+		}
+		switch op {
+		case UpdateOpPull:
+			// pulling from a missing field is a no-op
+			if current == nil {
+				return nil
+			}
+			return d.Set(field, lo.Filter(values, func(v any, _ int) bool {
+				return !reflect.DeepEqual(v, arg)
+			}))
+		case UpdateOpPush:
+			return d.Set(field, append(values, eachUpdateValue(arg)...))
+		default:
+			if values == nil {
+				values = []any{}
+			}
+			for _, v := range eachUpdateValue(arg) {
+				if !lo.ContainsBy(values, func(existing any) bool {
+					return reflect.DeepEqual(existing, v)
+				}) {
+					values = append(values, v)
+				}
+			}
+			return d.Set(field, values)
+		}
+	case UpdateOpCurrentDate:
+		return d.Set(field, time.Now())
+	}
+	return errors.New(errors.Validation, "unsupported update operator: %s", op)
+}
+
+// eachUpdateValue returns the values that are added to an array by push & addToSet
+func eachUpdateValue(arg any) []any {
+	if m, ok := arg.(map[string]any); ok && len(m) == 1 {
+		if each, ok := m[updateOpEach].([]any); ok {
+			return each
+		}
+	}
+	return []any{arg}
+}
+
+// lessUpdateValue returns true if a is less than b - only numbers & strings (ex: RFC3339 timestamps) are comparable
+func lessUpdateValue(a, b any) (bool, error) {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			return a < b, nil
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return a < b, nil
+		}
+	}
+	return false, errors.New(errors.Validation, "cannot compare %v with %v", a, b)
+}
+
 // RevertOps reverts the given JSON field operations to the document
 func (d *Document) RevertOps(diff []JSONFieldOp) error {
 	for _, op := range diff {
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/autom8ter/myjson"
+	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/testutil"
 	"github.com/autom8ter/myjson/util"
 	"github.com/brianvoe/gofakeit/v6"
@@ -346,6 +347,141 @@ func TestDocument(t *testing.T) {
 		assert.NoError(t, err)
 		assert.False(t, pass)
 	})
+	t.Run("where groups", func(t *testing.T) {
+		usr := testutil.NewUserDoc()
+		assert.NoError(t, usr.Set("age", 30))
+		pass, err := usr.Where([]myjson.Where{
+			{
+				Or: []myjson.Where{
+					{Field: "age", Op: myjson.WhereOpGt, Value: 50},
+					{Field: "name", Op: myjson.WhereOpEq, Value: usr.Get("name")},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, pass)
+
+		pass, err = usr.Where([]myjson.Where{
+			{
+				Or: []myjson.Where{
+					{Field: "age", Op: myjson.WhereOpGt, Value: 50},
+					{Field: "age", Op: myjson.WhereOpLt, Value: 10},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, pass)
+
+		pass, err = usr.Where([]myjson.Where{
+			{
+				Not: &myjson.Where{Field: "age", Op: myjson.WhereOpGt, Value: 50},
+			},
+			{
+				Not: &myjson.Where{
+					Or: []myjson.Where{
+						{Field: "age", Op: myjson.WhereOpEq, Value: 1.0},
+						{Field: "age", Op: myjson.WhereOpEq, Value: 2.0},
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, pass)
+
+		pass, err = usr.Where([]myjson.Where{
+			{
+				Not: &myjson.Where{Field: "age", Op: myjson.WhereOpEq, Value: usr.Get("age")},
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, pass)
+
+		_, err = usr.Where([]myjson.Where{
+			{
+				Or: []myjson.Where{
+					{Field: "age", Op: "8", Value: 50},
+				},
+			},
+		})
+		assert.Error(t, err)
+	})
+	t.Run("where containsAny", func(t *testing.T) {
+		d, _ := myjson.NewDocumentFrom(map[string]any{
+			"tags": []string{"a", "b"},
+			"age":  1,
+		})
+		pass, err := d.Where([]myjson.Where{
+			{Field: "tags", Op: myjson.WhereOpContainsAny, Value: []string{"c", "a"}},
+			{Field: "age", Op: myjson.WhereOpEq, Value: 1.0},
+		})
+		assert.NoError(t, err)
+		assert.True(t, pass)
+
+		pass, err = d.Where([]myjson.Where{
+			{Field: "tags", Op: myjson.WhereOpContainsAny, Value: []string{"a"}},
+			{Field: "age", Op: myjson.WhereOpEq, Value: 2.0},
+		})
+		assert.NoError(t, err)
+		assert.False(t, pass)
+	})
+	t.Run("where operators", func(t *testing.T) {
+		d, err := myjson.NewDocumentFrom(map[string]any{
+			"name":  "john",
+			"age":   30,
+			"tags":  []string{"a", "b"},
+			"notes": nil,
+			"items": []map[string]any{
+				{"sku": "abc", "quantity": 1},
+				{"sku": "xyz", "quantity": 5},
+			},
+		})
+		assert.NoError(t, err)
+		for _, test := range []struct {
+			where myjson.Where
+			pass  bool
+		}{
+			{myjson.Where{Field: "name", Op: myjson.WhereOpExists}, true},
+			{myjson.Where{Field: "notes", Op: myjson.WhereOpExists}, true},
+			{myjson.Where{Field: "email", Op: myjson.WhereOpExists}, false},
+			{myjson.Where{Field: "email", Op: myjson.WhereOpNotExists}, true},
+			{myjson.Where{Field: "name", Op: myjson.WhereOpNotExists}, false},
+			{myjson.Where{Field: "name", Op: myjson.WhereOpType, Value: "string"}, true},
+			{myjson.Where{Field: "age", Op: myjson.WhereOpType, Value: "number"}, true},
+			{myjson.Where{Field: "tags", Op: myjson.WhereOpType, Value: "array"}, true},
+			{myjson.Where{Field: "items.0", Op: myjson.WhereOpType, Value: "object"}, true},
+			{myjson.Where{Field: "notes", Op: myjson.WhereOpType, Value: "null"}, true},
+			{myjson.Where{Field: "email", Op: myjson.WhereOpType, Value: "null"}, false},
+			{myjson.Where{Field: "age", Op: myjson.WhereOpType, Value: "string"}, false},
+			{myjson.Where{Field: "age", Op: myjson.WhereOpBetween, Value: []int{30, 40}}, true},
+			{myjson.Where{Field: "age", Op: myjson.WhereOpBetween, Value: []int{20, 30}}, true},
+			{myjson.Where{Field: "age", Op: myjson.WhereOpBetween, Value: []int{31, 40}}, false},
+			{myjson.Where{Field: "tags", Op: myjson.WhereOpSize, Value: 2}, true},
+			{myjson.Where{Field: "tags", Op: myjson.WhereOpSize, Value: 1}, false},
+			{myjson.Where{Field: "name", Op: myjson.WhereOpSize, Value: 4}, false},
+			{myjson.Where{Field: "name", Op: myjson.WhereOpNotIn, Value: []string{"jane", "jim"}}, true},
+			{myjson.Where{Field: "name", Op: myjson.WhereOpNotIn, Value: []string{"jane", "john"}}, false},
+			{myjson.Where{Field: "items", Op: myjson.WhereOpElemMatch, Value: []myjson.Where{
+				{Field: "sku", Op: myjson.WhereOpEq, Value: "xyz"},
+				{Field: "quantity", Op: myjson.WhereOpGte, Value: 5},
+			}}, true},
+			{myjson.Where{Field: "items", Op: myjson.WhereOpElemMatch, Value: []myjson.Where{
+				{Field: "sku", Op: myjson.WhereOpEq, Value: "abc"},
+				{Field: "quantity", Op: myjson.WhereOpGte, Value: 5},
+			}}, false},
+			{myjson.Where{Field: "items", Op: myjson.WhereOpElemMatch, Value: []any{
+				map[string]any{"field": "sku", "op": "eq", "value": "abc"},
+			}}, true},
+			{myjson.Where{Field: "tags", Op: myjson.WhereOpElemMatch, Value: []myjson.Where{
+				{Field: "sku", Op: myjson.WhereOpExists},
+			}}, false},
+		} {
+			pass, err := d.Where([]myjson.Where{test.where})
+			assert.NoError(t, err, test.where)
+			assert.Equal(t, test.pass, pass, test.where)
+		}
+		_, err = d.Where([]myjson.Where{{Field: "age", Op: myjson.WhereOpBetween, Value: 1}})
+		assert.Error(t, err)
+	})
 	t.Run("mergeJoin", func(t *testing.T) {
 		usr := testutil.NewUserDoc()
 		tsk := testutil.NewTaskDoc(usr.GetString("_id"))
@@ -509,6 +645,111 @@ func TestDocument(t *testing.T) {
 
 }
 
+func TestDocumentApplyUpdate(t *testing.T) {
+	newDoc := func() *myjson.Document {
+		return myjson.D().Set(map[string]any{
+			"name":  "autom8ter",
+			"count": 1,
+			"score": 10,
+			"tags":  []string{"a", "b"},
+			"contact": map[string]any{
+				"email": "coleman@autom8ter.com",
+			},
+		}).Doc()
+	}
+	t.Run("fields are merged", func(t *testing.T) {
+		doc := newDoc()
+		assert.NoError(t, doc.ApplyUpdate(map[string]any{
+			"name":    "coleman",
+			"contact": map[string]any{"phone": "555"},
+		}))
+		assert.Equal(t, "coleman", doc.GetString("name"))
+		assert.Equal(t, "coleman@autom8ter.com", doc.GetString("contact.email"))
+		assert.Equal(t, "555", doc.GetString("contact.phone"))
+	})
+	t.Run("$inc", func(t *testing.T) {
+		doc := newDoc()
+		assert.NoError(t, doc.ApplyUpdate(map[string]any{
+			"$inc": map[string]any{"count": 2, "stats.logins": 1},
+		}))
+		assert.Equal(t, 3, doc.GetInt("count"))
+		assert.Equal(t, 1, doc.GetInt("stats.logins"))
+	})
+	t.Run("$mul", func(t *testing.T) {
+		doc := newDoc()
+		assert.NoError(t, doc.ApplyUpdate(map[string]any{
+			"$mul": map[string]any{"score": 1.5, "missing": 2},
+		}))
+		assert.Equal(t, 15.0, doc.GetFloat("score"))
+		assert.Equal(t, 0.0, doc.GetFloat("missing"))
+	})
+	t.Run("$min & $max", func(t *testing.T) {
+		doc := newDoc()
+		assert.NoError(t, doc.ApplyUpdate(map[string]any{
+			"$min": map[string]any{"score": 5, "count": 100, "low": 1},
+			"$max": map[string]any{"name": "zed"},
+		}))
+		assert.Equal(t, 5, doc.GetInt("score"))
+		assert.Equal(t, 1, doc.GetInt("count"))
+		assert.Equal(t, 1, doc.GetInt("low"))
+		assert.Equal(t, "zed", doc.GetString("name"))
+		assert.Error(t, doc.ApplyUpdate(map[string]any{
+			"$max": map[string]any{"name": 1},
+		}))
+	})
+	t.Run("$push", func(t *testing.T) {
+		doc := newDoc()
+		assert.NoError(t, doc.ApplyUpdate(map[string]any{
+			"$push": map[string]any{"tags": "a", "new": map[string]any{"$each": []string{"x", "y"}}},
+		}))
+		assert.Equal(t, []any{"a", "b", "a"}, doc.GetArray("tags"))
+		assert.Equal(t, []any{"x", "y"}, doc.GetArray("new"))
+	})
+	t.Run("$addToSet", func(t *testing.T) {
+		doc := newDoc()
+		assert.NoError(t, doc.ApplyUpdate(map[string]any{
+			"$addToSet": map[string]any{"tags": map[string]any{"$each": []string{"b", "c", "c"}}},
+		}))
+		assert.Equal(t, []any{"a", "b", "c"}, doc.GetArray("tags"))
+	})
+	t.Run("$pull", func(t *testing.T) {
+		doc := newDoc()
+		assert.NoError(t, doc.ApplyUpdate(map[string]any{
+			"$pull": map[string]any{"tags": "a", "missing": "a"},
+		}))
+		assert.Equal(t, []any{"b"}, doc.GetArray("tags"))
+		assert.False(t, doc.Exists("missing"))
+	})
+	t.Run("$unset", func(t *testing.T) {
+		doc := newDoc()
+		assert.NoError(t, doc.ApplyUpdate(map[string]any{
+			"$unset": map[string]any{"contact.email": ""},
+		}))
+		assert.False(t, doc.Exists("contact.email"))
+	})
+	t.Run("$currentDate", func(t *testing.T) {
+		doc := newDoc()
+		now := time.Now()
+		assert.NoError(t, doc.ApplyUpdate(map[string]any{
+			"$currentDate": map[string]any{"updated_at": true},
+		}))
+		assert.WithinDuration(t, now, doc.GetTime("updated_at"), time.Minute)
+	})
+	t.Run("invalid operands", func(t *testing.T) {
+		doc := newDoc()
+		err := doc.ApplyUpdate(map[string]any{"$inc": map[string]any{"name": 1}})
+		assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+		err = doc.ApplyUpdate(map[string]any{"$inc": map[string]any{"count": "1"}})
+		assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+		err = doc.ApplyUpdate(map[string]any{"$push": map[string]any{"name": "x"}})
+		assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+		err = doc.ApplyUpdate(map[string]any{"$inc": 1})
+		assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+		err = doc.ApplyUpdate(map[string]any{"$rename": map[string]any{"name": "alias"}})
+		assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+	})
+}
+
 func BenchmarkDocument(b *testing.B) {
 	b.ReportAllocs()
 	doc := testutil.NewUserDoc()
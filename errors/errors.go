@@ -15,6 +15,9 @@ const (
 	Forbidden    Code = http.StatusForbidden
 	Validation   Code = http.StatusBadRequest
 	Unauthorized Code = http.StatusUnauthorized
+	// Conflict indicates that a transaction could not be committed because another transaction wrote the same keys - the
+	// transaction may succeed if it is run again
+	Conflict Code = http.StatusConflict
 )
 
 // Error is a custom error
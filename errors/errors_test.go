@@ -23,6 +23,11 @@ func TestErrors(t *testing.T) {
 		err := errors.New(errors.NotFound, "not found")
 		assert.Equal(t, errors.NotFound, errors.Extract(err).Code)
 	})
+	t.Run("wrap preserves conflict code", func(t *testing.T) {
+		err := errors.New(errors.Conflict, "conflict")
+		err = errors.Wrap(err, 0, "rolled back")
+		assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+	})
 	t.Run("new error then wrap", func(t *testing.T) {
 		err := errors.New(0, "not found")
 		err = errors.Wrap(err, errors.NotFound, "")
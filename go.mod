@@ -5,13 +5,18 @@ go 1.18
 require (
 	github.com/autom8ter/machine/v4 v4.0.0-20221003043928-593fc3a020bb
 	github.com/brianvoe/gofakeit/v6 v6.19.0
+	github.com/cockroachdb/pebble v1.1.0
 	github.com/dgraph-io/badger/v3 v3.2103.2
 	github.com/dop251/goja v0.0.0-20221224150820-cc4634e76e9a
 	github.com/ghodss/yaml v1.0.0
 	github.com/go-playground/validator/v10 v10.11.1
 	github.com/go-redis/redis/v9 v9.0.0-rc.2
+	github.com/golang/snappy v0.0.4
+	github.com/google/btree v1.1.2
 	github.com/google/uuid v1.3.0
+	github.com/hashicorp/raft v1.3.11
 	github.com/huandu/xstrings v1.4.0
+	github.com/klauspost/compress v1.13.6
 	github.com/mitchellh/mapstructure v1.5.0
 	github.com/nqd/flat v0.1.1
 	github.com/samber/lo v1.28.2
@@ -23,6 +28,7 @@ require (
 	github.com/tidwall/sjson v1.2.5
 	github.com/tikv/client-go/v2 v2.0.3
 	github.com/xeipuuv/gojsonschema v1.2.0
+	go.etcd.io/bbolt v1.3.7
 	golang.org/x/sync v0.1.0
 )
 
@@ -51,12 +57,9 @@ require (
 	github.com/golang/glog v1.0.0 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
-	github.com/golang/snappy v0.0.4 // indirect
-	github.com/google/btree v1.1.2 // indirect
 	github.com/google/flatbuffers v1.12.1 // indirect
 	github.com/grpc-ecosystem/go-grpc-middleware v1.3.0 // indirect
 	github.com/imdario/mergo v0.3.13 // indirect
-	github.com/klauspost/compress v1.13.6 // indirect
 	github.com/leodido/go-urn v1.2.1 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
 	github.com/mitchellh/copystructure v1.2.0 // indirect
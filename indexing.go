@@ -4,13 +4,29 @@ import (
 	"bytes"
 	"context"
 
+	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/util"
 	"github.com/nqd/flat"
 	"github.com/spf13/cast"
+	"github.com/tidwall/gjson"
 )
 
+// nullByte separates the components of an index key. Every component is escaped (or encoded) so that it never contains a null byte
 var nullByte = []byte("\x00")
 
+// indexKeyPrefix returns the escaped leading components of every index key: namespace, "index", collection, and index name (if set)
+func indexKeyPrefix(ctx context.Context, collection, index string) [][]byte {
+	path := [][]byte{
+		util.EscapeIndexComponent([]byte(cast.ToString(GetMetadataValue(ctx, MetadataKeyNamespace)))),
+		[]byte("index"),
+		util.EscapeIndexComponent([]byte(collection)),
+	}
+	if index != "" {
+		path = append(path, util.EscapeIndexComponent([]byte(index)))
+	}
+	return path
+}
+
 // indexFieldValue is a key value pair
 type indexFieldValue struct {
 	Field string `json:"field"`
@@ -20,12 +36,7 @@ type indexFieldValue struct {
 func seekPrefix(ctx context.Context, collection string, i Index, fields map[string]any) indexPathPrefix {
 	fields, _ = flat.Flatten(fields, nil)
 	var prefix = indexPathPrefix{
-		prefix: [][]byte{
-			[]byte(cast.ToString(GetMetadataValue(ctx, MetadataKeyNamespace))),
-			[]byte("index"),
-			[]byte(collection),
-			[]byte(i.Name),
-		},
+		prefix: indexKeyPrefix(ctx, collection, i.Name),
 	}
 	if i.Fields == nil {
 		return prefix
@@ -38,6 +49,39 @@ func seekPrefix(ctx context.Context, collection string, i Index, fields map[stri
 	return prefix
 }
 
+// typedSeekPrefix returns the seek prefix of an index in the collection - the field values are converted to the types of their
+// schema properties first so that they are encoded in a consistent order
+func typedSeekPrefix(ctx context.Context, c CollectionSchema, i Index, fields map[string]any) indexPathPrefix {
+	fields, _ = flat.Flatten(fields, nil)
+	for _, k := range i.Fields {
+		if v, ok := fields[k]; ok {
+			fields[k] = indexValue(c, k, v)
+		}
+	}
+	return seekPrefix(ctx, c.Collection(), i, fields)
+}
+
+// documentIndexFields returns the values of a document's index fields. Integer properties are read from the raw json so that
+// they are indexed exactly, even if they can't be represented by a float64
+func documentIndexFields(c CollectionSchema, i Index, d *Document) map[string]any {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var fields = map[string]any{}
+	for _, field := range i.Fields {
+		result := d.result.Get(field)
+		// objects & arrays are not indexed
+		if !result.Exists() || result.IsObject() || result.IsArray() {
+			continue
+		}
+		if result.Type == gjson.Number && c.PropertyPaths()[field].Type == integerType {
+			fields[field] = result.Int()
+			continue
+		}
+		fields[field] = result.Value()
+	}
+	return fields
+}
+
 type indexPathPrefix struct {
 	prefix    [][]byte
 	seekValue any
@@ -46,7 +90,7 @@ type indexPathPrefix struct {
 }
 
 func (i indexPathPrefix) Append(field string, value any) indexPathPrefix {
-	fields := append(i.fields, []byte(field), util.EncodeIndexValue(value))
+	fields := append(i.fields, util.EscapeIndexComponent([]byte(field)), util.EncodeIndexValue(value))
 	fieldMap := append(i.fieldMap, indexFieldValue{
 		Field: field,
 		Value: value,
@@ -67,12 +111,27 @@ func (i indexPathPrefix) Seek(value any) indexPathPrefix {
 	}
 }
 
+// Path returns the index key. If a seek value is not set, the path is terminated by a separator so that it is only a prefix
+// of keys whose components match exactly (ex: a prefix for the value "a" does not match keys with the value "ab")
 func (i indexPathPrefix) Path() []byte {
-	var path = append(i.prefix, i.fields...)
+	var path = make([][]byte, 0, len(i.prefix)+len(i.fields)+1)
+	path = append(append(path, i.prefix...), i.fields...)
 	if i.seekValue != nil {
 		path = append(path, util.EncodeIndexValue(i.seekValue))
+		return bytes.Join(path, nullByte)
 	}
-	return bytes.Join(path, nullByte)
+	return append(bytes.Join(path, nullByte), nullByte...)
+}
+
+// indexKeyDocID returns the id of the document that an index key references - it is always the last component of the key.
+// Components never contain the separator, so the key may be safely split
+func indexKeyDocID(key []byte) (string, error) {
+	split := bytes.Split(key, nullByte)
+	id, err := util.DecodeIndexValue(split[len(split)-1])
+	if err != nil {
+		return "", errors.Wrap(err, errors.Internal, "failed to decode document id from index key")
+	}
+	return cast.ToString(id), nil
 }
 
 func (i indexPathPrefix) SeekValue() any {
@@ -83,21 +142,17 @@ func (i indexPathPrefix) Fields() []indexFieldValue {
 	return i.fieldMap
 }
 
+// primaryKey returns the key of a document in the primary index
+func primaryKey(ctx context.Context, c CollectionSchema, docID string) []byte {
+	return seekPrefix(ctx, c.Collection(), c.PrimaryIndex(), map[string]any{
+		c.PrimaryKey(): docID,
+	}).Seek(docID).Path()
+}
+
 func indexPrefix(ctx context.Context, collection, index string) []byte {
-	path := [][]byte{
-		[]byte(cast.ToString(GetMetadataValue(ctx, MetadataKeyNamespace))),
-		[]byte("index"),
-		[]byte(collection),
-		[]byte(index),
-	}
-	return bytes.Join(path, nullByte)
+	return append(bytes.Join(indexKeyPrefix(ctx, collection, index), nullByte), nullByte...)
 }
 
 func collectionPrefix(ctx context.Context, collection string) []byte {
-	path := [][]byte{
-		[]byte(cast.ToString(GetMetadataValue(ctx, MetadataKeyNamespace))),
-		[]byte("index"),
-		[]byte(collection),
-	}
-	return bytes.Join(path, nullByte)
+	return append(bytes.Join(indexKeyPrefix(ctx, collection, ""), nullByte), nullByte...)
 }
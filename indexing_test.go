@@ -1,6 +1,7 @@
 package myjson
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"testing"
@@ -22,7 +23,7 @@ func TestIndexing(t *testing.T) {
 			})
 
 			assert.Equal(t,
-				"ZGVmYXVsdABpbmRleAB1c2VyAHByaW1hcnlfaWR4AF9pZAAxMjM=",
+				"ZGVmYXVsdABpbmRleAB1c2VyAHByaW1hcnlfaWR4AF9pZAAFMTIzAA==",
 				base64.StdEncoding.EncodeToString(pfx.Path()))
 		}
 		{
@@ -37,7 +38,7 @@ func TestIndexing(t *testing.T) {
 			})
 			assert.Equal(t, 1, len(pfx.Fields()))
 			assert.Equal(t,
-				"ZGVmYXVsdABpbmRleAB1c2VyAHByaW1hcnlfaWR4AF9pZAAxMjMAMTIz",
+				"ZGVmYXVsdABpbmRleAB1c2VyAHByaW1hcnlfaWR4AF9pZAAFMTIzAAUxMjM=",
 				base64.StdEncoding.EncodeToString(pfx.Seek("123").Path()))
 		}
 		{
@@ -54,9 +55,39 @@ func TestIndexing(t *testing.T) {
 			assert.Equal(t, 2, len(pfx.Fields()))
 			assert.Empty(t, pfx.SeekValue())
 			assert.Equal(t,
-				"ZGVmYXVsdABpbmRleAB1c2VyAHRlc3RpbmcAYWNjb3VudF9pZAAxMjMAY29udGFjdC5lbWFpbABhdXRvbTh0ZXJAZ21haWwuY29t",
+				"ZGVmYXVsdABpbmRleAB1c2VyAHRlc3RpbmcAYWNjb3VudF9pZAAFMTIzAGNvbnRhY3QuZW1haWwABWF1dG9tOHRlckBnbWFpbC5jb20A",
 				base64.StdEncoding.EncodeToString(pfx.Path()))
 		}
 
 	})
+	t.Run("indexKeyDocID", func(t *testing.T) {
+		pfx := seekPrefix(context.Background(), "user", Index{
+			Name:   "testing",
+			Fields: []string{"age"},
+		}, map[string]any{
+			"age": -1.5,
+		})
+		id, err := indexKeyDocID(pfx.Seek("a\x00b").Path())
+		assert.NoError(t, err)
+		assert.Equal(t, "a\x00b", id)
+	})
+	t.Run("escaped components", func(t *testing.T) {
+		ctx := SetMetadataNamespace(context.Background(), "a\x00b")
+		idx := Index{
+			Name:   "testing",
+			Fields: []string{"name"},
+		}
+		pfx := seekPrefix(ctx, "user\x00", idx, map[string]any{
+			"name": "a",
+		})
+		assert.Len(t, bytes.Split(pfx.Seek("1").Path(), nullByte), 7)
+		assert.True(t, bytes.HasPrefix(pfx.Path(), indexPrefix(ctx, "user\x00", idx.Name)))
+		assert.True(t, bytes.HasPrefix(pfx.Path(), collectionPrefix(ctx, "user\x00")))
+		assert.False(t, bytes.HasPrefix(pfx.Path(), collectionPrefix(ctx, "user")))
+		// a prefix for the value "a" must not match documents with the value "ab"
+		assert.False(t, bytes.HasPrefix(seekPrefix(ctx, "user\x00", idx, map[string]any{
+			"name": "ab",
+		}).Seek("1").Path(), pfx.Path()))
+		assert.True(t, bytes.HasPrefix(pfx.Seek("1").Path(), pfx.Path()))
+	})
 }
@@ -0,0 +1,165 @@
+package myjson
+
+import (
+	"context"
+	"sort"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/samber/lo"
+)
+
+func (t *transaction) QueryIter(ctx context.Context, collection string, query Query) (DocumentIterator, error) {
+	if len(query.Select) == 0 {
+		query.Select = append(query.Select, Select{Field: "*"})
+	}
+	if err := query.Validate(ctx); err != nil {
+		return nil, err
+	}
+	schema, ctx := t.db.getSchema(ctx, collection)
+	if schema == nil {
+		return nil, errors.New(errors.Validation, "tx: unsupported collection: %s", collection)
+	}
+	allow, err := t.authorizeQuery(ctx, schema, &query)
+	if err != nil {
+		return nil, err
+	}
+	if !allow {
+		return nil, errors.New(errors.Forbidden, "not authorized: %s/%s", collection, QueryAction)
+	}
+	if query.Cursor != "" {
+		return nil, errors.New(errors.Validation, "cursors are not supported by query iterators")
+	}
+	if isAggregateQuery(query) {
+		page, err := t.aggregate(ctx, collection, query)
+		if err != nil {
+			return nil, err
+		}
+		return &documentsIterator{documents: page.Documents}, nil
+	}
+	explain, err := t.db.optimizer.Optimize(schema, query.Where)
+	if err != nil {
+		return nil, err
+	}
+	if reverse, ok := indexOrder(explain, query.OrderBy); ok {
+		explain.Reverse = reverse
+		return &scanIterator{
+			scanner: t.newQueryScanner(ctx, schema, explain, query.Where, query.Join, nil),
+			selects: query.Select,
+			skip:    query.Limit * query.Page,
+			limit:   query.Limit,
+		}, nil
+	}
+	scanner := t.newQueryScanner(ctx, schema, explain, query.Where, query.Join, nil)
+	defer scanner.close()
+	var (
+		// the primary key breaks ties so that the same documents are kept regardless of the order they were scanned in
+		results = &documentHeap{c: schema, orderBy: cursorOrderBy(schema, query.OrderBy)}
+		// size is the number of documents up to the end of the page
+		size = query.Limit * (query.Page + 1)
+	)
+	for {
+		scanned, ok, err := scanner.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		results.keep(scanned.doc, size)
+	}
+	documents := results.documents
+	sort.Slice(documents, func(i, j int) bool {
+		return compareDocs(schema, documents[i], documents[j], results.orderBy) < 0
+	})
+	return &documentsIterator{
+		documents: lo.Slice(documents, query.Limit*query.Page, len(documents)),
+		selects:   query.Select,
+	}, nil
+}
+
+// scanIterator streams documents from a scan - it is used when the index returns documents in the order of the query
+type scanIterator struct {
+	scanner *queryScanner
+	selects []Select
+	// skip is the number of documents before the page
+	skip int
+	// limit is the maximum number of documents to return (0 if unlimited)
+	limit int
+	count int
+	doc   *Document
+	err   error
+}
+
+func (s *scanIterator) Next() bool {
+	s.doc = nil
+	if s.err != nil || s.limit > 0 && s.count >= s.limit {
+		s.scanner.close()
+		return false
+	}
+	for {
+		scanned, ok, err := s.scanner.next()
+		if err != nil || !ok {
+			s.err = err
+			s.scanner.close()
+			return false
+		}
+		if s.skip > 0 {
+			s.skip--
+			continue
+		}
+		if err := selectDocument(scanned.doc, s.selects); err != nil {
+			s.err = err
+			s.scanner.close()
+			return false
+		}
+		s.doc = scanned.doc
+		s.count++
+		return true
+	}
+}
+
+func (s *scanIterator) Doc() *Document {
+	return s.doc
+}
+
+func (s *scanIterator) Err() error {
+	return s.err
+}
+
+func (s *scanIterator) Close() {
+	s.scanner.close()
+}
+
+// documentsIterator iterates over documents that are held in memory
+type documentsIterator struct {
+	documents Documents
+	selects   []Select
+	doc       *Document
+	err       error
+}
+
+func (d *documentsIterator) Next() bool {
+	d.doc = nil
+	if d.err != nil || len(d.documents) == 0 {
+		return false
+	}
+	d.doc, d.documents = d.documents[0], d.documents[1:]
+	if err := selectDocument(d.doc, d.selects); err != nil {
+		d.doc = nil
+		d.err = err
+		return false
+	}
+	return true
+}
+
+func (d *documentsIterator) Doc() *Document {
+	return d.doc
+}
+
+func (d *documentsIterator) Err() error {
+	return d.err
+}
+
+func (d *documentsIterator) Close() {
+	d.documents = nil
+}
@@ -8,9 +8,9 @@ import (
 	"github.com/autom8ter/machine/v4"
 	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
 	"github.com/autom8ter/myjson/kv/registry"
 	"github.com/dgraph-io/badger/v3"
-	"github.com/segmentio/ksuid"
 	"github.com/spf13/cast"
 )
 
@@ -65,6 +65,7 @@ func (b *badgerKV) NewTx(opts kv.TxOpts) (kv.Tx, error) {
 		return &badgerTx{
 			opts:    opts,
 			batch:   b.db.NewWriteBatch(),
+			pending: kvutil.NewOverlay(),
 			db:      b,
 			machine: b.machine,
 		}, nil
@@ -90,14 +91,7 @@ func (b *badgerKV) DropPrefix(ctx context.Context, prefix ...[]byte) error {
 }
 
 func (b *badgerKV) NewLocker(key []byte, leaseInterval time.Duration) (kv.Locker, error) {
-	return &badgerLock{
-		id:            ksuid.New().String(),
-		key:           key,
-		db:            b,
-		leaseInterval: leaseInterval,
-		unlock:        make(chan struct{}),
-		hasUnlocked:   make(chan struct{}),
-	}, nil
+	return kvutil.NewLocker(b, key, leaseInterval), nil
 }
 
 func (b *badgerKV) ChangeStream(ctx context.Context, prefix []byte, fn kv.ChangeStreamHandler) error {
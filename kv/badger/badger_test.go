@@ -9,7 +9,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvtest"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 )
@@ -237,7 +239,24 @@ func Test(t *testing.T) {
 		}))
 		assert.Equal(t, 0, count)
 	})
-
+	t.Run("conflict", func(t *testing.T) {
+		ctx := context.Background()
+		tx1, err := db.NewTx(kv.TxOpts{})
+		assert.NoError(t, err)
+		defer tx1.Close(ctx)
+		tx2, err := db.NewTx(kv.TxOpts{})
+		assert.NoError(t, err)
+		defer tx2.Close(ctx)
+		// badger detects conflicts between a transaction's reads & the writes committed after it began
+		_, err = tx2.Get(ctx, []byte("conflict"))
+		assert.NoError(t, err)
+		assert.NoError(t, tx1.Set(ctx, []byte("conflict"), []byte("1")))
+		assert.NoError(t, tx2.Set(ctx, []byte("conflict"), []byte("2")))
+		assert.NoError(t, tx1.Commit(ctx))
+		err = tx2.Commit(ctx)
+		assert.Error(t, err)
+		assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+	})
 }
 
 func TestChangeStream(t *testing.T) {
@@ -270,3 +289,11 @@ func TestChangeStream(t *testing.T) {
 		assert.Equal(t, int64(len(data)), *count)
 	})
 }
+
+func TestConformance(t *testing.T) {
+	kvtest.RunConformance(t, func(t *testing.T) kv.DB {
+		db, err := open("")
+		assert.NoError(t, err)
+		return db
+	})
+}
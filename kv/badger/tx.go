@@ -1,11 +1,14 @@
 package badger
 
 import (
+	"bytes"
 	"context"
 	"sync"
 
 	"github.com/autom8ter/machine/v4"
+	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
 	"github.com/dgraph-io/badger/v3"
 )
 
@@ -17,6 +20,8 @@ type badgerTx struct {
 	db      *badgerKV
 	machine machine.Machine
 	entries []kv.CDC
+	// pending holds the buffered writes of a batch transaction so that the transaction can read its own writes
+	pending *kvutil.Overlay
 }
 
 func (b *badgerTx) NewIterator(kopts kv.IterOpts) (kv.Iterator, error) {
@@ -26,20 +31,49 @@ func (b *badgerTx) NewIterator(kopts kv.IterOpts) (kv.Iterator, error) {
 	opts := badger.DefaultIteratorOptions
 	opts.PrefetchValues = true
 	opts.PrefetchSize = 10
-	opts.Prefix = kopts.Prefix
 	opts.Reverse = kopts.Reverse
-	if kopts.Seek == nil && kopts.UpperBound != nil && kopts.Reverse {
-		kopts.Seek = kopts.UpperBound
+	seek := kopts.Seek
+	if kopts.Reverse {
+		// reverse iterators seek to the last key <= the seek key, which is usually outside of the prefix - the prefix is
+		// enforced by the iterator instead of badger
+		if seek == nil {
+			seek = kopts.UpperBound
+			if next := kvutil.NextPrefix(kopts.Prefix); len(next) > 0 && (seek == nil || bytes.Compare(seek, next) > 0) {
+				seek = next
+			}
+		}
+	} else {
+		opts.Prefix = kopts.Prefix
 	}
 	iter := b.txn.NewIterator(opts)
-	if kopts.Seek == nil {
+	if seek == nil {
 		iter.Rewind()
+	} else {
+		iter.Seek(seek)
+	}
+	if kopts.Reverse && len(kopts.Prefix) > 0 {
+		// skip keys greater than the prefix that don't share it
+		for iter.Valid() && !bytes.HasPrefix(iter.Item().Key(), kopts.Prefix) && bytes.Compare(iter.Item().Key(), kopts.Prefix) > 0 {
+			iter.Next()
+		}
+	}
+	if b.pending != nil {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.pending.NewIterator(&badgerIterator{iter: iter, opts: kopts}, kopts)
 	}
-	iter.Seek(kopts.Seek)
 	return &badgerIterator{iter: iter, opts: kopts}, nil
 }
 
 func (b *badgerTx) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if b.pending != nil {
+		b.mu.Lock()
+		val, ok := b.pending.Get(key)
+		b.mu.Unlock()
+		if ok {
+			return val, nil
+		}
+	}
 	if b.txn == nil {
 		b.txn = b.db.db.NewTransaction(!b.opts.IsReadOnly)
 	}
@@ -54,6 +88,36 @@ func (b *badgerTx) Get(ctx context.Context, key []byte) ([]byte, error) {
 	return val, err
 }
 
+func (b *badgerTx) MultiGet(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	if b.txn == nil {
+		b.txn = b.db.db.NewTransaction(!b.opts.IsReadOnly)
+	}
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		if b.pending != nil {
+			b.mu.Lock()
+			val, ok := b.pending.Get(key)
+			b.mu.Unlock()
+			if ok {
+				values[i] = val
+				continue
+			}
+		}
+		item, err := b.txn.Get(key)
+		if err != nil {
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			return nil, err
+		}
+		values[i], err = item.ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
 func (b *badgerTx) Set(ctx context.Context, key, value []byte) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -65,6 +129,7 @@ func (b *badgerTx) Set(ctx context.Context, key, value []byte) error {
 		if err := b.batch.SetEntry(e); err != nil {
 			return err
 		}
+		b.pending.Set(key, value)
 	} else if b.txn != nil {
 		if err := b.txn.SetEntry(e); err != nil {
 			return err
@@ -86,7 +151,11 @@ func (b *badgerTx) Delete(ctx context.Context, key []byte) error {
 		Key:       key,
 	})
 	if b.batch != nil {
-		return b.batch.Delete(key)
+		if err := b.batch.Delete(key); err != nil {
+			return err
+		}
+		b.pending.Delete(key)
+		return nil
 	}
 	return b.txn.Delete(key)
 }
@@ -96,6 +165,7 @@ func (b *badgerTx) Rollback(ctx context.Context) error {
 	defer b.mu.Unlock()
 	if b.batch != nil {
 		b.batch.Cancel()
+		b.pending.Clear()
 	}
 	if b.txn != nil {
 		b.txn.Discard()
@@ -113,6 +183,9 @@ func (b *badgerTx) Commit(ctx context.Context) error {
 		}
 	} else if b.txn != nil {
 		if err := b.txn.Commit(); err != nil {
+			if err == badger.ErrConflict {
+				return errors.Wrap(err, errors.Conflict, "badger: transaction conflict")
+			}
 			return err
 		}
 	}
@@ -0,0 +1,142 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/autom8ter/machine/v4"
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
+	"github.com/autom8ter/myjson/kv/registry"
+	"github.com/spf13/cast"
+	bolt "go.etcd.io/bbolt"
+)
+
+func init() {
+	registry.Register("bolt", func(params map[string]interface{}) (kv.DB, error) {
+		return open(params)
+	})
+}
+
+// bucket is the single bucket all keys are stored in
+var bucket = []byte("myjson")
+
+type boltKV struct {
+	db      *bolt.DB
+	machine machine.Machine
+}
+
+// open opens a bolt database. The following params are supported:
+// storage_path - the path to the database file (required)
+// mmap_size - the initial size of the memory map in bytes
+// no_sync - skip fsync after every commit (unsafe)
+func open(params map[string]interface{}) (kv.DB, error) {
+	storagePath := cast.ToString(params["storage_path"])
+	if storagePath == "" {
+		return nil, errors.New(errors.Validation, "bolt: storage_path is required")
+	}
+	opts := &bolt.Options{
+		Timeout:         5 * time.Second,
+		InitialMmapSize: cast.ToInt(params["mmap_size"]),
+		NoSync:          cast.ToBool(params["no_sync"]),
+	}
+	db, err := bolt.Open(storagePath, 0600, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	}); err != nil {
+		//nolint:errcheck
+		db.Close()
+		return nil, err
+	}
+	return &boltKV{
+		db:      db,
+		machine: machine.New(),
+	}, nil
+}
+
+func (b *boltKV) Tx(opts kv.TxOpts, fn func(kv.Tx) error) error {
+	tx, err := b.NewTx(opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Close(context.Background())
+	err = fn(tx)
+	if err != nil {
+		//nolint:errcheck
+		tx.Rollback(context.Background())
+		return err
+	}
+	if err := tx.Commit(context.Background()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (b *boltKV) NewTx(opts kv.TxOpts) (kv.Tx, error) {
+	if opts.IsBatch && !opts.IsReadOnly {
+		// batch transactions buffer their writes & apply them with db.Batch on commit so that concurrent batches
+		// may be coalesced into a single bolt transaction
+		return &boltTx{
+			opts:    opts,
+			db:      b,
+			pending: kvutil.NewOverlay(),
+		}, nil
+	}
+	tx, err := b.db.Begin(!opts.IsReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &boltTx{
+		opts: opts,
+		db:   b,
+		tx:   tx,
+	}, nil
+}
+
+func (b *boltKV) Close(ctx context.Context) error {
+	b.machine.Close()
+	return b.db.Close()
+}
+
+func (b *boltKV) DropPrefix(ctx context.Context, prefix ...[]byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(bucket)
+		for _, pfx := range prefix {
+			// deleting while iterating with a cursor skips keys - collect the keys first
+			var keys [][]byte
+			c := bkt.Cursor()
+			for k, _ := c.Seek(pfx); k != nil && bytes.HasPrefix(k, pfx); k, _ = c.Next() {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			for _, k := range keys {
+				if err := bkt.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltKV) NewLocker(key []byte, leaseInterval time.Duration) (kv.Locker, error) {
+	return kvutil.NewLocker(b, key, leaseInterval), nil
+}
+
+func (b *boltKV) ChangeStream(ctx context.Context, prefix []byte, fn kv.ChangeStreamHandler) error {
+	return b.machine.Subscribe(ctx, "*", func(ctx context.Context, msg machine.Message) (bool, error) {
+		cdc, ok := msg.Body.(kv.CDC)
+		if !ok {
+			return false, errors.New(errors.Internal, "invalid cdc")
+		}
+		if bytes.HasPrefix(cdc.Key, prefix) {
+			return fn(cdc)
+		}
+		return true, nil
+	})
+}
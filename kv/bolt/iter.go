@@ -0,0 +1,133 @@
+package bolt
+
+import (
+	"bytes"
+
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltIterator struct {
+	tx *bolt.Tx
+	// ownsTx is true if the iterator opened the transaction & must close it
+	ownsTx bool
+	cursor *bolt.Cursor
+	opts   kv.IterOpts
+	key    []byte
+	value  []byte
+}
+
+func newIterator(tx *bolt.Tx, ownsTx bool, opts kv.IterOpts) *boltIterator {
+	i := &boltIterator{
+		tx:     tx,
+		ownsTx: ownsTx,
+		cursor: tx.Bucket(bucket).Cursor(),
+		opts:   opts,
+	}
+	switch {
+	case opts.Seek != nil:
+		i.Seek(opts.Seek)
+	case opts.Reverse:
+		next := kvutil.NextPrefix(opts.Prefix)
+		switch {
+		case len(opts.Prefix) > 0 && len(next) > 0 && (opts.UpperBound == nil || bytes.Compare(opts.UpperBound, next) >= 0):
+			i.seekLT(next)
+		case opts.UpperBound != nil:
+			i.seekLE(opts.UpperBound)
+		default:
+			i.set(i.cursor.Last())
+		}
+	default:
+		i.set(i.cursor.Seek(opts.Prefix))
+	}
+	return i
+}
+
+func (i *boltIterator) set(k, v []byte) {
+	if k == nil {
+		i.key, i.value = nil, nil
+		return
+	}
+	i.key = append([]byte{}, k...)
+	i.value = append([]byte{}, v...)
+}
+
+// seekLE positions the cursor on the last key less than or equal to the given key
+func (i *boltIterator) seekLE(key []byte) {
+	k, v := i.cursor.Seek(key)
+	switch {
+	case k == nil:
+		k, v = i.cursor.Last()
+	case !bytes.Equal(k, key):
+		k, v = i.cursor.Prev()
+	}
+	i.set(k, v)
+}
+
+// seekLT positions the cursor on the last key less than the given key
+func (i *boltIterator) seekLT(key []byte) {
+	k, v := i.cursor.Seek(key)
+	if k == nil {
+		k, v = i.cursor.Last()
+	} else {
+		k, v = i.cursor.Prev()
+	}
+	i.set(k, v)
+}
+
+func (i *boltIterator) Seek(key []byte) {
+	if i.opts.Reverse {
+		i.seekLE(key)
+		return
+	}
+	i.set(i.cursor.Seek(key))
+}
+
+func (i *boltIterator) Close() {
+	if i.ownsTx && i.tx != nil {
+		//nolint:errcheck
+		i.tx.Rollback()
+	}
+	i.tx = nil
+	i.key, i.value = nil, nil
+}
+
+func (i *boltIterator) Valid() bool {
+	if i.key == nil {
+		return false
+	}
+	if !bytes.HasPrefix(i.key, i.opts.Prefix) {
+		return false
+	}
+	if i.opts.UpperBound != nil && bytes.Compare(i.key, i.opts.UpperBound) > 0 {
+		return false
+	}
+	return true
+}
+
+func (i *boltIterator) Key() []byte {
+	return i.key
+}
+
+func (i *boltIterator) Value() ([]byte, error) {
+	return i.value, nil
+}
+
+func (i *boltIterator) Next() error {
+	if i.key == nil {
+		return nil
+	}
+	// bolt cursors are invalidated when the bucket is modified - reposition the cursor on the current key
+	// before moving so writes made while iterating are safe
+	if i.opts.Reverse {
+		i.seekLT(i.key)
+		return nil
+	}
+	k, v := i.cursor.Seek(i.key)
+	if k != nil && bytes.Equal(k, i.key) {
+		k, v = i.cursor.Next()
+	}
+	i.set(k, v)
+	return nil
+}
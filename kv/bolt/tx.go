@@ -0,0 +1,228 @@
+package bolt
+
+import (
+	"context"
+	"sync"
+
+	"github.com/autom8ter/machine/v4"
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltTx struct {
+	mu   sync.Mutex
+	opts kv.TxOpts
+	db   *boltKV
+	// tx is the underlying bolt transaction - it is nil for batch transactions
+	tx *bolt.Tx
+	// pending holds the buffered writes of a batch transaction so that the transaction can read its own writes
+	pending *kvutil.Overlay
+	entries []kv.CDC
+	done    bool
+}
+
+func (b *boltTx) NewIterator(opts kv.IterOpts) (kv.Iterator, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return nil, errors.New(errors.Internal, "bolt: transaction has already been committed or rolled back")
+	}
+	if b.tx != nil {
+		return newIterator(b.tx, false, opts), nil
+	}
+	// batch transactions merge their pending writes into an iterator over committed data with a dedicated read transaction
+	tx, err := b.db.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	return b.pending.NewIterator(newIterator(tx, true, opts), opts)
+}
+
+func (b *boltTx) Get(ctx context.Context, key []byte) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return nil, errors.New(errors.Internal, "bolt: transaction has already been committed or rolled back")
+	}
+	if b.tx != nil {
+		return get(b.tx, key), nil
+	}
+	if val, ok := b.pending.Get(key); ok {
+		return val, nil
+	}
+	var val []byte
+	if err := b.db.db.View(func(tx *bolt.Tx) error {
+		val = get(tx, key)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// MultiGet reads every key that isn't pending in a single read transaction
+func (b *boltTx) MultiGet(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return nil, errors.New(errors.Internal, "bolt: transaction has already been committed or rolled back")
+	}
+	values := make([][]byte, len(keys))
+	read := func(tx *bolt.Tx) error {
+		for i, key := range keys {
+			if b.tx == nil {
+				if val, ok := b.pending.Get(key); ok {
+					values[i] = val
+					continue
+				}
+			}
+			values[i] = get(tx, key)
+		}
+		return nil
+	}
+	if b.tx != nil {
+		//nolint:errcheck
+		read(b.tx)
+		return values, nil
+	}
+	if err := b.db.db.View(read); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// get copies the value of the key out of the transaction since bolt values are only valid for the life of the transaction
+func get(tx *bolt.Tx, key []byte) []byte {
+	val := tx.Bucket(bucket).Get(key)
+	if val == nil {
+		return nil
+	}
+	return append([]byte{}, val...)
+}
+
+func (b *boltTx) Set(ctx context.Context, key, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.writable(); err != nil {
+		return err
+	}
+	e := kv.CDC{
+		Operation: kv.SETOP,
+		Key:       append([]byte{}, key...),
+		Value:     append([]byte{}, value...),
+	}
+	if b.tx != nil {
+		if err := b.tx.Bucket(bucket).Put(e.Key, e.Value); err != nil {
+			return err
+		}
+	} else {
+		b.pending.Set(e.Key, e.Value)
+	}
+	b.entries = append(b.entries, e)
+	return nil
+}
+
+func (b *boltTx) Delete(ctx context.Context, key []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.writable(); err != nil {
+		return err
+	}
+	e := kv.CDC{
+		Operation: kv.DELOP,
+		Key:       append([]byte{}, key...),
+	}
+	if b.tx != nil {
+		if err := b.tx.Bucket(bucket).Delete(e.Key); err != nil {
+			return err
+		}
+	} else {
+		b.pending.Delete(e.Key)
+	}
+	b.entries = append(b.entries, e)
+	return nil
+}
+
+func (b *boltTx) writable() error {
+	if b.done {
+		return errors.New(errors.Internal, "bolt: transaction has already been committed or rolled back")
+	}
+	if b.opts.IsReadOnly {
+		return errors.New(errors.Forbidden, "bolt: writes forbidden in read-only transaction")
+	}
+	return nil
+}
+
+func (b *boltTx) Rollback(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.close()
+	return nil
+}
+
+func (b *boltTx) Commit(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return errors.New(errors.Internal, "bolt: transaction has already been committed or rolled back")
+	}
+	entries := b.entries
+	switch {
+	case b.tx == nil:
+		if len(entries) > 0 {
+			if err := b.db.db.Batch(func(tx *bolt.Tx) error {
+				bkt := tx.Bucket(bucket)
+				for _, e := range entries {
+					switch e.Operation {
+					case kv.SETOP:
+						if err := bkt.Put(e.Key, e.Value); err != nil {
+							return err
+						}
+					case kv.DELOP:
+						if err := bkt.Delete(e.Key); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			}); err != nil {
+				b.close()
+				return err
+			}
+		}
+	case b.tx.Writable():
+		b.done = true
+		if err := b.tx.Commit(); err != nil {
+			return err
+		}
+	}
+	b.close()
+	for _, e := range entries {
+		b.db.machine.Publish(ctx, machine.Message{
+			Channel: string(e.Key),
+			Body:    e,
+		})
+	}
+	return nil
+}
+
+func (b *boltTx) Close(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.close()
+}
+
+func (b *boltTx) close() {
+	b.entries = nil
+	b.pending = nil
+	if b.done {
+		return
+	}
+	b.done = true
+	if b.tx != nil {
+		//nolint:errcheck
+		b.tx.Rollback()
+	}
+}
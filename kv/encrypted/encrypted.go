@@ -0,0 +1,169 @@
+// Package encrypted provides a kv.DB wrapper that encrypts values at rest with AES-GCM. Keys are stored in plaintext so that
+// iteration order is unchanged.
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/registry"
+	"github.com/spf13/cast"
+)
+
+func init() {
+	registry.RegisterWrapper("encrypted", func(db kv.DB, params map[string]interface{}) (kv.DB, error) {
+		keys := map[string][]byte{}
+		for id, key := range cast.ToStringMapString(params["encryption_keys"]) {
+			decoded, err := base64.StdEncoding.DecodeString(key)
+			if err != nil {
+				return nil, errors.Wrap(err, errors.Validation, "encrypted: encryption key %s must be base64 encoded", id)
+			}
+			keys[id] = decoded
+		}
+		provider, err := NewStaticKeyProvider(cast.ToString(params["encryption_active_key"]), keys)
+		if err != nil {
+			return nil, err
+		}
+		return New(db, provider), nil
+	})
+}
+
+// header is prepended to every encrypted value. It is followed by a version byte, the key id length, the key id, the nonce,
+// and the ciphertext
+var header = []byte("\x00mjenc")
+
+const version byte = 1
+
+type encryptedDB struct {
+	db    kv.DB
+	keys  KeyProvider
+	aeads sync.Map
+}
+
+// New wraps the kv database so that values are encrypted with the key provider's active key before they are written & decrypted
+// after they are read. Values that were written without encryption are returned as is.
+func New(db kv.DB, keys KeyProvider) kv.DB {
+	return &encryptedDB{
+		db:   db,
+		keys: keys,
+	}
+}
+
+func (e *encryptedDB) aead(id string, key []byte) (cipher.AEAD, error) {
+	if a, ok := e.aeads.Load(id); ok {
+		return a.(cipher.AEAD), nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.Internal, "encrypted: invalid key %s", id)
+	}
+	a, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.Internal, "encrypted: invalid key %s", id)
+	}
+	e.aeads.Store(id, a)
+	return a, nil
+}
+
+// encrypt encrypts the value with the active key. The key is used as additional data so that values cannot be moved between keys
+func (e *encryptedDB) encrypt(key, value []byte) ([]byte, error) {
+	id, k, err := e.keys.ActiveKey()
+	if err != nil {
+		return nil, errors.Wrap(err, errors.Internal, "encrypted: failed to get active key")
+	}
+	a, err := e.aead(id, k)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(header)+2+len(id)+a.NonceSize()+len(value)+a.Overhead())
+	out = append(out, header...)
+	out = append(out, version, byte(len(id)))
+	out = append(out, id...)
+	nonce := make([]byte, a.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, errors.Internal, "encrypted: failed to generate nonce")
+	}
+	out = append(out, nonce...)
+	return a.Seal(out, nonce, value, key), nil
+}
+
+// decrypt decrypts the value with the key it was encrypted with. Values without an encryption header are returned as is
+func (e *encryptedDB) decrypt(key, value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, header) {
+		return value, nil
+	}
+	rest := value[len(header):]
+	if len(rest) < 2 || rest[0] != version {
+		return nil, errors.New(errors.Internal, "encrypted: unsupported value header")
+	}
+	idLen := int(rest[1])
+	rest = rest[2:]
+	if len(rest) < idLen {
+		return nil, errors.New(errors.Internal, "encrypted: corrupt value header")
+	}
+	id := string(rest[:idLen])
+	rest = rest[idLen:]
+	k, err := e.keys.Key(id)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.Internal, "encrypted: failed to get key %s", id)
+	}
+	a, err := e.aead(id, k)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < a.NonceSize() {
+		return nil, errors.New(errors.Internal, "encrypted: corrupt value header")
+	}
+	plaintext, err := a.Open(nil, rest[:a.NonceSize()], rest[a.NonceSize():], key)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.Internal, "encrypted: failed to decrypt value")
+	}
+	return plaintext, nil
+}
+
+func (e *encryptedDB) Tx(opts kv.TxOpts, fn func(kv.Tx) error) error {
+	return e.db.Tx(opts, func(tx kv.Tx) error {
+		return fn(&encryptedTx{tx: tx, db: e})
+	})
+}
+
+func (e *encryptedDB) NewTx(opts kv.TxOpts) (kv.Tx, error) {
+	tx, err := e.db.NewTx(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedTx{tx: tx, db: e}, nil
+}
+
+func (e *encryptedDB) NewLocker(key []byte, leaseInterval time.Duration) (kv.Locker, error) {
+	return e.db.NewLocker(key, leaseInterval)
+}
+
+func (e *encryptedDB) DropPrefix(ctx context.Context, prefix ...[]byte) error {
+	return e.db.DropPrefix(ctx, prefix...)
+}
+
+func (e *encryptedDB) ChangeStream(ctx context.Context, prefix []byte, fn kv.ChangeStreamHandler) error {
+	return e.db.ChangeStream(ctx, prefix, func(cdc kv.CDC) (bool, error) {
+		if cdc.Value != nil {
+			value, err := e.decrypt(cdc.Key, cdc.Value)
+			if err != nil {
+				return false, err
+			}
+			cdc.Value = value
+		}
+		return fn(cdc)
+	})
+}
+
+func (e *encryptedDB) Close(ctx context.Context) error {
+	return e.db.Close(ctx)
+}
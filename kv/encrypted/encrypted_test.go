@@ -0,0 +1,155 @@
+package encrypted_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/encrypted"
+	"github.com/autom8ter/myjson/kv/kvtest"
+	_ "github.com/autom8ter/myjson/kv/memory"
+	"github.com/autom8ter/myjson/kv/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	key1 = bytes.Repeat([]byte("1"), 32)
+	key2 = bytes.Repeat([]byte("2"), 16)
+)
+
+func open(t *testing.T, active string) (kv.DB, kv.DB) {
+	inner, err := registry.Open("memory", map[string]interface{}{})
+	assert.NoError(t, err)
+	keys, err := encrypted.NewStaticKeyProvider(active, map[string][]byte{
+		"1": key1,
+		"2": key2,
+	})
+	assert.NoError(t, err)
+	return encrypted.New(inner, keys), inner
+}
+
+func TestConformance(t *testing.T) {
+	kvtest.RunConformance(t, func(t *testing.T) kv.DB {
+		db, _ := open(t, "1")
+		return db
+	})
+}
+
+func TestEncrypted(t *testing.T) {
+	ctx := context.Background()
+	db, inner := open(t, "1")
+	t.Run("values are encrypted at rest", func(t *testing.T) {
+		assert.NoError(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			return tx.Set(ctx, []byte("hello"), []byte("world"))
+		}))
+		assert.NoError(t, inner.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			value, err := tx.Get(ctx, []byte("hello"))
+			assert.NoError(t, err)
+			assert.NotContains(t, string(value), "world")
+			return nil
+		}))
+		assert.NoError(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			value, err := tx.Get(ctx, []byte("hello"))
+			assert.NoError(t, err)
+			assert.Equal(t, "world", string(value))
+			return nil
+		}))
+	})
+	t.Run("plaintext values pass through", func(t *testing.T) {
+		assert.NoError(t, inner.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			return tx.Set(ctx, []byte("plain"), []byte("text"))
+		}))
+		assert.NoError(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			value, err := tx.Get(ctx, []byte("plain"))
+			assert.NoError(t, err)
+			assert.Equal(t, "text", string(value))
+			return nil
+		}))
+	})
+	t.Run("ciphertext is bound to its key", func(t *testing.T) {
+		assert.NoError(t, inner.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			value, err := tx.Get(ctx, []byte("hello"))
+			assert.NoError(t, err)
+			return tx.Set(ctx, []byte("moved"), value)
+		}))
+		assert.NoError(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			_, err := tx.Get(ctx, []byte("moved"))
+			assert.Error(t, err)
+			return nil
+		}))
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	db, inner := open(t, "1")
+	assert.NoError(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		return tx.Set(ctx, []byte("a"), []byte("1"))
+	}))
+	keys, err := encrypted.NewStaticKeyProvider("2", map[string][]byte{
+		"1": key1,
+		"2": key2,
+	})
+	assert.NoError(t, err)
+	rotated := encrypted.New(inner, keys)
+	assert.NoError(t, rotated.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		return tx.Set(ctx, []byte("b"), []byte("2"))
+	}))
+	assert.NoError(t, rotated.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		iter, err := tx.NewIterator(kv.IterOpts{})
+		assert.NoError(t, err)
+		defer iter.Close()
+		var values []string
+		for iter.Valid() {
+			value, err := iter.Value()
+			assert.NoError(t, err)
+			values = append(values, string(value))
+			assert.NoError(t, iter.Next())
+		}
+		assert.Equal(t, []string{"1", "2"}, values)
+		return nil
+	}))
+	t.Run("missing key", func(t *testing.T) {
+		keys, err := encrypted.NewStaticKeyProvider("1", map[string][]byte{
+			"1": key1,
+		})
+		assert.NoError(t, err)
+		assert.Error(t, encrypted.New(inner, keys).Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			_, err := tx.Get(ctx, []byte("b"))
+			return err
+		}))
+	})
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := encrypted.NewStaticKeyProvider("1", map[string][]byte{
+			"1": []byte("short"),
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	db, err := registry.Open("encrypted+memory", map[string]interface{}{
+		"encryption_active_key": "1",
+		"encryption_keys": map[string]interface{}{
+			"1": base64.StdEncoding.EncodeToString(key1),
+		},
+	})
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+	assert.NoError(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		return tx.Set(ctx, []byte("hello"), []byte("world"))
+	}))
+	assert.NoError(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		value, err := tx.Get(ctx, []byte("hello"))
+		assert.NoError(t, err)
+		assert.Equal(t, "world", string(value))
+		return nil
+	}))
+	_, err = registry.Open("missing+memory", map[string]interface{}{})
+	assert.Error(t, err)
+	_, err = registry.Open("encrypted+memory", map[string]interface{}{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,38 @@
+package encrypted
+
+import (
+	"github.com/autom8ter/myjson/kv"
+)
+
+type encryptedIterator struct {
+	iter kv.Iterator
+	db   *encryptedDB
+}
+
+func (e *encryptedIterator) Seek(key []byte) {
+	e.iter.Seek(key)
+}
+
+func (e *encryptedIterator) Close() {
+	e.iter.Close()
+}
+
+func (e *encryptedIterator) Valid() bool {
+	return e.iter.Valid()
+}
+
+func (e *encryptedIterator) Key() []byte {
+	return e.iter.Key()
+}
+
+func (e *encryptedIterator) Value() ([]byte, error) {
+	value, err := e.iter.Value()
+	if err != nil || value == nil {
+		return value, err
+	}
+	return e.db.decrypt(e.iter.Key(), value)
+}
+
+func (e *encryptedIterator) Next() error {
+	return e.iter.Next()
+}
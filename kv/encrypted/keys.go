@@ -0,0 +1,53 @@
+package encrypted
+
+import (
+	"github.com/autom8ter/myjson/errors"
+)
+
+// KeyProvider provides the AES keys used to encrypt & decrypt values. Keys are identified by an id that is stored in the header of every
+// encrypted value so that keys can be rotated without re-encrypting existing values
+type KeyProvider interface {
+	// ActiveKey returns the id & value of the key that new values should be encrypted with
+	ActiveKey() (string, []byte, error)
+	// Key returns the key with the given id
+	Key(id string) ([]byte, error)
+}
+
+type staticKeyProvider struct {
+	active string
+	keys   map[string][]byte
+}
+
+// NewStaticKeyProvider returns a KeyProvider backed by a static map of key ids to AES-128/192/256 keys. New values are encrypted with
+// the active key - the remaining keys are used to decrypt values that were encrypted before the active key was rotated
+func NewStaticKeyProvider(active string, keys map[string][]byte) (KeyProvider, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, errors.New(errors.Validation, "encrypted: active key %s does not exist", active)
+	}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, errors.New(errors.Validation, "encrypted: key ids must be between 1 and 255 bytes")
+		}
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return nil, errors.New(errors.Validation, "encrypted: key %s must be 16, 24, or 32 bytes", id)
+		}
+	}
+	return &staticKeyProvider{
+		active: active,
+		keys:   keys,
+	}, nil
+}
+
+func (s *staticKeyProvider) ActiveKey() (string, []byte, error) {
+	return s.active, s.keys[s.active], nil
+}
+
+func (s *staticKeyProvider) Key(id string) ([]byte, error) {
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, errors.New(errors.NotFound, "encrypted: key %s does not exist", id)
+	}
+	return key, nil
+}
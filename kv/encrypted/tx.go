@@ -0,0 +1,69 @@
+package encrypted
+
+import (
+	"context"
+
+	"github.com/autom8ter/myjson/kv"
+)
+
+type encryptedTx struct {
+	tx kv.Tx
+	db *encryptedDB
+}
+
+func (e *encryptedTx) Get(ctx context.Context, key []byte) ([]byte, error) {
+	value, err := e.tx.Get(ctx, key)
+	if err != nil || value == nil {
+		return value, err
+	}
+	return e.db.decrypt(key, value)
+}
+
+func (e *encryptedTx) MultiGet(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	values, err := e.tx.MultiGet(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		values[i], err = e.db.decrypt(keys[i], value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (e *encryptedTx) Set(ctx context.Context, key, value []byte) error {
+	encrypted, err := e.db.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return e.tx.Set(ctx, key, encrypted)
+}
+
+func (e *encryptedTx) Delete(ctx context.Context, key []byte) error {
+	return e.tx.Delete(ctx, key)
+}
+
+func (e *encryptedTx) NewIterator(opts kv.IterOpts) (kv.Iterator, error) {
+	iter, err := e.tx.NewIterator(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedIterator{iter: iter, db: e.db}, nil
+}
+
+func (e *encryptedTx) Commit(ctx context.Context) error {
+	return e.tx.Commit(ctx)
+}
+
+func (e *encryptedTx) Rollback(ctx context.Context) error {
+	return e.tx.Rollback(ctx)
+}
+
+func (e *encryptedTx) Close(ctx context.Context) {
+	e.tx.Close(ctx)
+}
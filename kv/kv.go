@@ -42,6 +42,8 @@ type TxOpts struct {
 type Tx interface {
 	// Getter gets the specified key in the database(if it exists)
 	Getter
+	// MultiGetter gets the specified keys in the database in a single batch
+	MultiGetter
 	// Mutator executes mutations against the database
 	Mutator
 	// NewIterator creates a new iterator
@@ -59,6 +61,12 @@ type Getter interface {
 	Get(ctx context.Context, key []byte) ([]byte, error)
 }
 
+// MultiGetter gets the specified keys in the database. The values are returned in the same order as the keys - if a key
+// does not exist, its value is a nil byte slice
+type MultiGetter interface {
+	MultiGet(ctx context.Context, keys [][]byte) ([][]byte, error)
+}
+
 // Iterator is a key value database iterator. Keys should be sorted lexicographically.
 type Iterator interface {
 	// Seek seeks to the given key
@@ -0,0 +1,592 @@
+// Package kvtest provides a conformance test suite for kv.DB implementations. Every provider (including third-party ones)
+// should pass RunConformance to be usable by the myjson core.
+package kvtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+// Opener opens a new, empty kv database for a single conformance test
+type Opener func(t *testing.T) kv.DB
+
+// Option configures the conformance test suite
+type Option func(o *options)
+
+type options struct {
+	serializedWriters bool
+}
+
+// WithSerializedWriters declares that the provider serializes writable transactions - a writable transaction blocks until
+// the open one finishes, so concurrent writers are prevented from conflicting instead of being rejected on commit
+func WithSerializedWriters() Option {
+	return func(o *options) {
+		o.serializedWriters = true
+	}
+}
+
+// RunConformance runs the kv.DB conformance test suite against the databases returned by open. A new database is opened
+// for every test
+func RunConformance(t *testing.T, open Opener, opts ...Option) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	conflict := testConflict
+	if o.serializedWriters {
+		conflict = testSerializedWriters
+	}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, db kv.DB)
+	}{
+		{name: "get missing key", fn: testGetMissing},
+		{name: "set get delete", fn: testSetGetDelete},
+		{name: "read own writes", fn: testReadOwnWrites},
+		{name: "multi get", fn: testMultiGet},
+		{name: "rollback", fn: testRollback},
+		{name: "read only", fn: testReadOnly},
+		{name: "batch", fn: testBatch},
+		{name: "batch read own writes", fn: testBatchReadOwnWrites},
+		{name: "conflict", fn: conflict},
+		{name: "iterate in order", fn: testIterateOrder},
+		{name: "iterate w/ prefix", fn: testIteratePrefix},
+		{name: "iterate in reverse", fn: testIterateReverse},
+		{name: "iterate w/ seek", fn: testIterateSeek},
+		{name: "iterate w/ upper bound", fn: testIterateUpperBound},
+		{name: "drop prefix", fn: testDropPrefix},
+		{name: "change stream", fn: testChangeStream},
+		{name: "locker", fn: testLocker},
+		{name: "concurrent locker", fn: testConcurrentLocker},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			db := open(t)
+			defer db.Close(context.Background())
+			test.fn(t, db)
+		})
+	}
+}
+
+// keys is the fixture data used by the iterator tests - it contains keys of varying lengths that share prefixes
+var keys = []string{
+	"a",
+	"a.1",
+	"a.10",
+	"a.2",
+	"a.2\x00",
+	"a.20",
+	"a.3",
+	"b.1",
+	"b.2",
+	"b\xff",
+	"c",
+}
+
+func seed(t *testing.T, db kv.DB, keys ...string) {
+	ctx := context.Background()
+	// insert in reverse so that insertion order never matches key order
+	assert.NoError(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		for i := len(keys) - 1; i >= 0; i-- {
+			if err := tx.Set(ctx, []byte(keys[i]), []byte(fmt.Sprintf("value.%s", keys[i]))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func scan(t *testing.T, db kv.DB, opts kv.IterOpts) []string {
+	var found []string
+	assert.NoError(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		iter, err := tx.NewIterator(opts)
+		if err != nil {
+			return err
+		}
+		defer iter.Close()
+		for iter.Valid() {
+			val, err := iter.Value()
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, fmt.Sprintf("value.%s", iter.Key()), string(val))
+			found = append(found, string(iter.Key()))
+			if err := iter.Next(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	return found
+}
+
+// scanTx returns the keys read by an iterator in an open transaction
+func scanTx(t *testing.T, tx kv.Tx, opts kv.IterOpts) []string {
+	iter, err := tx.NewIterator(opts)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer iter.Close()
+	var found []string
+	for iter.Valid() {
+		_, err := iter.Value()
+		assert.NoError(t, err)
+		found = append(found, string(iter.Key()))
+		assert.NoError(t, iter.Next())
+	}
+	return found
+}
+
+func sorted(keys []string, reverse bool) []string {
+	cp := append([]string{}, keys...)
+	sort.Slice(cp, func(i, j int) bool {
+		if reverse {
+			return bytes.Compare([]byte(cp[i]), []byte(cp[j])) > 0
+		}
+		return bytes.Compare([]byte(cp[i]), []byte(cp[j])) < 0
+	})
+	return cp
+}
+
+func filter(keys []string, fn func(key string) bool) []string {
+	var filtered []string
+	for _, k := range keys {
+		if fn(k) {
+			filtered = append(filtered, k)
+		}
+	}
+	return filtered
+}
+
+func get(t *testing.T, db kv.DB, key string) []byte {
+	var val []byte
+	assert.NoError(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		v, err := tx.Get(context.Background(), []byte(key))
+		val = v
+		return err
+	}))
+	return val
+}
+
+func testGetMissing(t *testing.T, db kv.DB) {
+	assert.Nil(t, get(t, db, "missing"))
+	seed(t, db, "exists")
+	assert.Nil(t, get(t, db, "missing"))
+	assert.Nil(t, get(t, db, "exist"))
+	assert.Nil(t, get(t, db, "exists.1"))
+}
+
+func testSetGetDelete(t *testing.T, db kv.DB) {
+	ctx := context.Background()
+	seed(t, db, keys...)
+	for _, k := range keys {
+		assert.Equal(t, fmt.Sprintf("value.%s", k), string(get(t, db, k)))
+	}
+	assert.NoError(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		return tx.Set(ctx, []byte("a"), []byte("updated"))
+	}))
+	assert.Equal(t, "updated", string(get(t, db, "a")))
+	assert.NoError(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		return tx.Delete(ctx, []byte("a"))
+	}))
+	assert.Nil(t, get(t, db, "a"))
+	assert.Equal(t, "value.a.1", string(get(t, db, "a.1")))
+}
+
+func testReadOwnWrites(t *testing.T, db kv.DB) {
+	ctx := context.Background()
+	seed(t, db, "deleted")
+	assert.NoError(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		assert.NoError(t, tx.Set(ctx, []byte("own"), []byte("1")))
+		val, err := tx.Get(ctx, []byte("own"))
+		assert.NoError(t, err)
+		assert.Equal(t, "1", string(val))
+		assert.NoError(t, tx.Delete(ctx, []byte("deleted")))
+		val, err = tx.Get(ctx, []byte("deleted"))
+		assert.NoError(t, err)
+		assert.Nil(t, val)
+		return nil
+	}))
+	assert.Equal(t, "1", string(get(t, db, "own")))
+	assert.Nil(t, get(t, db, "deleted"))
+}
+
+func testMultiGet(t *testing.T, db kv.DB) {
+	ctx := context.Background()
+	seed(t, db, "a", "b", "deleted")
+	assert.NoError(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		assert.NoError(t, tx.Set(ctx, []byte("own"), []byte("1")))
+		assert.NoError(t, tx.Delete(ctx, []byte("deleted")))
+		values, err := tx.MultiGet(ctx, [][]byte{[]byte("b"), []byte("missing"), []byte("own"), []byte("deleted"), []byte("a")})
+		assert.NoError(t, err)
+		if assert.Len(t, values, 5) {
+			assert.Equal(t, "value.b", string(values[0]))
+			assert.Nil(t, values[1])
+			assert.Equal(t, "1", string(values[2]))
+			assert.Nil(t, values[3])
+			assert.Equal(t, "value.a", string(values[4]))
+		}
+		return nil
+	}))
+	assert.NoError(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		values, err := tx.MultiGet(ctx, nil)
+		assert.NoError(t, err)
+		assert.Empty(t, values)
+		return nil
+	}))
+}
+
+func testRollback(t *testing.T, db kv.DB) {
+	ctx := context.Background()
+	seed(t, db, "existing")
+	tx, err := db.NewTx(kv.TxOpts{})
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Set(ctx, []byte("rollback"), []byte("1")))
+	assert.NoError(t, tx.Delete(ctx, []byte("existing")))
+	assert.NoError(t, tx.Rollback(ctx))
+	tx.Close(ctx)
+	assert.Nil(t, get(t, db, "rollback"))
+	assert.Equal(t, "value.existing", string(get(t, db, "existing")))
+
+	// a failing transaction function must roll back its writes
+	assert.Error(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		assert.NoError(t, tx.Set(ctx, []byte("rollback"), []byte("1")))
+		return fmt.Errorf("rollback")
+	}))
+	assert.Nil(t, get(t, db, "rollback"))
+}
+
+func testReadOnly(t *testing.T, db kv.DB) {
+	ctx := context.Background()
+	assert.Error(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		return tx.Set(ctx, []byte("readonly"), []byte("1"))
+	}))
+	assert.Nil(t, get(t, db, "readonly"))
+}
+
+func testBatch(t *testing.T, db kv.DB) {
+	ctx := context.Background()
+	assert.NoError(t, db.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+		for _, k := range keys {
+			if err := tx.Set(ctx, []byte(k), []byte(fmt.Sprintf("value.%s", k))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	assert.Equal(t, sorted(keys, false), scan(t, db, kv.IterOpts{}))
+}
+
+func testBatchReadOwnWrites(t *testing.T, db kv.DB) {
+	ctx := context.Background()
+	seed(t, db, "a", "a.1", "a.2", "b.1")
+	assert.NoError(t, db.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+		assert.NoError(t, tx.Set(ctx, []byte("a.3"), []byte("new")))
+		assert.NoError(t, tx.Set(ctx, []byte("a.10"), []byte("new")))
+		assert.NoError(t, tx.Set(ctx, []byte("a.1"), []byte("updated")))
+		assert.NoError(t, tx.Delete(ctx, []byte("a.2")))
+
+		val, err := tx.Get(ctx, []byte("a.3"))
+		assert.NoError(t, err)
+		assert.Equal(t, "new", string(val))
+		val, err = tx.Get(ctx, []byte("a.1"))
+		assert.NoError(t, err)
+		assert.Equal(t, "updated", string(val))
+		val, err = tx.Get(ctx, []byte("a.2"))
+		assert.NoError(t, err)
+		assert.Nil(t, val)
+		values, err := tx.MultiGet(ctx, [][]byte{[]byte("a.2"), []byte("a.10"), []byte("b.1")})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]byte{nil, []byte("new"), []byte("value.b.1")}, values)
+
+		assert.Equal(t, []string{"a.1", "a.10", "a.3"}, scanTx(t, tx, kv.IterOpts{Prefix: []byte("a.")}))
+		assert.Equal(t, []string{"a.3", "a.10", "a.1"}, scanTx(t, tx, kv.IterOpts{Prefix: []byte("a."), Reverse: true}))
+		assert.Equal(t, []string{"a.10", "a.3"}, scanTx(t, tx, kv.IterOpts{Prefix: []byte("a."), Seek: []byte("a.10")}))
+		assert.Equal(t, []string{"a", "a.1", "a.10", "a.3", "b.1"}, scanTx(t, tx, kv.IterOpts{}))
+		return nil
+	}))
+	assert.Equal(t, "updated", string(get(t, db, "a.1")))
+	assert.Nil(t, get(t, db, "a.2"))
+	assert.Equal(t, "new", string(get(t, db, "a.3")))
+}
+
+// testConflict checks that of two transactions that read & write the same key, the last to commit is rejected
+func testConflict(t *testing.T, db kv.DB) {
+	ctx := context.Background()
+	seed(t, db, "conflict")
+	var txs []kv.Tx
+	for i := 0; i < 2; i++ {
+		tx, err := db.NewTx(kv.TxOpts{})
+		assert.NoError(t, err)
+		defer tx.Close(ctx)
+		val, err := tx.Get(ctx, []byte("conflict"))
+		assert.NoError(t, err)
+		assert.Equal(t, "value.conflict", string(val))
+		assert.NoError(t, tx.Set(ctx, []byte("conflict"), []byte(fmt.Sprint(i))))
+		txs = append(txs, tx)
+	}
+	assert.NoError(t, txs[0].Commit(ctx))
+	err := txs[1].Commit(ctx)
+	if assert.Error(t, err) {
+		assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+	}
+	assert.Equal(t, "0", string(get(t, db, "conflict")))
+}
+
+// testSerializedWriters checks that concurrent read-modify-write transactions on the same key don't lose updates
+func testSerializedWriters(t *testing.T, db kv.DB) {
+	ctx := context.Background()
+	const writers = 10
+	assert.NoError(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		return tx.Set(ctx, []byte("counter"), []byte("0"))
+	}))
+	wg := sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+				val, err := tx.Get(ctx, []byte("counter"))
+				if err != nil {
+					return err
+				}
+				return tx.Set(ctx, []byte("counter"), []byte(fmt.Sprint(cast.ToInt(string(val))+1)))
+			}))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, fmt.Sprint(writers), string(get(t, db, "counter")))
+}
+
+func testIterateOrder(t *testing.T, db kv.DB) {
+	seed(t, db, keys...)
+	assert.Equal(t, sorted(keys, false), scan(t, db, kv.IterOpts{}))
+}
+
+func testIteratePrefix(t *testing.T, db kv.DB) {
+	seed(t, db, keys...)
+	for _, prefix := range []string{"a", "a.", "a.2", "b", "b\xff", "c", "d"} {
+		prefix := prefix
+		expected := filter(sorted(keys, false), func(key string) bool {
+			return bytes.HasPrefix([]byte(key), []byte(prefix))
+		})
+		assert.Equal(t, expected, scan(t, db, kv.IterOpts{Prefix: []byte(prefix)}), "prefix: %q", prefix)
+	}
+}
+
+func testIterateReverse(t *testing.T, db kv.DB) {
+	seed(t, db, keys...)
+	assert.Equal(t, sorted(keys, true), scan(t, db, kv.IterOpts{Reverse: true}))
+	for _, prefix := range []string{"a", "a.", "a.2", "b", "b\xff", "c", "d"} {
+		prefix := prefix
+		expected := filter(sorted(keys, true), func(key string) bool {
+			return bytes.HasPrefix([]byte(key), []byte(prefix))
+		})
+		assert.Equal(t, expected, scan(t, db, kv.IterOpts{Prefix: []byte(prefix), Reverse: true}), "prefix: %q", prefix)
+	}
+}
+
+func testIterateSeek(t *testing.T, db kv.DB) {
+	seed(t, db, keys...)
+	// forward iterators begin at the first key >= the seek key
+	assert.Equal(t, []string{"a.2", "a.2\x00", "a.20", "a.3"}, scan(t, db, kv.IterOpts{
+		Prefix: []byte("a."),
+		Seek:   []byte("a.2"),
+	}))
+	assert.Equal(t, []string{"a.20", "a.3"}, scan(t, db, kv.IterOpts{
+		Prefix: []byte("a."),
+		Seek:   []byte("a.2\x01"),
+	}))
+	// reverse iterators begin at the last key <= the seek key
+	assert.Equal(t, []string{"a.2", "a.10", "a.1"}, scan(t, db, kv.IterOpts{
+		Prefix:  []byte("a."),
+		Seek:    []byte("a.2"),
+		Reverse: true,
+	}))
+	assert.Equal(t, []string{"a.2\x00", "a.2", "a.10", "a.1"}, scan(t, db, kv.IterOpts{
+		Prefix:  []byte("a."),
+		Seek:    []byte("a.2\x01"),
+		Reverse: true,
+	}))
+}
+
+func testIterateUpperBound(t *testing.T, db kv.DB) {
+	seed(t, db, keys...)
+	// upper bounds are inclusive
+	assert.Equal(t, []string{"a.1", "a.10", "a.2"}, scan(t, db, kv.IterOpts{
+		Prefix:     []byte("a."),
+		UpperBound: []byte("a.2"),
+	}))
+	assert.Equal(t, []string{"a.2", "a.10", "a.1"}, scan(t, db, kv.IterOpts{
+		Prefix:     []byte("a."),
+		UpperBound: []byte("a.2"),
+		Reverse:    true,
+	}))
+	assert.Equal(t, []string{"a.10", "a.2"}, scan(t, db, kv.IterOpts{
+		Prefix:     []byte("a."),
+		Seek:       []byte("a.10"),
+		UpperBound: []byte("a.2"),
+	}))
+}
+
+func testDropPrefix(t *testing.T, db kv.DB) {
+	ctx := context.Background()
+	seed(t, db, keys...)
+	assert.NoError(t, db.DropPrefix(ctx, []byte("a."), []byte("b\xff")))
+	expected := filter(sorted(keys, false), func(key string) bool {
+		return !bytes.HasPrefix([]byte(key), []byte("a.")) && !bytes.HasPrefix([]byte(key), []byte("b\xff"))
+	})
+	assert.Equal(t, expected, scan(t, db, kv.IterOpts{}))
+	assert.Nil(t, get(t, db, "a.1"))
+	assert.Equal(t, "value.a", string(get(t, db, "a")))
+}
+
+func testChangeStream(t *testing.T, db kv.DB) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		received []kv.CDC
+		ready    = make(chan struct{})
+		done     = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		assert.NoError(t, db.ChangeStream(ctx, []byte("stream."), func(cdc kv.CDC) (bool, error) {
+			if string(cdc.Key) == "stream.ready" {
+				select {
+				case <-ready:
+				default:
+					close(ready)
+				}
+				return true, nil
+			}
+			mu.Lock()
+			received = append(received, cdc)
+			mu.Unlock()
+			return true, nil
+		}))
+	}()
+	// change stream subscriptions may become active asynchronously - write a marker key until it is received
+	func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			assert.NoError(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+				return tx.Set(ctx, []byte("stream.ready"), []byte("1"))
+			}))
+			select {
+			case <-ready:
+				return
+			case <-ctx.Done():
+				t.Fatal("change stream never became active")
+			case <-ticker.C:
+			}
+		}
+	}()
+	tx, err := db.NewTx(kv.TxOpts{})
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Set(ctx, []byte("stream.1"), []byte("1")))
+	assert.NoError(t, tx.Set(ctx, []byte("ignored.1"), []byte("1")))
+	assert.NoError(t, tx.Delete(ctx, []byte("stream.2")))
+	// changes must not be delivered before they are committed
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	assert.Empty(t, received)
+	mu.Unlock()
+	assert.NoError(t, tx.Commit(ctx))
+	tx.Close(ctx)
+
+	// rolled back changes must never be delivered
+	assert.Error(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		assert.NoError(t, tx.Set(ctx, []byte("stream.rollback"), []byte("1")))
+		return fmt.Errorf("rollback")
+	}))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, kv.SETOP, received[0].Operation)
+		assert.Equal(t, "stream.1", string(received[0].Key))
+		assert.Equal(t, "1", string(received[0].Value))
+		assert.Equal(t, kv.DELOP, received[1].Operation)
+		assert.Equal(t, "stream.2", string(received[1].Key))
+	}
+}
+
+func testLocker(t *testing.T, db kv.DB) {
+	ctx := context.Background()
+	lock, err := db.NewLocker([]byte("locker"), 1*time.Second)
+	assert.NoError(t, err)
+	gotLock, err := lock.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, gotLock)
+	isLocked, err := lock.IsLocked(ctx)
+	assert.NoError(t, err)
+	assert.True(t, isLocked)
+
+	other, err := db.NewLocker([]byte("locker"), 1*time.Second)
+	assert.NoError(t, err)
+	gotLock, err = other.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.False(t, gotLock)
+	isLocked, err = other.IsLocked(ctx)
+	assert.NoError(t, err)
+	assert.True(t, isLocked)
+
+	lock.Unlock()
+	gotLock, err = other.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, gotLock)
+	other.Unlock()
+}
+
+// testConcurrentLocker checks that exactly one of the lockers racing for the same key acquires it
+func testConcurrentLocker(t *testing.T, db kv.DB) {
+	ctx := context.Background()
+	const lockers = 10
+	var (
+		mu      sync.Mutex
+		winners []kv.Locker
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < lockers; i++ {
+		lock, err := db.NewLocker([]byte("concurrent"), 1*time.Second)
+		assert.NoError(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gotLock, err := lock.TryLock(ctx)
+			assert.NoError(t, err)
+			if gotLock {
+				mu.Lock()
+				winners = append(winners, lock)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, winners, 1)
+	for _, lock := range winners {
+		lock.Unlock()
+	}
+}
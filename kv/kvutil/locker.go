@@ -0,0 +1,176 @@
+package kvutil
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/segmentio/ksuid"
+)
+
+// dbLock is a distributed lock that stores its lease under a key in a kv.DB
+type dbLock struct {
+	id            string
+	key           []byte
+	db            kv.DB
+	leaseInterval time.Duration
+	start         time.Time
+	hasUnlocked   chan struct{}
+	unlock        chan struct{}
+}
+
+type lockMeta struct {
+	ID         string    `json:"id"`
+	Start      time.Time `json:"start"`
+	LastUpdate time.Time `json:"lastUpdate"`
+	Key        []byte    `json:"key"`
+}
+
+// NewLocker returns a kv.Locker that stores its lease under the key using the database's transactions. The lease is
+// renewed every leaseInterval while the lock is held & is considered expired after 4 missed renewals
+func NewLocker(db kv.DB, key []byte, leaseInterval time.Duration) kv.Locker {
+	return &dbLock{
+		id:            ksuid.New().String(),
+		key:           key,
+		db:            db,
+		leaseInterval: leaseInterval,
+		unlock:        make(chan struct{}),
+		hasUnlocked:   make(chan struct{}),
+	}
+}
+
+func (l *dbLock) IsLocked(ctx context.Context) (bool, error) {
+	isLocked := true
+	err := l.db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		val, err := tx.Get(ctx, l.key)
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			isLocked = false
+			return nil
+		}
+		var current lockMeta
+		//nolint:errcheck
+		json.Unmarshal(val, &current)
+		if time.Since(current.LastUpdate) > 4*l.leaseInterval && current.ID != l.id {
+			isLocked = false
+			return nil
+		}
+		return nil
+	})
+	return isLocked, err
+}
+
+func (l *dbLock) TryLock(ctx context.Context) (bool, error) {
+	l.start = time.Now()
+	gotLock := false
+	err := l.db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		val, err := tx.Get(ctx, l.key)
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			if err := l.setLock(ctx, tx); err != nil {
+				return err
+			}
+			gotLock = true
+			return nil
+		}
+		var current lockMeta
+		//nolint:errcheck
+		json.Unmarshal(val, &current)
+		if time.Since(current.LastUpdate) > 4*l.leaseInterval && current.ID != l.id {
+			if err := l.setLock(ctx, tx); err != nil {
+				return err
+			}
+			gotLock = true
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		// another locker acquired the lock concurrently
+		if errors.Extract(err).Code == errors.Conflict {
+			return false, nil
+		}
+		return false, err
+	}
+	if gotLock {
+		//nolint:errcheck
+		go l.keepalive(ctx)
+	}
+	return gotLock, nil
+}
+
+func (l *dbLock) Unlock() {
+	l.unlock <- struct{}{}
+	<-l.hasUnlocked
+}
+
+func (l *dbLock) setLock(ctx context.Context, tx kv.Tx) error {
+	meta := &lockMeta{
+		ID:         l.id,
+		Start:      l.start,
+		LastUpdate: time.Now(),
+		Key:        l.key,
+	}
+	bytes, _ := json.Marshal(meta)
+	return tx.Set(ctx, l.key, bytes)
+}
+
+func (l *dbLock) getLock(ctx context.Context, tx kv.Tx) (*lockMeta, error) {
+	val, err := tx.Get(ctx, l.key)
+	if err != nil {
+		return nil, err
+	}
+	if val == nil {
+		return nil, errors.New(errors.NotFound, "lock not found: %s", string(l.key))
+	}
+	var m lockMeta
+	if err := json.Unmarshal(val, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (l *dbLock) keepalive(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ticker := time.NewTicker(l.leaseInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// update lease
+			err := l.db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+				val, err := l.getLock(ctx, tx)
+				if err != nil {
+					return err
+				}
+				if val.ID == l.id {
+					return l.setLock(ctx, tx)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		case <-l.unlock:
+			err := l.db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+				val, err := l.getLock(ctx, tx)
+				if err != nil {
+					return err
+				}
+				if val.ID == l.id {
+					return tx.Delete(ctx, l.key)
+				}
+				return nil
+			})
+			l.hasUnlocked <- struct{}{}
+			return err
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package kvutil
+
+import (
+	"bytes"
+
+	"github.com/autom8ter/myjson/kv"
+	"github.com/google/btree"
+)
+
+// overlayItem is a pending write - deleted is true if the key is pending deletion
+type overlayItem struct {
+	key     []byte
+	value   []byte
+	deleted bool
+}
+
+func lessOverlayItem(a, b overlayItem) bool {
+	return bytes.Compare(a.key, b.key) < 0
+}
+
+// Overlay buffers the pending writes of a batch transaction so that the transaction can read its own writes before they
+// are committed. It is not safe for concurrent use
+type Overlay struct {
+	tree *btree.BTreeG[overlayItem]
+}
+
+// NewOverlay returns an empty Overlay
+func NewOverlay() *Overlay {
+	return &Overlay{
+		tree: btree.NewG[overlayItem](32, lessOverlayItem),
+	}
+}
+
+// Set buffers a pending write of the key
+func (o *Overlay) Set(key, value []byte) {
+	o.tree.ReplaceOrInsert(overlayItem{
+		key:   append([]byte{}, key...),
+		value: append([]byte{}, value...),
+	})
+}
+
+// Delete buffers a pending deletion of the key
+func (o *Overlay) Delete(key []byte) {
+	o.tree.ReplaceOrInsert(overlayItem{
+		key:     append([]byte{}, key...),
+		deleted: true,
+	})
+}
+
+// Get returns the pending value of the key. ok is false if the key has no pending write - if the key is pending deletion,
+// the value is nil & ok is true
+func (o *Overlay) Get(key []byte) (value []byte, ok bool) {
+	i, ok := o.tree.Get(overlayItem{key: key})
+	if !ok {
+		return nil, false
+	}
+	if i.deleted {
+		return nil, true
+	}
+	return append([]byte{}, i.value...), true
+}
+
+// Len returns the number of keys with a pending write
+func (o *Overlay) Len() int {
+	return o.tree.Len()
+}
+
+// Clear discards every pending write
+func (o *Overlay) Clear() {
+	o.tree.Clear(false)
+}
+
+// NewIterator merges the pending writes that match the options into base - an iterator over committed data that was
+// opened with the same options. Pending writes replace committed values & pending deletions hide them. Writes made after
+// the iterator is created are not visible to it
+func (o *Overlay) NewIterator(base kv.Iterator, opts kv.IterOpts) (kv.Iterator, error) {
+	var items []overlayItem
+	o.tree.AscendGreaterOrEqual(overlayItem{key: opts.Prefix}, func(i overlayItem) bool {
+		if !bytes.HasPrefix(i.key, opts.Prefix) {
+			return false
+		}
+		if opts.UpperBound != nil && bytes.Compare(i.key, opts.UpperBound) > 0 {
+			return false
+		}
+		if opts.Seek != nil {
+			if opts.Reverse && bytes.Compare(i.key, opts.Seek) > 0 {
+				return false
+			}
+			if !opts.Reverse && bytes.Compare(i.key, opts.Seek) < 0 {
+				return true
+			}
+		}
+		items = append(items, i)
+		return true
+	})
+	if opts.Reverse {
+		for l, r := 0, len(items)-1; l < r; l, r = l+1, r-1 {
+			items[l], items[r] = items[r], items[l]
+		}
+	}
+	m := &mergeIterator{
+		base:    base,
+		items:   items,
+		reverse: opts.Reverse,
+	}
+	if err := m.normalize(); err != nil {
+		base.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// mergeIterator merges pending writes into an iterator over committed data
+type mergeIterator struct {
+	base    kv.Iterator
+	items   []overlayItem
+	pos     int
+	reverse bool
+	// pending is true if the current key is a pending write
+	pending bool
+}
+
+// before returns true if a is iterated before b
+func (m *mergeIterator) before(a, b []byte) bool {
+	if m.reverse {
+		return bytes.Compare(a, b) > 0
+	}
+	return bytes.Compare(a, b) < 0
+}
+
+// normalize positions the iterator on the next visible key - committed keys that are overwritten by (or pending deletion
+// in) the overlay are skipped
+func (m *mergeIterator) normalize() error {
+	for {
+		baseValid := m.base.Valid()
+		if m.pos >= len(m.items) {
+			m.pending = false
+			return nil
+		}
+		i := m.items[m.pos]
+		if baseValid && m.before(m.base.Key(), i.key) {
+			m.pending = false
+			return nil
+		}
+		if baseValid && bytes.Equal(m.base.Key(), i.key) {
+			if err := m.base.Next(); err != nil {
+				return err
+			}
+		}
+		if i.deleted {
+			m.pos++
+			continue
+		}
+		m.pending = true
+		return nil
+	}
+}
+
+func (m *mergeIterator) Seek(key []byte) {
+	m.base.Seek(key)
+	m.pos = len(m.items)
+	for i, item := range m.items {
+		if !m.before(item.key, key) {
+			m.pos = i
+			break
+		}
+	}
+	//nolint:errcheck
+	m.normalize()
+}
+
+func (m *mergeIterator) Close() {
+	m.base.Close()
+}
+
+func (m *mergeIterator) Valid() bool {
+	return m.pending || m.base.Valid()
+}
+
+func (m *mergeIterator) Key() []byte {
+	if m.pending {
+		return m.items[m.pos].key
+	}
+	return m.base.Key()
+}
+
+func (m *mergeIterator) Value() ([]byte, error) {
+	if m.pending {
+		return append([]byte{}, m.items[m.pos].value...), nil
+	}
+	return m.base.Value()
+}
+
+func (m *mergeIterator) Next() error {
+	if m.pending {
+		m.pos++
+	} else if err := m.base.Next(); err != nil {
+		return err
+	}
+	return m.normalize()
+}
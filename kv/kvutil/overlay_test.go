@@ -0,0 +1,90 @@
+package kvutil_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
+	"github.com/autom8ter/myjson/kv/registry"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/autom8ter/myjson/kv/memory"
+)
+
+func TestOverlay(t *testing.T) {
+	ctx := context.Background()
+	db, err := registry.Open("memory", nil)
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+	assert.NoError(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		for _, key := range []string{"a", "b", "c", "d"} {
+			if err := tx.Set(ctx, []byte(key), []byte("committed")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	overlay := kvutil.NewOverlay()
+	overlay.Set([]byte("b"), []byte("pending"))
+	overlay.Delete([]byte("c"))
+	overlay.Set([]byte("e"), []byte("pending"))
+	overlay.Delete([]byte("f"))
+
+	t.Run("get", func(t *testing.T) {
+		val, ok := overlay.Get([]byte("b"))
+		assert.True(t, ok)
+		assert.Equal(t, "pending", string(val))
+		val, ok = overlay.Get([]byte("c"))
+		assert.True(t, ok)
+		assert.Nil(t, val)
+		_, ok = overlay.Get([]byte("a"))
+		assert.False(t, ok)
+		assert.Equal(t, 4, overlay.Len())
+	})
+	scan := func(opts kv.IterOpts) []string {
+		var found []string
+		assert.NoError(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			base, err := tx.NewIterator(opts)
+			if err != nil {
+				return err
+			}
+			iter, err := overlay.NewIterator(base, opts)
+			if err != nil {
+				return err
+			}
+			defer iter.Close()
+			for iter.Valid() {
+				val, err := iter.Value()
+				if err != nil {
+					return err
+				}
+				found = append(found, string(iter.Key())+"="+string(val))
+				if err := iter.Next(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+		return found
+	}
+	t.Run("forward", func(t *testing.T) {
+		assert.Equal(t, []string{"a=committed", "b=pending", "d=committed", "e=pending"}, scan(kv.IterOpts{}))
+	})
+	t.Run("reverse", func(t *testing.T) {
+		assert.Equal(t, []string{"e=pending", "d=committed", "b=pending", "a=committed"}, scan(kv.IterOpts{Reverse: true}))
+	})
+	t.Run("seek & upper bound", func(t *testing.T) {
+		assert.Equal(t, []string{"b=pending", "d=committed"}, scan(kv.IterOpts{Seek: []byte("b"), UpperBound: []byte("d")}))
+		assert.Equal(t, []string{"b=pending", "a=committed"}, scan(kv.IterOpts{Seek: []byte("c"), Reverse: true}))
+	})
+	t.Run("prefix", func(t *testing.T) {
+		assert.Equal(t, []string{"e=pending"}, scan(kv.IterOpts{Prefix: []byte("e")}))
+		assert.Empty(t, scan(kv.IterOpts{Prefix: []byte("c")}))
+	})
+	t.Run("clear", func(t *testing.T) {
+		overlay.Clear()
+		assert.Equal(t, 0, overlay.Len())
+		assert.Equal(t, []string{"a=committed", "b=committed", "c=committed", "d=committed"}, scan(kv.IterOpts{}))
+	})
+}
@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"bytes"
+
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
+	"github.com/google/btree"
+)
+
+type memoryIterator struct {
+	tree *btree.BTreeG[item]
+	opts kv.IterOpts
+	// current is the item the iterator is positioned at - nil if the iterator is exhausted
+	current *item
+}
+
+func newIterator(tree *btree.BTreeG[item], opts kv.IterOpts) *memoryIterator {
+	i := &memoryIterator{tree: tree, opts: opts}
+	switch {
+	case opts.Seek != nil:
+		i.Seek(opts.Seek)
+	case opts.Reverse:
+		next := kvutil.NextPrefix(opts.Prefix)
+		switch {
+		case len(opts.Prefix) > 0 && len(next) > 0 && (opts.UpperBound == nil || bytes.Compare(opts.UpperBound, next) >= 0):
+			i.seekLT(next)
+		case opts.UpperBound != nil:
+			i.seekLE(opts.UpperBound)
+		default:
+			i.last()
+		}
+	default:
+		i.seekGE(opts.Prefix)
+	}
+	return i
+}
+
+func (i *memoryIterator) Seek(key []byte) {
+	if i.opts.Reverse {
+		i.seekLE(key)
+		return
+	}
+	i.seekGE(key)
+}
+
+func (i *memoryIterator) Close() {
+	i.current = nil
+	i.tree = nil
+}
+
+func (i *memoryIterator) Valid() bool {
+	if i.current == nil {
+		return false
+	}
+	if !bytes.HasPrefix(i.current.key, i.opts.Prefix) {
+		return false
+	}
+	if i.opts.UpperBound != nil && bytes.Compare(i.current.key, i.opts.UpperBound) > 0 {
+		return false
+	}
+	return true
+}
+
+func (i *memoryIterator) Key() []byte {
+	if i.current == nil {
+		return nil
+	}
+	return append([]byte{}, i.current.key...)
+}
+
+func (i *memoryIterator) Value() ([]byte, error) {
+	if i.current == nil {
+		return nil, nil
+	}
+	return append([]byte{}, i.current.value...), nil
+}
+
+func (i *memoryIterator) Next() error {
+	if i.current == nil {
+		return nil
+	}
+	if i.opts.Reverse {
+		i.seekLT(i.current.key)
+		return nil
+	}
+	i.seekGT(i.current.key)
+	return nil
+}
+
+func (i *memoryIterator) position(found item, ok bool) {
+	if !ok {
+		i.current = nil
+		return
+	}
+	i.current = &found
+}
+
+func (i *memoryIterator) seekGE(key []byte) {
+	var (
+		found item
+		ok    bool
+	)
+	i.tree.AscendGreaterOrEqual(item{key: key}, func(it item) bool {
+		found, ok = it, true
+		return false
+	})
+	i.position(found, ok)
+}
+
+func (i *memoryIterator) seekGT(key []byte) {
+	var (
+		found item
+		ok    bool
+	)
+	i.tree.AscendGreaterOrEqual(item{key: key}, func(it item) bool {
+		if bytes.Equal(it.key, key) {
+			return true
+		}
+		found, ok = it, true
+		return false
+	})
+	i.position(found, ok)
+}
+
+func (i *memoryIterator) seekLE(key []byte) {
+	var (
+		found item
+		ok    bool
+	)
+	i.tree.DescendLessOrEqual(item{key: key}, func(it item) bool {
+		found, ok = it, true
+		return false
+	})
+	i.position(found, ok)
+}
+
+func (i *memoryIterator) seekLT(key []byte) {
+	var (
+		found item
+		ok    bool
+	)
+	i.tree.DescendLessOrEqual(item{key: key}, func(it item) bool {
+		if bytes.Equal(it.key, key) {
+			return true
+		}
+		found, ok = it, true
+		return false
+	})
+	i.position(found, ok)
+}
+
+func (i *memoryIterator) last() {
+	found, ok := i.tree.Max()
+	i.position(found, ok)
+}
@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/autom8ter/machine/v4"
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
+	"github.com/autom8ter/myjson/kv/registry"
+	"github.com/google/btree"
+)
+
+func init() {
+	registry.Register("memory", func(params map[string]interface{}) (kv.DB, error) {
+		return open(), nil
+	})
+}
+
+// item is a key value pair stored in the b-tree
+type item struct {
+	key   []byte
+	value []byte
+}
+
+func less(a, b item) bool {
+	return bytes.Compare(a.key, b.key) < 0
+}
+
+type memoryKV struct {
+	mu sync.Mutex
+	// tree holds the latest committed state of the database
+	tree *btree.BTreeG[item]
+	// version is incremented every time a transaction commits
+	version uint64
+	// versions holds the version each key was last committed at - it is used to detect write conflicts
+	versions map[string]uint64
+	// active is the number of open writable transactions
+	active  int
+	machine machine.Machine
+}
+
+func open() kv.DB {
+	return &memoryKV{
+		tree:     btree.NewG[item](32, less),
+		versions: map[string]uint64{},
+		machine:  machine.New(),
+	}
+}
+
+func (m *memoryKV) Tx(opts kv.TxOpts, fn func(kv.Tx) error) error {
+	tx, err := m.NewTx(opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Close(context.Background())
+	err = fn(tx)
+	if err != nil {
+		//nolint:errcheck
+		tx.Rollback(context.Background())
+		return err
+	}
+	if err := tx.Commit(context.Background()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *memoryKV) NewTx(opts kv.TxOpts) (kv.Tx, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !opts.IsReadOnly {
+		m.active++
+	}
+	return &memoryTx{
+		opts:     opts,
+		db:       m,
+		snapshot: m.tree.Clone(),
+		version:  m.version,
+		written:  map[string]struct{}{},
+	}, nil
+}
+
+// commit applies the transaction's writes to the database. If any of the written keys were committed by another transaction
+// after the given transaction started, a conflict error is returned
+func (m *memoryKV) commit(tx *memoryTx) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !tx.opts.IsBatch {
+		for key := range tx.written {
+			if m.versions[key] > tx.version {
+				return errors.New(errors.Conflict, "memory: transaction conflict on key: %s", key)
+			}
+		}
+	}
+	m.version++
+	for _, e := range tx.entries {
+		switch e.Operation {
+		case kv.SETOP:
+			m.tree.ReplaceOrInsert(item{key: e.Key, value: e.Value})
+		case kv.DELOP:
+			m.tree.Delete(item{key: e.Key})
+		}
+		m.versions[string(e.Key)] = m.version
+	}
+	return nil
+}
+
+// release marks a writable transaction as finished
+func (m *memoryKV) release() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active--
+	if m.active == 0 {
+		// no open transaction can conflict with previously committed keys
+		m.versions = map[string]uint64{}
+	}
+}
+
+func (m *memoryKV) Close(ctx context.Context) error {
+	m.machine.Close()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tree.Clear(false)
+	return nil
+}
+
+func (m *memoryKV) DropPrefix(ctx context.Context, prefix ...[]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.version++
+	for _, pfx := range prefix {
+		var keys [][]byte
+		m.tree.AscendGreaterOrEqual(item{key: pfx}, func(i item) bool {
+			if !bytes.HasPrefix(i.key, pfx) {
+				return false
+			}
+			keys = append(keys, i.key)
+			return true
+		})
+		for _, key := range keys {
+			m.tree.Delete(item{key: key})
+			m.versions[string(key)] = m.version
+		}
+	}
+	return nil
+}
+
+func (m *memoryKV) NewLocker(key []byte, leaseInterval time.Duration) (kv.Locker, error) {
+	return kvutil.NewLocker(m, key, leaseInterval), nil
+}
+
+func (m *memoryKV) ChangeStream(ctx context.Context, prefix []byte, fn kv.ChangeStreamHandler) error {
+	return m.machine.Subscribe(ctx, "*", func(ctx context.Context, msg machine.Message) (bool, error) {
+		cdc, ok := msg.Body.(kv.CDC)
+		if !ok {
+			return false, errors.New(errors.Internal, "invalid cdc")
+		}
+		if bytes.HasPrefix(cdc.Key, prefix) {
+			return fn(cdc)
+		}
+		return true, nil
+	})
+}
@@ -0,0 +1,356 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvtest"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test(t *testing.T) {
+	db := open()
+	data := map[string]string{}
+	for i := 0; i < 100; i++ {
+		data[fmt.Sprint(i)] = fmt.Sprint(i)
+	}
+	t.Run("batch set", func(t *testing.T) {
+		assert.Nil(t, db.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+			for k, v := range data {
+				assert.Nil(t, tx.Set(context.Background(), []byte(k), []byte(v)))
+			}
+			return nil
+		}))
+	})
+	t.Run("set", func(t *testing.T) {
+		assert.Nil(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			for k, v := range data {
+				assert.Nil(t, tx.Set(context.Background(), []byte(k), []byte(v)))
+			}
+			return nil
+		}))
+	})
+
+	t.Run("get", func(t *testing.T) {
+		assert.Nil(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			for k, v := range data {
+				data, err := tx.Get(context.Background(), []byte(k))
+				assert.NoError(t, err)
+				assert.EqualValues(t, string(v), string(data))
+			}
+			return nil
+		}))
+	})
+	t.Run("iterate", func(t *testing.T) {
+		assert.Nil(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			iter, err := tx.NewIterator(kv.IterOpts{
+				Prefix:  nil,
+				Seek:    nil,
+				Reverse: false,
+			})
+			assert.NoError(t, err)
+			defer iter.Close()
+			i := 0
+			for iter.Valid() {
+				i++
+				val, _ := iter.Value()
+				assert.EqualValues(t, string(val), data[string(iter.Key())])
+				iter.Next()
+			}
+			assert.Equal(t, len(data), i)
+			return nil
+		}))
+	})
+	t.Run("iterate w/ prefix", func(t *testing.T) {
+		assert.Nil(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			iter, err := tx.NewIterator(kv.IterOpts{
+				Prefix:  []byte("1"),
+				Seek:    nil,
+				Reverse: false,
+			})
+			assert.NoError(t, err)
+			defer iter.Close()
+			i := 0
+			for iter.Valid() {
+				i++
+				assert.True(t, bytes.HasPrefix(iter.Key(), []byte("1")))
+				val, _ := iter.Value()
+				assert.EqualValues(t, string(val), data[string(iter.Key())])
+				iter.Next()
+			}
+			assert.Equal(t, 11, i)
+			return nil
+		}))
+	})
+	t.Run("iterate w/ upper bound", func(t *testing.T) {
+		assert.Nil(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			iter, err := tx.NewIterator(kv.IterOpts{
+				Prefix:     []byte("1"),
+				Seek:       nil,
+				Reverse:    false,
+				UpperBound: []byte("10"),
+			})
+			assert.NoError(t, err)
+			defer iter.Close()
+			i := 0
+			for iter.Valid() {
+				i++
+				val, _ := iter.Value()
+				assert.EqualValues(t, string(val), data[string(iter.Key())])
+				iter.Next()
+			}
+			assert.Equal(t, 2, i)
+			return nil
+		}))
+	})
+	t.Run("iterate in reverse", func(t *testing.T) {
+		assert.Nil(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			iter, err := tx.NewIterator(kv.IterOpts{
+				Prefix:     []byte("1"),
+				Reverse:    true,
+				UpperBound: []byte("10"),
+			})
+			assert.NoError(t, err)
+			defer iter.Close()
+			var found [][]byte
+			for iter.Valid() {
+				val, _ := iter.Value()
+				assert.EqualValues(t, string(val), data[string(iter.Key())])
+				found = append(found, iter.Key())
+				iter.Next()
+			}
+			assert.Equal(t, 2, len(found))
+			assert.Equal(t, []byte("10"), found[0])
+			return nil
+		}))
+	})
+	t.Run("delete", func(t *testing.T) {
+		assert.Nil(t, db.Tx(kv.TxOpts{IsReadOnly: false}, func(tx kv.Tx) error {
+			for k, _ := range data {
+				assert.Nil(t, tx.Delete(context.Background(), []byte(k)))
+			}
+			for k, _ := range data {
+				bytes, _ := tx.Get(context.Background(), []byte(k))
+				assert.Nil(t, bytes)
+			}
+			return nil
+		}))
+	})
+	t.Run("locker", func(t *testing.T) {
+		lock, err := db.NewLocker([]byte("testing"), 1*time.Second)
+		assert.NoError(t, err)
+		{
+			gotLock, err := lock.TryLock(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, gotLock)
+			is, err := lock.IsLocked(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, is)
+		}
+		{
+			gotLock, err := lock.TryLock(context.Background())
+			assert.NoError(t, err)
+			assert.False(t, gotLock)
+		}
+		{
+			lock.Unlock()
+			assert.NoError(t, err)
+		}
+
+		newLock, err := db.NewLocker([]byte("testing"), 1*time.Second)
+		assert.NoError(t, err)
+		gotLock, err := newLock.TryLock(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, gotLock)
+
+		gotLock, err = lock.TryLock(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, gotLock)
+	})
+	t.Run("set", func(t *testing.T) {
+		assert.Nil(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			for k, v := range data {
+				assert.Nil(t, tx.Set(context.Background(), []byte(k), []byte(v)))
+			}
+			for k, _ := range data {
+				_, err := tx.Get(context.Background(), []byte(k))
+				assert.NoError(t, err)
+			}
+			return nil
+		}))
+	})
+	t.Run("new tx", func(t *testing.T) {
+		tx, err := db.NewTx(kv.TxOpts{})
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, tx.Commit(context.Background()))
+		}()
+		for k, v := range data {
+			assert.Nil(t, tx.Set(context.Background(), []byte(k), []byte(v)))
+		}
+		for k, _ := range data {
+			_, err := tx.Get(context.Background(), []byte(k))
+			assert.NoError(t, err)
+		}
+	})
+	t.Run("new tx w/ rollback", func(t *testing.T) {
+		tx, err := db.NewTx(kv.TxOpts{})
+		assert.NoError(t, err)
+		for k, v := range data {
+			assert.Nil(t, tx.Set(context.Background(), []byte(fmt.Sprintf("rollback.%s", k)), []byte(v)))
+		}
+		assert.NoError(t, tx.Rollback(context.Background()))
+		_, err = tx.Get(context.Background(), []byte("rollback.1"))
+		assert.Error(t, err)
+		assert.Nil(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			for k := range data {
+				val, err := tx.Get(context.Background(), []byte(fmt.Sprintf("rollback.%s", k)))
+				assert.NoError(t, err)
+				assert.Empty(t, val)
+			}
+			return nil
+		}))
+	})
+	t.Run("read only", func(t *testing.T) {
+		assert.Error(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			return tx.Set(context.Background(), []byte("readonly"), []byte("readonly"))
+		}))
+	})
+	t.Run("iterate w/ seek", func(t *testing.T) {
+		assert.Nil(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			iter, err := tx.NewIterator(kv.IterOpts{
+				Prefix: []byte("9"),
+				Seek:   []byte("95"),
+			})
+			assert.NoError(t, err)
+			defer iter.Close()
+			var found []string
+			for iter.Valid() {
+				found = append(found, string(iter.Key()))
+				assert.NoError(t, iter.Next())
+			}
+			assert.Equal(t, []string{"95", "96", "97", "98", "99"}, found)
+			return nil
+		}))
+	})
+	t.Run("drop prefix", func(t *testing.T) {
+		{
+			tx, err := db.NewTx(kv.TxOpts{})
+			assert.NoError(t, err)
+			for k, v := range data {
+				assert.Nil(t, tx.Set(context.Background(), []byte(fmt.Sprintf("testing.%s", k)), []byte(v)))
+			}
+			assert.NoError(t, tx.Commit(context.Background()))
+		}
+		assert.NoError(t, db.DropPrefix(context.Background(), []byte("testing.")))
+		count := 0
+		assert.NoError(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			iter, err := tx.NewIterator(kv.IterOpts{Prefix: []byte("testing.")})
+			assert.NoError(t, err)
+			defer iter.Close()
+			for iter.Valid() {
+				_, err = iter.Value()
+				assert.NoError(t, err)
+				count++
+				iter.Next()
+			}
+			return nil
+		}))
+		assert.Equal(t, 0, count)
+	})
+
+}
+
+func TestIsolation(t *testing.T) {
+	ctx := context.Background()
+	t.Run("snapshot", func(t *testing.T) {
+		db := open()
+		assert.Nil(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			return tx.Set(ctx, []byte("snapshot"), []byte("1"))
+		}))
+		reader, err := db.NewTx(kv.TxOpts{IsReadOnly: true})
+		assert.NoError(t, err)
+		defer reader.Close(ctx)
+		assert.Nil(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			return tx.Set(ctx, []byte("snapshot"), []byte("2"))
+		}))
+		val, err := reader.Get(ctx, []byte("snapshot"))
+		assert.NoError(t, err)
+		assert.Equal(t, "1", string(val))
+	})
+	t.Run("read own writes", func(t *testing.T) {
+		db := open()
+		assert.Nil(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			assert.NoError(t, tx.Set(ctx, []byte("own"), []byte("1")))
+			val, err := tx.Get(ctx, []byte("own"))
+			assert.NoError(t, err)
+			assert.Equal(t, "1", string(val))
+			return nil
+		}))
+	})
+	t.Run("conflict", func(t *testing.T) {
+		db := open()
+		tx1, err := db.NewTx(kv.TxOpts{})
+		assert.NoError(t, err)
+		defer tx1.Close(ctx)
+		tx2, err := db.NewTx(kv.TxOpts{})
+		assert.NoError(t, err)
+		defer tx2.Close(ctx)
+		assert.NoError(t, tx1.Set(ctx, []byte("conflict"), []byte("1")))
+		assert.NoError(t, tx2.Set(ctx, []byte("conflict"), []byte("2")))
+		assert.NoError(t, tx1.Commit(ctx))
+		err = tx2.Commit(ctx)
+		assert.Error(t, err)
+		assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+		assert.Nil(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			val, err := tx.Get(ctx, []byte("conflict"))
+			assert.NoError(t, err)
+			assert.Equal(t, "1", string(val))
+			return nil
+		}))
+	})
+}
+
+func TestChangeStream(t *testing.T) {
+	t.Run("change stream set", func(t *testing.T) {
+		db := open()
+		data := map[string]string{}
+		for i := 0; i < 100; i++ {
+			data[fmt.Sprint(i)] = fmt.Sprint(i)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		count := lo.ToPtr(int64(0))
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, db.ChangeStream(ctx, []byte("testing."), func(cdc kv.CDC) (bool, error) {
+				atomic.AddInt64(count, 1)
+				return true, nil
+			}))
+		}()
+		assert.Nil(t, db.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			for k, v := range data {
+				assert.Nil(t, tx.Set(context.Background(), []byte(fmt.Sprintf("testing.%s", k)), []byte(v)))
+			}
+			return nil
+		}))
+		wg.Wait()
+		assert.Equal(t, int64(len(data)), *count)
+	})
+}
+
+func TestConformance(t *testing.T) {
+	kvtest.RunConformance(t, func(t *testing.T) kv.DB {
+		return open()
+	})
+}
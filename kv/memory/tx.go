@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/autom8ter/machine/v4"
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/google/btree"
+)
+
+type memoryTx struct {
+	mu   sync.Mutex
+	opts kv.TxOpts
+	db   *memoryKV
+	// snapshot is a copy-on-write clone of the database taken when the transaction began. Writes are applied to the
+	// snapshot so the transaction can read its own writes
+	snapshot *btree.BTreeG[item]
+	// version is the database version the snapshot was taken at
+	version uint64
+	written map[string]struct{}
+	entries []kv.CDC
+	done    bool
+}
+
+func (m *memoryTx) NewIterator(opts kv.IterOpts) (kv.Iterator, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done {
+		return nil, errors.New(errors.Internal, "memory: transaction has already been committed or rolled back")
+	}
+	// iterate over a clone so writes made while iterating don't affect the iterator
+	return newIterator(m.snapshot.Clone(), opts), nil
+}
+
+func (m *memoryTx) Get(ctx context.Context, key []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done {
+		return nil, errors.New(errors.Internal, "memory: transaction has already been committed or rolled back")
+	}
+	i, ok := m.snapshot.Get(item{key: key})
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte{}, i.value...), nil
+}
+
+func (m *memoryTx) MultiGet(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done {
+		return nil, errors.New(errors.Internal, "memory: transaction has already been committed or rolled back")
+	}
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		if found, ok := m.snapshot.Get(item{key: key}); ok {
+			values[i] = append([]byte{}, found.value...)
+		}
+	}
+	return values, nil
+}
+
+func (m *memoryTx) Set(ctx context.Context, key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.writable(); err != nil {
+		return err
+	}
+	key = append([]byte{}, key...)
+	value = append([]byte{}, value...)
+	m.snapshot.ReplaceOrInsert(item{key: key, value: value})
+	m.written[string(key)] = struct{}{}
+	m.entries = append(m.entries, kv.CDC{
+		Operation: kv.SETOP,
+		Key:       key,
+		Value:     value,
+	})
+	return nil
+}
+
+func (m *memoryTx) Delete(ctx context.Context, key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.writable(); err != nil {
+		return err
+	}
+	key = append([]byte{}, key...)
+	m.snapshot.Delete(item{key: key})
+	m.written[string(key)] = struct{}{}
+	m.entries = append(m.entries, kv.CDC{
+		Operation: kv.DELOP,
+		Key:       key,
+	})
+	return nil
+}
+
+func (m *memoryTx) writable() error {
+	if m.done {
+		return errors.New(errors.Internal, "memory: transaction has already been committed or rolled back")
+	}
+	if m.opts.IsReadOnly {
+		return errors.New(errors.Forbidden, "memory: writes forbidden in read-only transaction")
+	}
+	return nil
+}
+
+func (m *memoryTx) Rollback(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.close()
+	return nil
+}
+
+func (m *memoryTx) Commit(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done {
+		return errors.New(errors.Internal, "memory: transaction has already been committed or rolled back")
+	}
+	entries := m.entries
+	if !m.opts.IsReadOnly && len(entries) > 0 {
+		if err := m.db.commit(m); err != nil {
+			m.close()
+			return err
+		}
+	}
+	m.close()
+	for _, e := range entries {
+		m.db.machine.Publish(ctx, machine.Message{
+			Channel: string(e.Key),
+			Body:    e,
+		})
+	}
+	return nil
+}
+
+func (m *memoryTx) Close(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.close()
+}
+
+func (m *memoryTx) close() {
+	if m.done {
+		return
+	}
+	m.done = true
+	m.entries = nil
+	m.written = nil
+	m.snapshot = nil
+	if !m.opts.IsReadOnly {
+		m.db.release()
+	}
+}
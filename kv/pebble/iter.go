@@ -0,0 +1,52 @@
+package pebble
+
+import (
+	"github.com/autom8ter/myjson/kv"
+	"github.com/cockroachdb/pebble"
+)
+
+type pebbleIterator struct {
+	opts kv.IterOpts
+	iter *pebble.Iterator
+	// onRead is called with each key the iterator returns - it is set for writable transactions to track their reads
+	onRead func(key []byte)
+}
+
+func (p *pebbleIterator) Seek(key []byte) {
+	if p.opts.Reverse {
+		// seek to the last key <= the given key
+		p.iter.SeekLT(append(append([]byte{}, key...), 0x00))
+		return
+	}
+	p.iter.SeekGE(key)
+}
+
+func (p *pebbleIterator) Close() {
+	//nolint:errcheck
+	p.iter.Close()
+}
+
+func (p *pebbleIterator) Valid() bool {
+	return p.iter.Valid()
+}
+
+func (p *pebbleIterator) Key() []byte {
+	key := append([]byte{}, p.iter.Key()...)
+	if p.onRead != nil {
+		p.onRead(key)
+	}
+	return key
+}
+
+func (p *pebbleIterator) Value() ([]byte, error) {
+	return append([]byte{}, p.iter.Value()...), nil
+}
+
+func (p *pebbleIterator) Next() error {
+	if p.opts.Reverse {
+		p.iter.Prev()
+	} else {
+		p.iter.Next()
+	}
+	return p.iter.Error()
+}
@@ -0,0 +1,180 @@
+package pebble
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/autom8ter/machine/v4"
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
+	"github.com/autom8ter/myjson/kv/registry"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/spf13/cast"
+)
+
+func init() {
+	registry.Register("pebble", func(params map[string]interface{}) (kv.DB, error) {
+		return open(params)
+	})
+}
+
+type pebbleKV struct {
+	db *pebble.DB
+	// mu serializes commits of writable transactions
+	mu sync.Mutex
+	// version is incremented every time a writable transaction commits
+	version uint64
+	// versions holds the version each key was last committed at - it is used to detect conflicts
+	versions map[string]uint64
+	// active is the number of open writable transactions
+	active  int
+	machine machine.Machine
+}
+
+// open opens a pebble database. The following params are supported:
+// storage_path - the directory to store data in (in-memory if empty)
+// cache_size - the size of the block cache in bytes (default 8MB)
+// memtable_size - the size of a single memtable in bytes (default 4MB)
+func open(params map[string]interface{}) (kv.DB, error) {
+	storagePath := cast.ToString(params["storage_path"])
+	opts := &pebble.Options{}
+	if storagePath == "" {
+		opts.FS = vfs.NewMem()
+	}
+	if size := cast.ToInt64(params["cache_size"]); size > 0 {
+		cache := pebble.NewCache(size)
+		defer cache.Unref()
+		opts.Cache = cache
+	}
+	if size := cast.ToUint64(params["memtable_size"]); size > 0 {
+		opts.MemTableSize = size
+	}
+	db, err := pebble.Open(storagePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &pebbleKV{
+		db:       db,
+		versions: map[string]uint64{},
+		machine:  machine.New(),
+	}, nil
+}
+
+func (p *pebbleKV) Tx(opts kv.TxOpts, fn func(kv.Tx) error) error {
+	tx, err := p.NewTx(opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Close(context.Background())
+	err = fn(tx)
+	if err != nil {
+		//nolint:errcheck
+		tx.Rollback(context.Background())
+		return err
+	}
+	if err := tx.Commit(context.Background()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *pebbleKV) NewTx(opts kv.TxOpts) (kv.Tx, error) {
+	if opts.IsReadOnly {
+		return &pebbleTx{
+			opts:     opts,
+			snapshot: p.db.NewSnapshot(),
+			db:       p,
+			machine:  p.machine,
+		}, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active++
+	return &pebbleTx{
+		opts:    opts,
+		batch:   p.db.NewIndexedBatch(),
+		db:      p,
+		machine: p.machine,
+		version: p.version,
+		read:    map[string]struct{}{},
+		written: map[string]struct{}{},
+	}, nil
+}
+
+// commit applies the transaction's batch to the database. If any of the keys read or written by the transaction were
+// committed by another transaction after the given transaction started, a conflict error is returned
+func (p *pebbleKV) commit(tx *pebbleTx, writeOpts *pebble.WriteOptions) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !tx.opts.IsBatch {
+		for _, keys := range []map[string]struct{}{tx.read, tx.written} {
+			for key := range keys {
+				if p.versions[key] > tx.version {
+					return errors.New(errors.Conflict, "pebble: transaction conflict on key: %s", key)
+				}
+			}
+		}
+	}
+	if err := tx.batch.Commit(writeOpts); err != nil {
+		return err
+	}
+	p.version++
+	for key := range tx.written {
+		p.versions[key] = p.version
+	}
+	return nil
+}
+
+// release marks a writable transaction as finished
+func (p *pebbleKV) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active--
+	if p.active == 0 {
+		// no open transaction can conflict with previously committed keys
+		p.versions = map[string]uint64{}
+	}
+}
+
+func (p *pebbleKV) Close(ctx context.Context) error {
+	p.machine.Close()
+	if err := p.db.Flush(); err != nil {
+		return err
+	}
+	return p.db.Close()
+}
+
+func (p *pebbleKV) DropPrefix(ctx context.Context, prefix ...[]byte) error {
+	for _, pfx := range prefix {
+		upper := kvutil.NextPrefix(pfx)
+		if len(upper) == 0 {
+			// the prefix is made up entirely of 0xff bytes - there is no exclusive upper bound
+			upper = append(append([]byte{}, pfx...), 0xff)
+		}
+		if err := p.db.DeleteRange(pfx, upper, pebble.Sync); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pebbleKV) NewLocker(key []byte, leaseInterval time.Duration) (kv.Locker, error) {
+	return kvutil.NewLocker(p, key, leaseInterval), nil
+}
+
+func (p *pebbleKV) ChangeStream(ctx context.Context, prefix []byte, fn kv.ChangeStreamHandler) error {
+	return p.machine.Subscribe(ctx, "*", func(ctx context.Context, msg machine.Message) (bool, error) {
+		cdc, ok := msg.Body.(kv.CDC)
+		if !ok {
+			return false, errors.New(errors.Internal, "invalid cdc")
+		}
+		if bytes.HasPrefix(cdc.Key, prefix) {
+			return fn(cdc)
+		}
+		return true, nil
+	})
+}
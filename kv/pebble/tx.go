@@ -0,0 +1,243 @@
+package pebble
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/autom8ter/machine/v4"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
+	"github.com/cockroachdb/pebble"
+)
+
+var errTxDone = fmt.Errorf("pebble: transaction has already been committed or rolled back")
+
+type pebbleTx struct {
+	mu       sync.Mutex
+	opts     kv.TxOpts
+	batch    *pebble.Batch
+	snapshot *pebble.Snapshot
+	db       *pebbleKV
+	machine  machine.Machine
+	entries  []kv.CDC
+	done     bool
+	// version is the database version the writable transaction started at
+	version uint64
+	// read & written hold the keys read & written by the writable transaction - they are checked for conflicts on commit
+	read    map[string]struct{}
+	written map[string]struct{}
+}
+
+type reader interface {
+	Get(key []byte) ([]byte, io.Closer, error)
+	NewIter(o *pebble.IterOptions) (*pebble.Iterator, error)
+}
+
+func (p *pebbleTx) getReader() (reader, error) {
+	if p.done {
+		return nil, errTxDone
+	}
+	if p.snapshot != nil {
+		return p.snapshot, nil
+	}
+	return p.batch, nil
+}
+
+func (p *pebbleTx) NewIterator(kopts kv.IterOpts) (kv.Iterator, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r, err := p.getReader()
+	if err != nil {
+		return nil, err
+	}
+	opts := &pebble.IterOptions{}
+	if len(kopts.Prefix) > 0 {
+		opts.LowerBound = kopts.Prefix
+		if upper := kvutil.NextPrefix(kopts.Prefix); len(upper) > 0 {
+			opts.UpperBound = upper
+		}
+	}
+	if kopts.UpperBound != nil {
+		// pebble upper bounds are exclusive - the smallest key greater than the upper bound is the upper bound + \x00
+		upper := append(append([]byte{}, kopts.UpperBound...), 0x00)
+		if opts.UpperBound == nil || bytes.Compare(upper, opts.UpperBound) < 0 {
+			opts.UpperBound = upper
+		}
+	}
+	iter, err := r.NewIter(opts)
+	if err != nil {
+		return nil, err
+	}
+	i := &pebbleIterator{iter: iter, opts: kopts}
+	if p.batch != nil {
+		i.onRead = p.trackRead
+	}
+	switch {
+	case kopts.Seek != nil:
+		i.Seek(kopts.Seek)
+	case kopts.Reverse:
+		i.iter.Last()
+	default:
+		i.iter.First()
+	}
+	return i, nil
+}
+
+// markRead records a key read by a writable transaction. The caller must hold the transaction's lock
+func (p *pebbleTx) markRead(key []byte) {
+	if p.read != nil {
+		p.read[string(key)] = struct{}{}
+	}
+}
+
+// trackRead records a key read by an iterator of a writable transaction
+func (p *pebbleTx) trackRead(key []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.markRead(key)
+}
+
+func (p *pebbleTx) Get(ctx context.Context, key []byte) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r, err := p.getReader()
+	if err != nil {
+		return nil, err
+	}
+	p.markRead(key)
+	val, closer, err := r.Get(key)
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer closer.Close()
+	return append([]byte{}, val...), nil
+}
+
+func (p *pebbleTx) MultiGet(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r, err := p.getReader()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		p.markRead(key)
+		val, closer, err := r.Get(key)
+		if err != nil {
+			if err == pebble.ErrNotFound {
+				continue
+			}
+			return nil, err
+		}
+		values[i] = append([]byte{}, val...)
+		closer.Close()
+	}
+	return values, nil
+}
+
+func (p *pebbleTx) Set(ctx context.Context, key, value []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done {
+		return errTxDone
+	}
+	if p.batch == nil {
+		return fmt.Errorf("pebble: writes forbidden in read-only transaction")
+	}
+	if err := p.batch.Set(key, value, nil); err != nil {
+		return err
+	}
+	p.written[string(key)] = struct{}{}
+	p.entries = append(p.entries, kv.CDC{
+		Operation: kv.SETOP,
+		Key:       key,
+		Value:     value,
+	})
+	return nil
+}
+
+func (p *pebbleTx) Delete(ctx context.Context, key []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done {
+		return errTxDone
+	}
+	if p.batch == nil {
+		return fmt.Errorf("pebble: writes forbidden in read-only transaction")
+	}
+	if err := p.batch.Delete(key, nil); err != nil {
+		return err
+	}
+	p.written[string(key)] = struct{}{}
+	p.entries = append(p.entries, kv.CDC{
+		Operation: kv.DELOP,
+		Key:       key,
+	})
+	return nil
+}
+
+func (p *pebbleTx) Rollback(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.close()
+	p.entries = []kv.CDC{}
+	return nil
+}
+
+func (p *pebbleTx) Commit(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done {
+		return errTxDone
+	}
+	if p.batch != nil {
+		// batch transactions trade durability for throughput
+		writeOpts := pebble.Sync
+		if p.opts.IsBatch {
+			writeOpts = pebble.NoSync
+		}
+		if err := p.db.commit(p, writeOpts); err != nil {
+			return err
+		}
+	}
+	p.close()
+	for _, e := range p.entries {
+		p.machine.Publish(ctx, machine.Message{
+			Channel: string(e.Key),
+			Body:    e,
+		})
+	}
+	p.entries = []kv.CDC{}
+	return nil
+}
+
+func (p *pebbleTx) Close(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.close()
+}
+
+func (p *pebbleTx) close() {
+	if p.done {
+		return
+	}
+	p.done = true
+	if p.batch != nil {
+		//nolint:errcheck
+		p.batch.Close()
+		p.read = nil
+		p.written = nil
+		p.db.release()
+	}
+	if p.snapshot != nil {
+		//nolint:errcheck
+		p.snapshot.Close()
+	}
+}
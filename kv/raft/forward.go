@@ -0,0 +1,153 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// applyPath is the http path that followers forward commands to
+	applyPath = "/raft/apply"
+	// readIndexPath is the http path that followers fetch the leader's read index from
+	readIndexPath = "/raft/read_index"
+)
+
+// forwarder forwards commands proposed on a follower to the leader
+type forwarder interface {
+	// forward applies the encoded command on the leader. It returns raft.ErrNotLeader if the node is no longer the leader
+	forward(ctx context.Context, leader raft.ServerID, cmd []byte) (*result, error)
+	// readIndex returns the read index of the leader. It returns raft.ErrNotLeader if the node is no longer the leader
+	readIndex(ctx context.Context, leader raft.ServerID) (uint64, error)
+}
+
+// forwardResponse is the http response of a forwarded command
+type forwardResponse struct {
+	Result *result `json:"result,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// handler serves commands & read index requests forwarded from followers
+func (r *raftKV) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(applyPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		cmd, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			//nolint:errcheck
+			json.NewEncoder(w).Encode(forwardResponse{Error: err.Error()})
+			return
+		}
+		if r.raft.State() != raft.Leader {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			//nolint:errcheck
+			json.NewEncoder(w).Encode(forwardResponse{Error: raft.ErrNotLeader.Error()})
+			return
+		}
+		res, err := r.applyLocal(req.Context(), cmd)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if err == raft.ErrNotLeader {
+				status = http.StatusServiceUnavailable
+			}
+			w.WriteHeader(status)
+			//nolint:errcheck
+			json.NewEncoder(w).Encode(forwardResponse{Error: err.Error()})
+			return
+		}
+		//nolint:errcheck
+		json.NewEncoder(w).Encode(forwardResponse{Result: res})
+	})
+	mux.HandleFunc(readIndexPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.raft.State() != raft.Leader {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			//nolint:errcheck
+			json.NewEncoder(w).Encode(forwardResponse{Error: raft.ErrNotLeader.Error()})
+			return
+		}
+		index, err := r.readIndex()
+		if err != nil {
+			status := http.StatusInternalServerError
+			if err == raft.ErrNotLeader {
+				status = http.StatusServiceUnavailable
+			}
+			w.WriteHeader(status)
+			//nolint:errcheck
+			json.NewEncoder(w).Encode(forwardResponse{Error: err.Error()})
+			return
+		}
+		//nolint:errcheck
+		json.NewEncoder(w).Encode(forwardResponse{Result: &result{Index: index}})
+	})
+	return mux
+}
+
+// httpForwarder forwards commands to the http address of the leader
+type httpForwarder struct {
+	client *http.Client
+	addrs  map[raft.ServerID]string
+}
+
+func newHTTPForwarder(addrs map[raft.ServerID]string) *httpForwarder {
+	return &httpForwarder{
+		client: http.DefaultClient,
+		addrs:  addrs,
+	}
+}
+
+func (h *httpForwarder) forward(ctx context.Context, leader raft.ServerID, cmd []byte) (*result, error) {
+	return h.do(ctx, leader, http.MethodPost, applyPath, cmd)
+}
+
+func (h *httpForwarder) readIndex(ctx context.Context, leader raft.ServerID) (uint64, error) {
+	res, err := h.do(ctx, leader, http.MethodGet, readIndexPath, nil)
+	if err != nil {
+		return 0, err
+	}
+	return res.Index, nil
+}
+
+// do sends a request to the http address of the leader & decodes its result
+func (h *httpForwarder) do(ctx context.Context, leader raft.ServerID, method, path string, body []byte) (*result, error) {
+	addr := h.addrs[leader]
+	if addr == "" {
+		return nil, errors.New(errors.Internal, "raft: leader %s has no http address", leader)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("http://%s%s", addr, path), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, errors.Internal, "raft: failed to forward request")
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.Internal, "raft: failed to forward request to leader %s", leader)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		return nil, raft.ErrNotLeader
+	}
+	var res forwardResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, errors.Internal, "raft: failed to decode forwarded response")
+	}
+	if res.Error != "" {
+		return nil, errors.New(errors.Internal, "raft: leader %s: %s", leader, res.Error)
+	}
+	if res.Result == nil {
+		return nil, errors.New(errors.Internal, "raft: leader %s returned an empty response", leader)
+	}
+	return res.Result, nil
+}
@@ -0,0 +1,371 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// conflictWindow is the number of log entries that key versions are retained for. Transactions that began more than
+	// conflictWindow entries before they are applied are rejected as conflicts since their writes can no longer be checked
+	conflictWindow = 10000
+	// pruneInterval is the number of log entries between pruning key versions that fall outside of the conflict window
+	pruneInterval = 1000
+	// restoreBatchSize is the number of key value pairs written per transaction when restoring a snapshot
+	restoreBatchSize = 1000
+)
+
+// opType is the type of a replicated command
+type opType string
+
+const (
+	opCommit     opType = "commit"
+	opDropPrefix opType = "drop_prefix"
+	opLock       opType = "lock"
+	opUnlock     opType = "unlock"
+)
+
+// command is an entry in the raft log. Commands are applied to the local storage of every node in log order
+type command struct {
+	Op opType `json:"op"`
+	// Entries are the writes of a committed transaction
+	Entries []kv.CDC `json:"entries,omitempty"`
+	// Version is the log index the transaction's snapshot was taken at - it is used to detect write conflicts
+	Version uint64 `json:"version,omitempty"`
+	// IsBatch disables conflict detection
+	IsBatch bool `json:"isBatch,omitempty"`
+	// Prefixes are the prefixes to drop
+	Prefixes [][]byte `json:"prefixes,omitempty"`
+	// Lock is the lease to acquire, renew or release
+	Lock *lockMeta `json:"lock,omitempty"`
+	// Lease is the lease interval of the lock
+	Lease time.Duration `json:"lease,omitempty"`
+}
+
+// result is the response of applying a command
+type result struct {
+	// Index is the log index the command was applied at
+	Index uint64 `json:"index"`
+	// Acquired is true if a lock command acquired or renewed its lease
+	Acquired bool `json:"acquired,omitempty"`
+	// Conflict is the key that caused a commit to be rejected
+	Conflict []byte `json:"conflict,omitempty"`
+	// Err is set if the command failed to apply
+	Err string `json:"err,omitempty"`
+}
+
+// fsm applies replicated commands to the local storage engine. Every decision made while applying a command (conflicts,
+// lock leases) only depends on the log so that every node reaches the same state
+type fsm struct {
+	mu      sync.Mutex
+	storage kv.DB
+	// applied is the index of the last applied log entry
+	applied uint64
+	// versions holds the log index each key was last written at - it is used to detect write conflicts
+	versions map[string]uint64
+}
+
+func newFSM(storage kv.DB) *fsm {
+	return &fsm{
+		storage:  storage,
+		versions: map[string]uint64{},
+	}
+}
+
+// appliedIndex returns the index of the last applied log entry
+func (f *fsm) appliedIndex() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.applied
+}
+
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := &result{Index: l.Index}
+	var cmd command
+	if err := json.Unmarshal(l.Data, &cmd); err != nil {
+		res.Err = errors.Wrap(err, errors.Internal, "raft: failed to decode command").Error()
+	} else if err := f.apply(l.Index, cmd, res); err != nil {
+		res.Err = err.Error()
+	}
+	f.applied = l.Index
+	if l.Index%pruneInterval == 0 {
+		f.prune()
+	}
+	return res
+}
+
+func (f *fsm) apply(index uint64, cmd command, res *result) error {
+	ctx := context.Background()
+	switch cmd.Op {
+	case opCommit:
+		if !cmd.IsBatch {
+			if index > conflictWindow && cmd.Version < index-conflictWindow {
+				res.Conflict = cmd.Entries[0].Key
+				return nil
+			}
+			for _, e := range cmd.Entries {
+				if f.versions[string(e.Key)] > cmd.Version {
+					res.Conflict = e.Key
+					return nil
+				}
+			}
+		}
+		if err := f.storage.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+			for _, e := range cmd.Entries {
+				switch e.Operation {
+				case kv.SETOP:
+					if err := tx.Set(ctx, e.Key, e.Value); err != nil {
+						return err
+					}
+				case kv.DELOP:
+					if err := tx.Delete(ctx, e.Key); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, e := range cmd.Entries {
+			f.versions[string(e.Key)] = index
+		}
+	case opDropPrefix:
+		if err := f.storage.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+			for _, pfx := range cmd.Prefixes {
+				iter, err := tx.NewIterator(kv.IterOpts{Prefix: pfx})
+				if err != nil {
+					return err
+				}
+				for iter.Valid() {
+					f.versions[string(iter.Key())] = index
+					if err := iter.Next(); err != nil {
+						iter.Close()
+						return err
+					}
+				}
+				iter.Close()
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		return f.storage.DropPrefix(ctx, cmd.Prefixes...)
+	case opLock, opUnlock:
+		if cmd.Lock == nil {
+			return errors.New(errors.Validation, "raft: lock command is missing a lock")
+		}
+		return f.storage.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+			val, err := tx.Get(ctx, cmd.Lock.Key)
+			if err != nil {
+				return err
+			}
+			var current *lockMeta
+			if val != nil {
+				current = &lockMeta{}
+				//nolint:errcheck
+				json.Unmarshal(val, current)
+			}
+			if cmd.Op == opUnlock {
+				if current != nil && current.ID == cmd.Lock.ID {
+					f.versions[string(cmd.Lock.Key)] = index
+					return tx.Delete(ctx, cmd.Lock.Key)
+				}
+				return nil
+			}
+			// lease expiry is evaluated against the time the command was proposed so that every node makes the same decision
+			switch {
+			case current == nil:
+			case current.ID == cmd.Lock.ID:
+				cmd.Lock.Start = current.Start
+			case cmd.Lock.LastUpdate.Sub(current.LastUpdate) > 4*cmd.Lease:
+			default:
+				return nil
+			}
+			bits, _ := json.Marshal(cmd.Lock)
+			res.Acquired = true
+			f.versions[string(cmd.Lock.Key)] = index
+			return tx.Set(ctx, cmd.Lock.Key, bits)
+		})
+	default:
+		return errors.New(errors.Validation, "raft: unsupported command: %s", cmd.Op)
+	}
+	return nil
+}
+
+// prune removes key versions that fall outside of the conflict window
+func (f *fsm) prune() {
+	if f.applied <= conflictWindow {
+		return
+	}
+	for key, version := range f.versions {
+		if version < f.applied-conflictWindow {
+			delete(f.versions, key)
+		}
+	}
+}
+
+// snapshotHeader is the first record of a snapshot
+type snapshotHeader struct {
+	Applied  uint64            `json:"applied"`
+	Versions map[string]uint64 `json:"versions"`
+}
+
+// snapshotRecord is a key value pair in a snapshot
+type snapshotRecord struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tx, err := f.storage.NewTx(kv.TxOpts{IsReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]uint64, len(f.versions))
+	for k, v := range f.versions {
+		versions[k] = v
+	}
+	return &fsmSnapshot{
+		tx: tx,
+		header: snapshotHeader{
+			Applied:  f.applied,
+			Versions: versions,
+		},
+	}, nil
+}
+
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	ctx := context.Background()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dec := json.NewDecoder(rc)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return errors.Wrap(err, errors.Internal, "raft: failed to decode snapshot header")
+	}
+	if err := f.clear(ctx); err != nil {
+		return err
+	}
+	for done := false; !done; {
+		if err := f.storage.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+			for i := 0; i < restoreBatchSize; i++ {
+				var record snapshotRecord
+				if err := dec.Decode(&record); err != nil {
+					if err == io.EOF {
+						done = true
+						return nil
+					}
+					return errors.Wrap(err, errors.Internal, "raft: failed to decode snapshot record")
+				}
+				if err := tx.Set(ctx, record.Key, record.Value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	f.applied = header.Applied
+	f.versions = header.Versions
+	if f.versions == nil {
+		f.versions = map[string]uint64{}
+	}
+	return nil
+}
+
+// clear deletes every key from the local storage
+func (f *fsm) clear(ctx context.Context) error {
+	var existing [][]byte
+	if err := f.storage.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		iter, err := tx.NewIterator(kv.IterOpts{})
+		if err != nil {
+			return err
+		}
+		defer iter.Close()
+		for iter.Valid() {
+			existing = append(existing, append([]byte{}, iter.Key()...))
+			if err := iter.Next(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for len(existing) > 0 {
+		batch := existing
+		if len(batch) > restoreBatchSize {
+			batch = batch[:restoreBatchSize]
+		}
+		existing = existing[len(batch):]
+		if err := f.storage.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+			for _, key := range batch {
+				if err := tx.Delete(ctx, key); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fsmSnapshot is a point in time copy of the local storage
+type fsmSnapshot struct {
+	tx     kv.Tx
+	header snapshotHeader
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := s.persist(sink); err != nil {
+		//nolint:errcheck
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) persist(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(s.header); err != nil {
+		return err
+	}
+	iter, err := s.tx.NewIterator(kv.IterOpts{})
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	for iter.Valid() {
+		value, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(snapshotRecord{Key: iter.Key(), Value: value}); err != nil {
+			return err
+		}
+		if err := iter.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fsmSnapshot) Release() {
+	s.tx.Close(context.Background())
+}
@@ -0,0 +1,119 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/autom8ter/myjson/kv"
+)
+
+// raftLock is a lease lock whose state is replicated through the raft log. Leases are acquired, renewed & released by the
+// fsm so that only one node can hold a lock at a time
+type raftLock struct {
+	id            string
+	key           []byte
+	db            *raftKV
+	leaseInterval time.Duration
+	start         time.Time
+	hasUnlocked   chan struct{}
+	unlock        chan struct{}
+}
+
+type lockMeta struct {
+	ID         string    `json:"id"`
+	Start      time.Time `json:"start"`
+	LastUpdate time.Time `json:"lastUpdate"`
+	Key        []byte    `json:"key"`
+}
+
+// IsLocked reads the lock from the local replica once it has caught up with the leader
+func (p *raftLock) IsLocked(ctx context.Context) (bool, error) {
+	if err := p.db.readBarrier(ctx); err != nil {
+		return false, err
+	}
+	isLocked := true
+	err := p.db.storage.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		val, err := tx.Get(ctx, p.key)
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			isLocked = false
+			return nil
+		}
+		var current lockMeta
+		//nolint:errcheck
+		json.Unmarshal(val, &current)
+		if time.Since(current.LastUpdate) > 4*p.leaseInterval && current.ID != p.id {
+			isLocked = false
+			return nil
+		}
+		return nil
+	})
+	return isLocked, err
+}
+
+func (p *raftLock) TryLock(ctx context.Context) (bool, error) {
+	p.start = time.Now()
+	gotLock, err := p.setLock(ctx)
+	if err == nil && gotLock {
+		//nolint:errcheck
+		go p.keepalive(ctx)
+	}
+	return gotLock, err
+}
+
+func (p *raftLock) Unlock() {
+	p.unlock <- struct{}{}
+	<-p.hasUnlocked
+}
+
+// setLock acquires or renews the lease
+func (p *raftLock) setLock(ctx context.Context) (bool, error) {
+	res, err := p.db.propose(ctx, command{
+		Op: opLock,
+		Lock: &lockMeta{
+			ID:         p.id,
+			Start:      p.start,
+			LastUpdate: time.Now(),
+			Key:        p.key,
+		},
+		Lease: p.leaseInterval,
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.Acquired, nil
+}
+
+func (p *raftLock) delLock(ctx context.Context) error {
+	_, err := p.db.propose(ctx, command{
+		Op: opUnlock,
+		Lock: &lockMeta{
+			ID:  p.id,
+			Key: p.key,
+		},
+	})
+	return err
+}
+
+func (p *raftLock) keepalive(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ticker := time.NewTicker(p.leaseInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// update lease
+			if _, err := p.setLock(ctx); err != nil {
+				return err
+			}
+		case <-p.unlock:
+			err := p.delLock(ctx)
+			p.hasUnlocked <- struct{}{}
+			return err
+		}
+	}
+}
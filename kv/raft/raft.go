@@ -0,0 +1,449 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	// the memory provider is the default storage engine
+	_ "github.com/autom8ter/myjson/kv/memory"
+	"github.com/autom8ter/myjson/kv/registry"
+	"github.com/hashicorp/raft"
+	"github.com/segmentio/ksuid"
+	"github.com/spf13/cast"
+)
+
+const (
+	defaultApplyTimeout = 10 * time.Second
+	// retryInterval is the interval between attempts to apply a command while the cluster has no leader
+	retryInterval = 10 * time.Millisecond
+)
+
+func init() {
+	registry.Register("raft", func(params map[string]interface{}) (kv.DB, error) {
+		cfg, err := configFromParams(params)
+		if err != nil {
+			return nil, err
+		}
+		db, err := open(cfg)
+		if err != nil {
+			cfg.close()
+			return nil, err
+		}
+		return db, nil
+	})
+}
+
+// config configures a raft node
+type config struct {
+	nodeID raft.ServerID
+	// raft overrides the default raft configuration
+	raft      *raft.Config
+	transport raft.Transport
+	// storage holds the replicated state of the node
+	storage kv.DB
+	// logs holds the raft log & stable state of the node
+	logs      kv.DB
+	snapshots raft.SnapshotStore
+	// servers is the initial cluster configuration - it is only used if bootstrap is true
+	servers   []raft.Server
+	bootstrap bool
+	forwarder forwarder
+	// httpAddr is the address that commands forwarded from followers are served on (optional)
+	httpAddr     string
+	applyTimeout time.Duration
+	// staleReads serves read-only transactions from the local replica without a read barrier
+	staleReads bool
+}
+
+// configFromParams builds a node configuration from registry params:
+//
+//	node_id: the unique id of the node (required)
+//	raft_addr: the address the raft transport binds to (required)
+//	http_addr: the address forwarded writes are served on - every node that may become leader should set it
+//	peers: the other members of the cluster by node id - ex: {"node2": {"raft_addr": "...", "http_addr": "..."}}
+//	bootstrap: bootstrap a new cluster from the node & its peers if the node has no existing state
+//	storage_provider: the registered provider that holds the replicated state (default: memory). The params are passed through
+//	log_provider: the registered provider that holds the raft log (default: memory)
+//	log_params: the params passed to the log provider
+//	snapshot_dir: the directory snapshots are stored in (default: in memory)
+//	apply_timeout: the maximum duration to wait for a command to be applied (default: 10s)
+//	stale_reads: serve read-only transactions from the local replica without confirming it has caught up with the leader
+func configFromParams(params map[string]interface{}) (*config, error) {
+	nodeID := cast.ToString(params["node_id"])
+	if nodeID == "" {
+		return nil, errors.New(errors.Validation, "raft: 'node_id' is required")
+	}
+	raftAddr := cast.ToString(params["raft_addr"])
+	if raftAddr == "" {
+		return nil, errors.New(errors.Validation, "raft: 'raft_addr' is required")
+	}
+	cfg := &config{
+		nodeID:       raft.ServerID(nodeID),
+		bootstrap:    cast.ToBool(params["bootstrap"]),
+		httpAddr:     cast.ToString(params["http_addr"]),
+		applyTimeout: cast.ToDuration(params["apply_timeout"]),
+		staleReads:   cast.ToBool(params["stale_reads"]),
+	}
+	httpAddrs := map[raft.ServerID]string{
+		cfg.nodeID: cfg.httpAddr,
+	}
+	cfg.servers = append(cfg.servers, raft.Server{
+		ID:      cfg.nodeID,
+		Address: raft.ServerAddress(raftAddr),
+	})
+	for id, peer := range cast.ToStringMap(params["peers"]) {
+		peer := cast.ToStringMapString(peer)
+		if peer["raft_addr"] == "" {
+			return nil, errors.New(errors.Validation, "raft: peer %s is missing a 'raft_addr'", id)
+		}
+		cfg.servers = append(cfg.servers, raft.Server{
+			ID:      raft.ServerID(id),
+			Address: raft.ServerAddress(peer["raft_addr"]),
+		})
+		httpAddrs[raft.ServerID(id)] = peer["http_addr"]
+	}
+	cfg.forwarder = newHTTPForwarder(httpAddrs)
+	if dir := cast.ToString(params["snapshot_dir"]); dir != "" {
+		snapshots, err := raft.NewFileSnapshotStore(dir, 2, os.Stderr)
+		if err != nil {
+			return nil, errors.Wrap(err, errors.Internal, "raft: failed to open snapshot store")
+		}
+		cfg.snapshots = snapshots
+	} else {
+		cfg.snapshots = raft.NewInmemSnapshotStore()
+	}
+	storageProvider := cast.ToString(params["storage_provider"])
+	if storageProvider == "" {
+		storageProvider = "memory"
+	}
+	logProvider := cast.ToString(params["log_provider"])
+	if logProvider == "" {
+		logProvider = "memory"
+	}
+	if storageProvider == "raft" || logProvider == "raft" {
+		return nil, errors.New(errors.Validation, "raft: the raft provider cannot be used as its own storage")
+	}
+	var err error
+	cfg.storage, err = registry.Open(storageProvider, params)
+	if err != nil {
+		return nil, err
+	}
+	cfg.logs, err = registry.Open(logProvider, cast.ToStringMap(params["log_params"]))
+	if err != nil {
+		cfg.close()
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransport(raftAddr, nil, 3, 10*time.Second, os.Stderr)
+	if err != nil {
+		cfg.close()
+		return nil, errors.Wrap(err, errors.Internal, "raft: failed to open transport")
+	}
+	cfg.transport = transport
+	return cfg, nil
+}
+
+// close closes the resources of a config that failed to open
+func (c *config) close() {
+	ctx := context.Background()
+	if c.storage != nil {
+		//nolint:errcheck
+		c.storage.Close(ctx)
+	}
+	if c.logs != nil {
+		//nolint:errcheck
+		c.logs.Close(ctx)
+	}
+	if closer, ok := c.transport.(io.Closer); ok {
+		//nolint:errcheck
+		closer.Close()
+	}
+}
+
+// raftKV replicates commits through a raft log. Every node applies the log to its local storage - reads are served by
+// the local replica while writes are forwarded to the leader
+type raftKV struct {
+	cfg     *config
+	raft    *raft.Raft
+	fsm     *fsm
+	storage kv.DB
+	server  *http.Server
+	// barrierMu guards barrierTerm
+	barrierMu sync.Mutex
+	// barrierTerm is the last term the node applied a barrier in as the leader
+	barrierTerm string
+}
+
+func open(cfg *config) (*raftKV, error) {
+	if cfg.applyTimeout == 0 {
+		cfg.applyTimeout = defaultApplyTimeout
+	}
+	conf := cfg.raft
+	if conf == nil {
+		conf = raft.DefaultConfig()
+		conf.LogLevel = "ERROR"
+	}
+	conf.LocalID = cfg.nodeID
+	f := newFSM(cfg.storage)
+	// the local replica is rebuilt from the latest snapshot & the raft log
+	if err := f.clear(context.Background()); err != nil {
+		return nil, err
+	}
+	stores := newLogStore(cfg.logs)
+	if cfg.bootstrap {
+		hasState, err := raft.HasExistingState(stores, stores, cfg.snapshots)
+		if err != nil {
+			return nil, errors.Wrap(err, errors.Internal, "raft: failed to check existing state")
+		}
+		if !hasState {
+			if err := raft.BootstrapCluster(conf, stores, stores, cfg.snapshots, cfg.transport, raft.Configuration{
+				Servers: cfg.servers,
+			}); err != nil {
+				return nil, errors.Wrap(err, errors.Internal, "raft: failed to bootstrap cluster")
+			}
+		}
+	}
+	r, err := raft.NewRaft(conf, f, stores, stores, cfg.snapshots, cfg.transport)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.Internal, "raft: failed to start node")
+	}
+	db := &raftKV{
+		cfg:     cfg,
+		raft:    r,
+		fsm:     f,
+		storage: cfg.storage,
+	}
+	if cfg.httpAddr != "" {
+		db.server = &http.Server{Addr: cfg.httpAddr, Handler: db.handler()}
+		go func() {
+			//nolint:errcheck
+			db.server.ListenAndServe()
+		}()
+	}
+	return db, nil
+}
+
+func (r *raftKV) Tx(opts kv.TxOpts, fn func(kv.Tx) error) error {
+	tx, err := r.NewTx(opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Close(context.Background())
+	err = fn(tx)
+	if err != nil {
+		//nolint:errcheck
+		tx.Rollback(context.Background())
+		return err
+	}
+	if err := tx.Commit(context.Background()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *raftKV) NewTx(opts kv.TxOpts) (kv.Tx, error) {
+	// batch transactions trade consistency for throughput - they may read data that is stale on this node
+	if !opts.IsBatch && !(opts.IsReadOnly && r.cfg.staleReads) {
+		if err := r.readBarrier(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	// hold the fsm lock so the local transaction is opened at exactly the applied index
+	r.fsm.mu.Lock()
+	defer r.fsm.mu.Unlock()
+	tx, err := r.storage.NewTx(kv.TxOpts{IsReadOnly: opts.IsReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	return &raftTx{
+		opts:    opts,
+		db:      r,
+		tx:      tx,
+		version: r.fsm.applied,
+	}, nil
+}
+
+func (r *raftKV) DropPrefix(ctx context.Context, prefix ...[]byte) error {
+	_, err := r.propose(ctx, command{
+		Op:       opDropPrefix,
+		Prefixes: prefix,
+	})
+	return err
+}
+
+func (r *raftKV) NewLocker(key []byte, leaseInterval time.Duration) (kv.Locker, error) {
+	return &raftLock{
+		id:            ksuid.New().String(),
+		key:           key,
+		db:            r,
+		leaseInterval: leaseInterval,
+		unlock:        make(chan struct{}),
+		hasUnlocked:   make(chan struct{}),
+	}, nil
+}
+
+// ChangeStream streams changes as they are applied to the local replica
+func (r *raftKV) ChangeStream(ctx context.Context, prefix []byte, fn kv.ChangeStreamHandler) error {
+	return r.storage.ChangeStream(ctx, prefix, fn)
+}
+
+func (r *raftKV) Close(ctx context.Context) error {
+	if r.server != nil {
+		//nolint:errcheck
+		r.server.Shutdown(ctx)
+	}
+	if err := r.raft.Shutdown().Error(); err != nil {
+		return err
+	}
+	if closer, ok := r.cfg.transport.(io.Closer); ok {
+		//nolint:errcheck
+		closer.Close()
+	}
+	if err := r.cfg.logs.Close(ctx); err != nil {
+		return err
+	}
+	return r.storage.Close(ctx)
+}
+
+// propose applies a command through the raft log & waits until it has been applied to the local replica so that the
+// node reads its own writes
+func (r *raftKV) propose(ctx context.Context, cmd command) (*result, error) {
+	bits, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.Internal, "raft: failed to encode command")
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.applyTimeout)
+	defer cancel()
+	res, err := r.apply(ctx, bits)
+	if err != nil {
+		return nil, err
+	}
+	if res.Err != "" {
+		return nil, errors.New(errors.Internal, "raft: %s", res.Err)
+	}
+	if err := r.waitApplied(ctx, res.Index); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// waitApplied waits until the log entry at the index has been applied to the local replica
+func (r *raftKV) waitApplied(ctx context.Context, index uint64) error {
+	for r.fsm.appliedIndex() < index {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), errors.Internal, "raft: timed out waiting for command to be applied")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// readBarrier waits until every write that completed before it was called has been applied to the local replica so that
+// transactions don't read stale data. The leader's read index is fetched (followers ask the leader) & waited for without
+// appending to the log. It fails immediately if the cluster has no leader
+func (r *raftKV) readBarrier(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.applyTimeout)
+	defer cancel()
+	var (
+		index uint64
+		err   error
+	)
+	if r.raft.State() == raft.Leader {
+		index, err = r.readIndex()
+	} else if _, leader := r.raft.LeaderWithID(); leader != "" {
+		index, err = r.cfg.forwarder.readIndex(ctx, leader)
+	} else {
+		err = raft.ErrNotLeader
+	}
+	if err == raft.ErrNotLeader {
+		return errors.New(errors.Internal, "raft: no leader available to confirm the read")
+	}
+	if err != nil {
+		return err
+	}
+	return r.waitApplied(ctx, index)
+}
+
+// readIndex returns the index of the last entry applied to the leader's replica. Every completed write was applied on the
+// leader before it returned, so a replica that has applied the read index reads every completed write. Entries committed
+// by a previous leader may not have been applied yet, so a barrier is applied once per term before serving read indexes.
+// It returns raft.ErrNotLeader if the node is not the leader
+func (r *raftKV) readIndex() (uint64, error) {
+	r.barrierMu.Lock()
+	term := r.raft.Stats()["term"]
+	if r.barrierTerm != term {
+		if err := r.raft.Barrier(r.cfg.applyTimeout).Error(); err != nil {
+			r.barrierMu.Unlock()
+			return 0, leadershipError(err)
+		}
+		r.barrierTerm = term
+	}
+	r.barrierMu.Unlock()
+	index := r.fsm.appliedIndex()
+	// confirm the node is still the leader after reading the index - otherwise a newer leader may have completed writes
+	if err := r.raft.VerifyLeader().Error(); err != nil {
+		return 0, leadershipError(err)
+	}
+	return index, nil
+}
+
+// leadershipError converts errors caused by losing the leadership into raft.ErrNotLeader
+func leadershipError(err error) error {
+	if err == raft.ErrNotLeader || err == raft.ErrLeadershipLost {
+		return raft.ErrNotLeader
+	}
+	return errors.Wrap(err, errors.Internal, "raft: failed to confirm leadership")
+}
+
+// apply applies an encoded command on the leader. Commands proposed on a follower are forwarded to the leader
+func (r *raftKV) apply(ctx context.Context, cmd []byte) (*result, error) {
+	for {
+		var (
+			res *result
+			err error
+		)
+		if r.raft.State() == raft.Leader {
+			res, err = r.applyLocal(ctx, cmd)
+		} else if _, leader := r.raft.LeaderWithID(); leader != "" {
+			res, err = r.cfg.forwarder.forward(ctx, leader, cmd)
+		} else {
+			err = raft.ErrNotLeader
+		}
+		// the command is only retried if it was never appended to the log
+		if err != raft.ErrNotLeader {
+			return res, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), errors.Internal, "raft: no leader available")
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// applyLocal applies an encoded command on this node - it must be the leader
+func (r *raftKV) applyLocal(ctx context.Context, cmd []byte) (*result, error) {
+	timeout := r.cfg.applyTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	future := r.raft.Apply(cmd, timeout)
+	if err := future.Error(); err != nil {
+		if err == raft.ErrNotLeader {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, errors.Internal, "raft: failed to apply command")
+	}
+	res, ok := future.Response().(*result)
+	if !ok {
+		return nil, errors.New(errors.Internal, "raft: unexpected apply response")
+	}
+	return res, nil
+}
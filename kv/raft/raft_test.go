@@ -0,0 +1,352 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvtest"
+	"github.com/autom8ter/myjson/kv/registry"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/assert"
+)
+
+// localForwarder forwards commands to the leader in process
+type localForwarder struct {
+	nodes map[raft.ServerID]*raftKV
+}
+
+func (l *localForwarder) forward(ctx context.Context, leader raft.ServerID, cmd []byte) (*result, error) {
+	node, ok := l.nodes[leader]
+	if !ok || node.raft.State() != raft.Leader {
+		return nil, raft.ErrNotLeader
+	}
+	return node.applyLocal(ctx, cmd)
+}
+
+func (l *localForwarder) readIndex(ctx context.Context, leader raft.ServerID) (uint64, error) {
+	node, ok := l.nodes[leader]
+	if !ok || node.raft.State() != raft.Leader {
+		return 0, raft.ErrNotLeader
+	}
+	return node.readIndex()
+}
+
+func testConfig() *raft.Config {
+	conf := raft.DefaultConfig()
+	conf.HeartbeatTimeout = 50 * time.Millisecond
+	conf.ElectionTimeout = 50 * time.Millisecond
+	conf.LeaderLeaseTimeout = 50 * time.Millisecond
+	conf.CommitTimeout = 5 * time.Millisecond
+	conf.TrailingLogs = 1
+	conf.LogLevel = "ERROR"
+	return conf
+}
+
+// cluster is a set of raft nodes connected by in memory transports
+type cluster struct {
+	t          *testing.T
+	nodes      []*raftKV
+	transports []*raft.InmemTransport
+	forwarder  forwarder
+	local      *localForwarder
+}
+
+// newCluster starts a cluster of the given size. If useHTTP is true, commands are forwarded to the leader over http
+func newCluster(t *testing.T, size int, useHTTP bool) *cluster {
+	c := &cluster{
+		t:     t,
+		local: &localForwarder{nodes: map[raft.ServerID]*raftKV{}},
+	}
+	c.forwarder = c.local
+	httpAddrs := map[raft.ServerID]string{}
+	if useHTTP {
+		c.forwarder = newHTTPForwarder(httpAddrs)
+	}
+	var servers []raft.Server
+	for i := 0; i < size; i++ {
+		addr, transport := raft.NewInmemTransport("")
+		for _, other := range c.transports {
+			other.Connect(addr, transport)
+			transport.Connect(other.LocalAddr(), other)
+		}
+		c.transports = append(c.transports, transport)
+		servers = append(servers, raft.Server{
+			ID:      raft.ServerID(fmt.Sprintf("node%d", i)),
+			Address: addr,
+		})
+	}
+	for i := 0; i < size; i++ {
+		node := c.open(servers[i].ID, c.transports[i], servers, i == 0)
+		if useHTTP {
+			server := httptest.NewServer(node.handler())
+			t.Cleanup(server.Close)
+			httpAddrs[servers[i].ID] = strings.TrimPrefix(server.URL, "http://")
+		}
+	}
+	c.leader()
+	return c
+}
+
+func (c *cluster) open(id raft.ServerID, transport raft.Transport, servers []raft.Server, bootstrap bool) *raftKV {
+	storage, err := registry.Open("memory", nil)
+	assert.NoError(c.t, err)
+	logs, err := registry.Open("memory", nil)
+	assert.NoError(c.t, err)
+	node, err := open(&config{
+		nodeID:    id,
+		raft:      testConfig(),
+		transport: transport,
+		storage:   storage,
+		logs:      logs,
+		snapshots: raft.NewInmemSnapshotStore(),
+		servers:   servers,
+		bootstrap: bootstrap,
+		forwarder: c.forwarder,
+	})
+	if !assert.NoError(c.t, err) {
+		c.t.FailNow()
+	}
+	c.nodes = append(c.nodes, node)
+	c.local.nodes[id] = node
+	return node
+}
+
+// leader waits for a leader to be elected & returns it
+func (c *cluster) leader() *raftKV {
+	var leader *raftKV
+	assert.Eventually(c.t, func() bool {
+		for _, node := range c.nodes {
+			if node.raft.State() == raft.Leader {
+				leader = node
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	return leader
+}
+
+// follower returns a node that isn't the leader
+func (c *cluster) follower() *raftKV {
+	leader := c.leader()
+	for _, node := range c.nodes {
+		if node != leader {
+			return node
+		}
+	}
+	return nil
+}
+
+// close closes every node except the given ones
+func (c *cluster) close(except ...*raftKV) {
+	for _, node := range c.nodes {
+		closed := true
+		for _, e := range except {
+			if node == e {
+				closed = false
+			}
+		}
+		if closed {
+			assert.NoError(c.t, node.Close(context.Background()))
+		}
+	}
+}
+
+func get(t *testing.T, db kv.DB, key string) string {
+	var val []byte
+	assert.NoError(t, db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		var err error
+		val, err = tx.Get(context.Background(), []byte(key))
+		return err
+	}))
+	return string(val)
+}
+
+func TestConformance(t *testing.T) {
+	kvtest.RunConformance(t, func(t *testing.T) kv.DB {
+		c := newCluster(t, 3, false)
+		follower := c.follower()
+		t.Cleanup(func() {
+			c.close(follower)
+		})
+		return follower
+	})
+}
+
+func TestReplication(t *testing.T) {
+	ctx := context.Background()
+	t.Run("follower writes are replicated", func(t *testing.T) {
+		c := newCluster(t, 3, false)
+		defer c.close()
+		follower := c.follower()
+		assert.NoError(t, follower.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			return tx.Set(ctx, []byte("replicated"), []byte("1"))
+		}))
+		// the writer reads its own writes as soon as the commit returns
+		assert.Equal(t, "1", get(t, follower, "replicated"))
+		for _, node := range c.nodes {
+			node := node
+			assert.Eventually(t, func() bool {
+				return get(t, node, "replicated") == "1"
+			}, 5*time.Second, 10*time.Millisecond)
+		}
+	})
+	t.Run("followers read the latest committed writes", func(t *testing.T) {
+		c := newCluster(t, 3, false)
+		defer c.close()
+		leader := c.leader()
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, leader.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+				return tx.Set(ctx, []byte("latest"), []byte(fmt.Sprint(i)))
+			}))
+			// the read barrier waits for the follower to apply the write
+			for _, node := range c.nodes {
+				assert.Equal(t, fmt.Sprint(i), get(t, node, "latest"))
+			}
+		}
+	})
+	t.Run("reads fail fast without a leader", func(t *testing.T) {
+		c := newCluster(t, 3, false)
+		follower := c.follower()
+		assert.NoError(t, follower.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			return tx.Set(ctx, []byte("leaderless"), []byte("1"))
+		}))
+		// the remaining node can't elect a leader on its own
+		c.close(follower)
+		defer follower.Close(ctx)
+		assert.Eventually(t, func() bool {
+			_, leader := follower.raft.LeaderWithID()
+			return leader == ""
+		}, 5*time.Second, 10*time.Millisecond)
+		start := time.Now()
+		_, err := follower.NewTx(kv.TxOpts{IsReadOnly: true})
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+		// batch & stale reads are served by the local replica
+		assert.NoError(t, follower.Tx(kv.TxOpts{IsReadOnly: true, IsBatch: true}, func(tx kv.Tx) error {
+			val, err := tx.Get(ctx, []byte("leaderless"))
+			assert.Equal(t, "1", string(val))
+			return err
+		}))
+		follower.cfg.staleReads = true
+		assert.Equal(t, "1", get(t, follower, "leaderless"))
+	})
+	t.Run("writes are forwarded over http", func(t *testing.T) {
+		c := newCluster(t, 3, true)
+		defer c.close()
+		follower := c.follower()
+		assert.NoError(t, follower.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			return tx.Set(ctx, []byte("forwarded"), []byte("1"))
+		}))
+		assert.Equal(t, "1", get(t, follower, "forwarded"))
+		// the read index is fetched from the leader over http
+		for _, node := range c.nodes {
+			assert.Equal(t, "1", get(t, node, "forwarded"))
+		}
+		assert.Eventually(t, func() bool {
+			return get(t, c.leader(), "forwarded") == "1"
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+	t.Run("conflicts are detected across nodes", func(t *testing.T) {
+		c := newCluster(t, 3, false)
+		defer c.close()
+		tx1, err := c.nodes[1].NewTx(kv.TxOpts{})
+		assert.NoError(t, err)
+		defer tx1.Close(ctx)
+		tx2, err := c.nodes[2].NewTx(kv.TxOpts{})
+		assert.NoError(t, err)
+		defer tx2.Close(ctx)
+		assert.NoError(t, tx1.Set(ctx, []byte("conflict"), []byte("1")))
+		assert.NoError(t, tx2.Set(ctx, []byte("conflict"), []byte("2")))
+		assert.NoError(t, tx1.Commit(ctx))
+		err = tx2.Commit(ctx)
+		assert.Error(t, err)
+		assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+		for _, node := range c.nodes {
+			node := node
+			assert.Eventually(t, func() bool {
+				return get(t, node, "conflict") == "1"
+			}, 5*time.Second, 10*time.Millisecond)
+		}
+	})
+	t.Run("drop prefix is replicated", func(t *testing.T) {
+		c := newCluster(t, 3, false)
+		defer c.close()
+		assert.NoError(t, c.nodes[1].Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+			for i := 0; i < 10; i++ {
+				if err := tx.Set(ctx, []byte(fmt.Sprintf("drop.%d", i)), []byte("1")); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+		assert.NoError(t, c.nodes[2].DropPrefix(ctx, []byte("drop.")))
+		for _, node := range c.nodes {
+			node := node
+			assert.Eventually(t, func() bool {
+				return get(t, node, "drop.1") == ""
+			}, 5*time.Second, 10*time.Millisecond)
+		}
+	})
+	t.Run("new nodes catch up from a snapshot", func(t *testing.T) {
+		c := newCluster(t, 3, false)
+		defer c.close()
+		assert.NoError(t, c.nodes[1].Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			return tx.Set(ctx, []byte("snapshot.1"), []byte("1"))
+		}))
+		leader := c.leader()
+		assert.NoError(t, leader.raft.Snapshot().Error())
+		assert.NoError(t, c.nodes[2].Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+			return tx.Set(ctx, []byte("snapshot.2"), []byte("2"))
+		}))
+
+		addr, transport := raft.NewInmemTransport("")
+		for _, other := range c.transports {
+			other.Connect(addr, transport)
+			transport.Connect(other.LocalAddr(), other)
+		}
+		node := c.open("node3", transport, nil, false)
+		assert.NoError(t, leader.raft.AddVoter("node3", addr, 0, 0).Error())
+		assert.Eventually(t, func() bool {
+			return get(t, node, "snapshot.1") == "1" && get(t, node, "snapshot.2") == "2"
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestLocker(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3, false)
+	defer c.close()
+	lock, err := c.nodes[1].NewLocker([]byte("lock"), 100*time.Millisecond)
+	assert.NoError(t, err)
+	gotLock, err := lock.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, gotLock)
+
+	other, err := c.nodes[2].NewLocker([]byte("lock"), 100*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		isLocked, err := other.IsLocked(ctx)
+		return err == nil && isLocked
+	}, 5*time.Second, 10*time.Millisecond)
+	gotLock, err = other.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.False(t, gotLock)
+	// the lease is renewed so the lock is still held after the lease interval
+	time.Sleep(500 * time.Millisecond)
+	gotLock, err = other.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.False(t, gotLock)
+
+	lock.Unlock()
+	gotLock, err = other.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, gotLock)
+	other.Unlock()
+}
@@ -0,0 +1,136 @@
+package raft
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/hashicorp/raft"
+)
+
+var (
+	logPrefix    = []byte("log.")
+	stablePrefix = []byte("stable.")
+)
+
+// logStore is a raft.LogStore & raft.StableStore backed by a kv database
+type logStore struct {
+	db kv.DB
+}
+
+func newLogStore(db kv.DB) *logStore {
+	return &logStore{db: db}
+}
+
+func logKey(index uint64) []byte {
+	key := make([]byte, len(logPrefix)+8)
+	copy(key, logPrefix)
+	binary.BigEndian.PutUint64(key[len(logPrefix):], index)
+	return key
+}
+
+func stableKey(key []byte) []byte {
+	return append(append([]byte{}, stablePrefix...), key...)
+}
+
+// edgeIndex returns the first (or last if reverse is true) log index or 0 if the log is empty
+func (s *logStore) edgeIndex(reverse bool) (uint64, error) {
+	var index uint64
+	err := s.db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		iter, err := tx.NewIterator(kv.IterOpts{Prefix: logPrefix, Reverse: reverse})
+		if err != nil {
+			return err
+		}
+		defer iter.Close()
+		if iter.Valid() {
+			index = binary.BigEndian.Uint64(iter.Key()[len(logPrefix):])
+		}
+		return nil
+	})
+	return index, err
+}
+
+func (s *logStore) FirstIndex() (uint64, error) {
+	return s.edgeIndex(false)
+}
+
+func (s *logStore) LastIndex() (uint64, error) {
+	return s.edgeIndex(true)
+}
+
+func (s *logStore) GetLog(index uint64, log *raft.Log) error {
+	return s.db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		val, err := tx.Get(context.Background(), logKey(index))
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			return raft.ErrLogNotFound
+		}
+		return json.Unmarshal(val, log)
+	})
+}
+
+func (s *logStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+func (s *logStore) StoreLogs(logs []*raft.Log) error {
+	return s.db.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+		for _, log := range logs {
+			bits, err := json.Marshal(log)
+			if err != nil {
+				return errors.Wrap(err, errors.Internal, "raft: failed to encode log")
+			}
+			if err := tx.Set(context.Background(), logKey(log.Index), bits); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *logStore) DeleteRange(min, max uint64) error {
+	return s.db.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+		for i := min; i <= max; i++ {
+			if err := tx.Delete(context.Background(), logKey(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *logStore) Set(key []byte, val []byte) error {
+	return s.db.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+		return tx.Set(context.Background(), stableKey(key), val)
+	})
+}
+
+// Get returns the value of the key or nil if it doesn't exist
+func (s *logStore) Get(key []byte) ([]byte, error) {
+	var val []byte
+	err := s.db.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		var err error
+		val, err = tx.Get(context.Background(), stableKey(key))
+		return err
+	})
+	return val, err
+}
+
+func (s *logStore) SetUint64(key []byte, val uint64) error {
+	bits := make([]byte, 8)
+	binary.BigEndian.PutUint64(bits, val)
+	return s.Set(key, bits)
+}
+
+// GetUint64 returns the value of the key or 0 if it doesn't exist
+func (s *logStore) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err != nil || len(val) != 8 {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
@@ -0,0 +1,143 @@
+package raft
+
+import (
+	"context"
+	"sync"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+)
+
+// raftTx reads from (and buffers its writes in) a local storage transaction that is never committed. On commit, the
+// writes are replicated through the raft log & applied to the local storage of every node. The local transaction is opened
+// after a read barrier, so it reads every write that completed before the transaction began (even on followers)
+type raftTx struct {
+	mu   sync.Mutex
+	opts kv.TxOpts
+	db   *raftKV
+	tx   kv.Tx
+	// version is the log index the local transaction was opened at
+	version uint64
+	entries []kv.CDC
+	done    bool
+}
+
+func (r *raftTx) NewIterator(opts kv.IterOpts) (kv.Iterator, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return nil, errors.New(errors.Internal, "raft: transaction has already been committed or rolled back")
+	}
+	return r.tx.NewIterator(opts)
+}
+
+func (r *raftTx) Get(ctx context.Context, key []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return nil, errors.New(errors.Internal, "raft: transaction has already been committed or rolled back")
+	}
+	return r.tx.Get(ctx, key)
+}
+
+func (r *raftTx) MultiGet(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return nil, errors.New(errors.Internal, "raft: transaction has already been committed or rolled back")
+	}
+	return r.tx.MultiGet(ctx, keys)
+}
+
+func (r *raftTx) Set(ctx context.Context, key, value []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.writable(); err != nil {
+		return err
+	}
+	key = append([]byte{}, key...)
+	value = append([]byte{}, value...)
+	if err := r.tx.Set(ctx, key, value); err != nil {
+		return err
+	}
+	r.entries = append(r.entries, kv.CDC{
+		Operation: kv.SETOP,
+		Key:       key,
+		Value:     value,
+	})
+	return nil
+}
+
+func (r *raftTx) Delete(ctx context.Context, key []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.writable(); err != nil {
+		return err
+	}
+	key = append([]byte{}, key...)
+	if err := r.tx.Delete(ctx, key); err != nil {
+		return err
+	}
+	r.entries = append(r.entries, kv.CDC{
+		Operation: kv.DELOP,
+		Key:       key,
+	})
+	return nil
+}
+
+func (r *raftTx) writable() error {
+	if r.done {
+		return errors.New(errors.Internal, "raft: transaction has already been committed or rolled back")
+	}
+	if r.opts.IsReadOnly {
+		return errors.New(errors.Forbidden, "raft: writes forbidden in read-only transaction")
+	}
+	return nil
+}
+
+// Commit replicates the transaction's writes through the raft log. It returns once the writes have been applied to the
+// local replica so that subsequent transactions on this node read them
+func (r *raftTx) Commit(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return errors.New(errors.Internal, "raft: transaction has already been committed or rolled back")
+	}
+	r.done = true
+	//nolint:errcheck
+	r.tx.Rollback(ctx)
+	if len(r.entries) == 0 {
+		return nil
+	}
+	res, err := r.db.propose(ctx, command{
+		Op:      opCommit,
+		Entries: r.entries,
+		Version: r.version,
+		IsBatch: r.opts.IsBatch,
+	})
+	if err != nil {
+		return err
+	}
+	if res.Conflict != nil {
+		return errors.New(errors.Conflict, "raft: transaction conflict on key: %s", string(res.Conflict))
+	}
+	return nil
+}
+
+func (r *raftTx) Rollback(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return nil
+	}
+	r.done = true
+	r.entries = nil
+	return r.tx.Rollback(ctx)
+}
+
+func (r *raftTx) Close(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = true
+	r.tx.Close(ctx)
+}
@@ -1,6 +1,9 @@
 package registry
 
 import (
+	"context"
+	"strings"
+
 	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/kv"
 )
@@ -8,18 +11,53 @@ import (
 // KVDBOpener opens a key value database
 type KVDBOpener func(params map[string]interface{}) (kv.DB, error)
 
-var registeredOpeners = map[string]KVDBOpener{}
+// KVDBWrapper wraps a key value database with additional functionality (ex: encryption)
+type KVDBWrapper func(db kv.DB, params map[string]interface{}) (kv.DB, error)
+
+var (
+	registeredOpeners  = map[string]KVDBOpener{}
+	registeredWrappers = map[string]KVDBWrapper{}
+)
 
 // Register registers a KVDBOpener opener by name
 func Register(name string, opener KVDBOpener) {
 	registeredOpeners[name] = opener
 }
 
-// Open opens a registered key value database
+// RegisterWrapper registers a KVDBWrapper by name. Wrappers are composed with a provider by joining their names with a '+' (ex: encrypted+badger)
+func RegisterWrapper(name string, wrapper KVDBWrapper) {
+	registeredWrappers[name] = wrapper
+}
+
+// Open opens a registered key value database. The name may be prefixed with registered wrappers separated by a '+' (ex: encrypted+badger).
+// The provider is opened first & then wrapped from right to left. The params are passed to the provider & every wrapper
 func Open(name string, params map[string]interface{}) (kv.DB, error) {
-	opener, ok := registeredOpeners[name]
+	names := strings.Split(name, "+")
+	provider := names[len(names)-1]
+	opener, ok := registeredOpeners[provider]
 	if !ok {
-		return nil, errors.New(errors.NotFound, "%s is not registered", name)
+		return nil, errors.New(errors.NotFound, "%s is not registered", provider)
+	}
+	var wrappers []KVDBWrapper
+	for _, w := range names[:len(names)-1] {
+		wrapper, ok := registeredWrappers[w]
+		if !ok {
+			return nil, errors.New(errors.NotFound, "wrapper %s is not registered", w)
+		}
+		wrappers = append(wrappers, wrapper)
+	}
+	db, err := opener(params)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		wrapped, err := wrappers[i](db, params)
+		if err != nil {
+			//nolint:errcheck
+			db.Close(context.Background())
+			return nil, err
+		}
+		db = wrapped
 	}
-	return opener(params)
+	return db, nil
 }
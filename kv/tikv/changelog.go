@@ -0,0 +1,154 @@
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
+	"github.com/tikv/client-go/v2/oracle"
+	"github.com/tikv/client-go/v2/txnkv/transaction"
+)
+
+// changelogPrefix prefixes the changelog entries that are written by every transaction when redis isn't configured.
+// It sorts after every key written by myjson & iterators never read past it
+var changelogPrefix = []byte("\xff\xffchangelog.")
+
+// changelogKey returns the key of a change - changes are ordered by the start timestamp of their transaction & then by
+// their position in the transaction
+func changelogKey(ts uint64, seq int) []byte {
+	key := make([]byte, len(changelogPrefix)+16)
+	copy(key, changelogPrefix)
+	binary.BigEndian.PutUint64(key[len(changelogPrefix):], ts)
+	binary.BigEndian.PutUint64(key[len(changelogPrefix)+8:], uint64(seq))
+	return key
+}
+
+// writeChangelog records the transaction's changes in the changelog - they are committed atomically with the changes
+func writeChangelog(txn *transaction.KVTxn, entries []kv.CDC) error {
+	for i, e := range entries {
+		bits, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(changelogKey(txn.StartTS(), i), bits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type changelogEntry struct {
+	key []byte
+	ts  uint64
+	cdc kv.CDC
+}
+
+// readChangelog reads every change recorded by transactions that started at or after the given timestamp
+func (b *tikvKV) readChangelog(from uint64) ([]changelogEntry, error) {
+	txn, err := b.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer txn.Rollback()
+	iter, err := txn.Iter(changelogKey(from, 0), kvutil.NextPrefix(changelogPrefix))
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	var entries []changelogEntry
+	for iter.Valid() {
+		entry := changelogEntry{
+			key: append([]byte{}, iter.Key()...),
+			ts:  binary.BigEndian.Uint64(iter.Key()[len(changelogPrefix):]),
+		}
+		if err := json.Unmarshal(iter.Value(), &entry.cdc); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		if err := iter.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// pollChanges streams changes by polling the changelog. Transactions are ordered by their start timestamp, so every poll
+// re-reads the changes of transactions that started within the change window in case they committed since the last poll
+func (b *tikvKV) pollChanges(ctx context.Context, prefix []byte, fn kv.ChangeStreamHandler) error {
+	var (
+		// seen holds the timestamps of the changelog entries that have already been read
+		seen   = map[string]uint64{}
+		primed bool
+	)
+	ticker := time.NewTicker(b.pollInterval)
+	defer ticker.Stop()
+	for {
+		now, err := b.db.CurrentTimestamp(oracle.GlobalTxnScope)
+		if err != nil {
+			return err
+		}
+		from := oracle.GoTimeToTS(oracle.GetTimeFromTS(now).Add(-b.changeWindow))
+		entries, err := b.readChangelog(from)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if _, ok := seen[string(e.key)]; ok {
+				continue
+			}
+			seen[string(e.key)] = e.ts
+			// changes committed before the stream began are never delivered
+			if !primed || !bytes.HasPrefix(e.cdc.Key, prefix) {
+				continue
+			}
+			contn, err := fn(e.cdc)
+			if err != nil {
+				return err
+			}
+			if !contn {
+				return nil
+			}
+		}
+		primed = true
+		for key, ts := range seen {
+			if ts < from {
+				delete(seen, key)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectChangelog deletes changelog entries that are older than the retention period every gc interval until the
+// database is closed. It runs whether or not any change streams are open, so the changelog never grows without bound
+func (b *tikvKV) collectChangelog(ctx context.Context) {
+	defer close(b.gcDone)
+	ticker := time.NewTicker(b.gcInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// failures are retried on the next tick
+			//nolint:errcheck
+			b.deleteExpiredChanges(ctx)
+		}
+	}
+}
+
+// deleteExpiredChanges deletes the changelog entries of transactions that started before the retention period
+func (b *tikvKV) deleteExpiredChanges(ctx context.Context) error {
+	end := changelogKey(oracle.GoTimeToTS(time.Now().Add(-b.retention)), 0)
+	_, err := b.db.DeleteRange(ctx, changelogPrefix, end, 1)
+	return err
+}
@@ -8,9 +8,9 @@ import (
 	"time"
 
 	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
 	"github.com/autom8ter/myjson/kv/registry"
 	"github.com/go-redis/redis/v9"
-	"github.com/segmentio/ksuid"
 	"github.com/spf13/cast"
 	"github.com/tikv/client-go/v2/txnkv"
 )
@@ -20,18 +20,36 @@ func init() {
 		if params["pd_addr"] == nil {
 			return nil, fmt.Errorf("'pd_addr' is a required paramater")
 		}
-		if params["redis_addr"] == nil {
-			return nil, fmt.Errorf("'redis_addr' is a required paramater")
-		}
 		return open(params)
 	})
 }
 
+const (
+	defaultPollInterval = 100 * time.Millisecond
+	defaultChangeWindow = 10 * time.Second
+	defaultRetention    = time.Hour
+	defaultGCInterval   = time.Minute
+)
+
 type tikvKV struct {
-	db    *txnkv.Client
+	db *txnkv.Client
+	// cache is an optional redis client - if it is set, changes are streamed through redis pub/sub instead of the changelog
 	cache *redis.Client
+	// pollInterval is the interval the changelog is polled at
+	pollInterval time.Duration
+	// changeWindow is the maximum duration a transaction may take to commit for its changes to be streamed
+	changeWindow time.Duration
+	// retention is the duration changelog entries are retained for
+	retention time.Duration
+	// gcInterval is the interval that changelog entries older than the retention period are deleted at
+	gcInterval time.Duration
+	// stopGC stops the changelog garbage collector - gcDone is closed once it has stopped
+	stopGC context.CancelFunc
+	gcDone chan struct{}
 }
 
+// open opens a tikv database. If 'redis_addr' is set, redis is used to stream changes - otherwise changes are recorded
+// in a changelog in tikv that change streams poll
 func open(params map[string]interface{}) (kv.DB, error) {
 	pdAddr := cast.ToStringSlice(params["pd_addr"])
 	if len(pdAddr) == 0 {
@@ -41,20 +59,53 @@ func open(params map[string]interface{}) (kv.DB, error) {
 	if err != nil {
 		return nil, err
 	}
-	cache := redis.NewClient(&redis.Options{
-		Addr:     cast.ToString(params["redis_addr"]),
-		Username: cast.ToString(params["redis_user"]),
-		Password: cast.ToString(params["redis_password"]),
-	})
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := cache.Ping(ctx); err != nil && err.Err() != nil {
-		return nil, fmt.Errorf("failed to ping redis instance(%s): %s", cast.ToString(params["redis_addr"]), err.Err())
-	}
-	return &tikvKV{
-		db:    client,
-		cache: cache,
-	}, nil
+	var cache *redis.Client
+	if addr := cast.ToString(params["redis_addr"]); addr != "" {
+		cache = redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Username: cast.ToString(params["redis_user"]),
+			Password: cast.ToString(params["redis_password"]),
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := cache.Ping(ctx); err != nil && err.Err() != nil {
+			//nolint:errcheck
+			client.Close()
+			return nil, fmt.Errorf("failed to ping redis instance(%s): %s", addr, err.Err())
+		}
+	}
+	return newKV(client, cache, params), nil
+}
+
+func newKV(client *txnkv.Client, cache *redis.Client, params map[string]interface{}) *tikvKV {
+	b := &tikvKV{
+		db:           client,
+		cache:        cache,
+		pollInterval: cast.ToDuration(params["poll_interval"]),
+		changeWindow: cast.ToDuration(params["change_window"]),
+		retention:    cast.ToDuration(params["change_retention"]),
+		gcInterval:   cast.ToDuration(params["change_gc_interval"]),
+	}
+	if b.pollInterval <= 0 {
+		b.pollInterval = defaultPollInterval
+	}
+	if b.changeWindow <= 0 {
+		b.changeWindow = defaultChangeWindow
+	}
+	if b.retention <= 0 {
+		b.retention = defaultRetention
+	}
+	if b.gcInterval <= 0 {
+		b.gcInterval = defaultGCInterval
+	}
+	// the changelog is only written when redis isn't configured
+	if cache == nil {
+		var ctx context.Context
+		ctx, b.stopGC = context.WithCancel(context.Background())
+		b.gcDone = make(chan struct{})
+		go b.collectChangelog(ctx)
+	}
+	return b
 }
 
 func (b *tikvKV) Tx(opts kv.TxOpts, fn func(kv.Tx) error) error {
@@ -87,12 +138,25 @@ func (b *tikvKV) NewTx(opts kv.TxOpts) (kv.Tx, error) {
 }
 
 func (b *tikvKV) Close(ctx context.Context) error {
+	if b.stopGC != nil {
+		b.stopGC()
+		<-b.gcDone
+	}
+	if b.cache != nil {
+		//nolint:errcheck
+		b.cache.Close()
+	}
 	return b.db.Close()
 }
 
 func (b *tikvKV) DropPrefix(ctx context.Context, prefix ...[]byte) error {
 	for _, p := range prefix {
-		if _, err := b.db.DeleteRange(ctx, p, nil, 1); err != nil {
+		// a nil end key deletes everything after the prefix
+		var end []byte
+		if next := kvutil.NextPrefix(p); len(next) > 0 {
+			end = next
+		}
+		if _, err := b.db.DeleteRange(ctx, p, end, 1); err != nil {
 			return err
 		}
 	}
@@ -100,17 +164,13 @@ func (b *tikvKV) DropPrefix(ctx context.Context, prefix ...[]byte) error {
 }
 
 func (b *tikvKV) NewLocker(key []byte, leaseInterval time.Duration) (kv.Locker, error) {
-	return &tikvLock{
-		id:            ksuid.New().String(),
-		key:           key,
-		db:            b,
-		leaseInterval: leaseInterval,
-		unlock:        make(chan struct{}),
-		hasUnlocked:   make(chan struct{}),
-	}, nil
+	return kvutil.NewLocker(b, key, leaseInterval), nil
 }
 
 func (b *tikvKV) ChangeStream(ctx context.Context, prefix []byte, fn kv.ChangeStreamHandler) error {
+	if b.cache == nil {
+		return b.pollChanges(ctx, prefix, fn)
+	}
 	ch := b.cache.PSubscribe(ctx, "*").Channel()
 	for {
 		select {
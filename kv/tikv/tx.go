@@ -1,10 +1,12 @@
 package tikv
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 
+	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/kv"
 	"github.com/autom8ter/myjson/kv/kvutil"
 	tikvErr "github.com/tikv/client-go/v2/error"
@@ -20,30 +22,50 @@ type tikvTx struct {
 
 func (t *tikvTx) NewIterator(kopts kv.IterOpts) (kv.Iterator, error) {
 	if kopts.Reverse {
-		if kopts.Seek == nil {
-			iter, err := t.txn.IterReverse(kvutil.NextPrefix(kopts.UpperBound))
-			if err != nil {
-				return nil, err
-			}
-			// iter.Seek(kopts.Seek) // TODO: how to seek?
-			return &tikvIterator{iter: iter, opts: kopts}, nil
+		// reverse iterators begin at the last key < upper
+		var upper []byte
+		switch {
+		case kopts.Seek != nil:
+			upper = append(append([]byte{}, kopts.Seek...), 0x00)
+		case kopts.UpperBound != nil:
+			upper = append(append([]byte{}, kopts.UpperBound...), 0x00)
 		}
-		iter, err := t.txn.IterReverse(kvutil.NextPrefix(kopts.Seek))
+		if next := kvutil.NextPrefix(kopts.Prefix); len(next) > 0 && (upper == nil || bytes.Compare(upper, next) > 0) {
+			upper = next
+		}
+		if upper == nil || bytes.Compare(upper, changelogPrefix) > 0 {
+			upper = changelogPrefix
+		}
+		iter, err := t.txn.IterReverse(upper)
 		if err != nil {
 			return nil, err
 		}
 		return &tikvIterator{iter: iter, opts: kopts}, nil
 	}
-	iter, err := t.txn.Iter(kopts.Prefix, kvutil.NextPrefix(kopts.UpperBound))
+	start := kopts.Prefix
+	if kopts.Seek != nil && bytes.Compare(kopts.Seek, start) > 0 {
+		start = kopts.Seek
+	}
+	var upper []byte
+	if kopts.UpperBound != nil {
+		upper = append(append([]byte{}, kopts.UpperBound...), 0x00)
+	}
+	if next := kvutil.NextPrefix(kopts.Prefix); len(next) > 0 && (upper == nil || bytes.Compare(upper, next) > 0) {
+		upper = next
+	}
+	// the changelog is never visible to iterators
+	if upper == nil || bytes.Compare(upper, changelogPrefix) > 0 {
+		upper = changelogPrefix
+	}
+	iter, err := t.txn.Iter(start, upper)
 	if err != nil {
 		return nil, err
 	}
-	// iter.Seek(kopts.Seek) // TODO: how to seek?
 	return &tikvIterator{iter: iter, opts: kopts}, nil
 }
 
 func (t *tikvTx) Get(ctx context.Context, key []byte) ([]byte, error) {
-	{
+	if t.db.cache != nil {
 		val, _ := t.db.cache.Get(ctx, string(key)).Result()
 		if val != "" {
 			return []byte(val), nil
@@ -60,6 +82,21 @@ func (t *tikvTx) Get(ctx context.Context, key []byte) ([]byte, error) {
 	return val, err
 }
 
+// MultiGet reads the keys with a single tikv batch get
+func (t *tikvTx) MultiGet(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	found, err := t.txn.BatchGet(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		if val, ok := found[string(key)]; ok && len(val) > 0 {
+			values[i] = val
+		}
+	}
+	return values, nil
+}
+
 func (t *tikvTx) Set(ctx context.Context, key, value []byte) error {
 	if t.opts.IsReadOnly {
 		return fmt.Errorf("writes forbidden in read-only transaction")
@@ -82,7 +119,9 @@ func (t *tikvTx) Delete(ctx context.Context, key []byte) error {
 	if err := t.txn.Delete(key); err != nil {
 		return err
 	}
-	t.db.cache.Del(ctx, string(key))
+	if t.db.cache != nil {
+		t.db.cache.Del(ctx, string(key))
+	}
 	t.entries = append(t.entries, kv.CDC{
 		Operation: kv.DELOP,
 		Key:       key,
@@ -96,8 +135,18 @@ func (t *tikvTx) Rollback(ctx context.Context) error {
 }
 
 func (t *tikvTx) Commit(ctx context.Context) error {
+	if t.db.cache == nil {
+		if err := writeChangelog(t.txn, t.entries); err != nil {
+			return err
+		}
+		if err := t.txn.Commit(ctx); err != nil {
+			return commitError(err)
+		}
+		t.entries = []kv.CDC{}
+		return nil
+	}
 	if err := t.txn.Commit(ctx); err != nil {
-		return err
+		return commitError(err)
 	}
 	var toSet = map[string][]byte{}
 	for _, e := range t.entries {
@@ -120,6 +169,14 @@ func (t *tikvTx) Commit(ctx context.Context) error {
 	return nil
 }
 
+// commitError maps write conflicts onto errors.Conflict so that they may be retried
+func commitError(err error) error {
+	if tikvErr.IsErrWriteConflict(err) {
+		return errors.Wrap(err, errors.Conflict, "tikv: transaction conflict")
+	}
+	return err
+}
+
 func (t *tikvTx) Close(ctx context.Context) {
 	t.entries = []kv.CDC{}
 }
@@ -9,6 +9,12 @@ type internalMetaKey string
 const (
 	internalKey   internalMetaKey = "_internal"
 	isIndexingKey internalMetaKey = "_is_indexing"
+	// includeExpiredKey indicates that expired documents should not be hidden from reads
+	includeExpiredKey internalMetaKey = "_include_expired"
+	// isRestoringKey indicates that documents are being restored from a backup - triggers, computed writes, ttl stamping, foreign key checks & cdc are skipped
+	isRestoringKey internalMetaKey = "_is_restoring"
+	// retryPolicyKey overrides the database's retry policy for a single call to Tx
+	retryPolicyKey internalMetaKey = "_retry_policy"
 )
 
 func isInternal(ctx context.Context) bool {
@@ -19,6 +25,22 @@ func isIndexing(ctx context.Context) bool {
 	return ctx.Value(isIndexingKey) == true
 }
 
+func includeExpired(ctx context.Context) bool {
+	return ctx.Value(includeExpiredKey) == true
+}
+
+func setIncludeExpired(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeExpiredKey, true)
+}
+
+func isRestoring(ctx context.Context) bool {
+	return ctx.Value(isRestoringKey) == true
+}
+
+func setIsRestoring(ctx context.Context) context.Context {
+	return context.WithValue(ctx, isRestoringKey, true)
+}
+
 // SetIsInternal sets a context value to indicate that the request is internal (it should only be used to bypass things like authorization, validation, etc)
 func SetIsInternal(ctx context.Context) context.Context {
 	return context.WithValue(ctx, internalKey, true)
@@ -0,0 +1,287 @@
+package myjson
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/util"
+	"github.com/spf13/cast"
+)
+
+// indexVersion is the version of the index key layout. It is persisted when a database is opened - databases that were written
+// with an older version are reindexed before they are used.
+//
+// 1: typed, order preserving value encoding
+// 2: escaped key components
+// 3: date-time properties & ttl expiry fields are encoded as times
+const indexVersion = 3
+
+// migrationBatchSize is the maximum number of index keys read (and documents written) per transaction while reindexing
+const migrationBatchSize = 1000
+
+func indexVersionKey() []byte {
+	return []byte("cache.internal.index_version")
+}
+
+// migrateIndexes reindexes every collection if the persisted index version is older than the current index version
+func (d *defaultDB) migrateIndexes(ctx context.Context, collections []CollectionSchema) error {
+	var (
+		version   int
+		persisted bool
+	)
+	if err := d.kv.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		bits, err := tx.Get(ctx, indexVersionKey())
+		if err != nil || bits == nil {
+			return nil
+		}
+		persisted = true
+		version, err = cast.ToIntE(string(bits))
+		if err != nil {
+			return errors.Wrap(err, errors.Internal, "invalid index version: %s", string(bits))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if persisted && version >= indexVersion {
+		return nil
+	}
+	// databases without any collections have nothing to reindex
+	if persisted || len(collections) > 0 {
+		if err := d.reindex(ctx, collections); err != nil {
+			return errors.Wrap(err, 0, "failed to migrate indexes from version %v to %v", version, indexVersion)
+		}
+	}
+	return d.kv.Tx(kv.TxOpts{}, func(tx kv.Tx) error {
+		return tx.Set(ctx, indexVersionKey(), []byte(cast.ToString(indexVersion)))
+	})
+}
+
+// reindex rebuilds the primary & secondary indexes of the given collections in every namespace from the documents stored in their
+// primary indexes. Documents are streamed in batches & their index keys are written with the current encoding before the stale
+// keys of the previous encoding are deleted, so an interrupted reindex never loses a document - it is completed the next time the
+// database is opened (the index version is only persisted once it succeeds)
+func (d *defaultDB) reindex(ctx context.Context, collections []CollectionSchema) error {
+	namespaces, err := d.indexedNamespaces(ctx, collections)
+	if err != nil {
+		return err
+	}
+	for _, c := range collections {
+		for _, namespace := range namespaces[c.Collection()] {
+			ctx := SetIsInternal(SetMetadataNamespace(ctx, namespace))
+			if err := d.writeCollectionIndexes(ctx, c); err != nil {
+				return errors.Wrap(err, 0, "failed to reindex documents: %s/%s", namespace, c.Collection())
+			}
+			if err := d.deleteStaleIndexKeys(ctx, c); err != nil {
+				return errors.Wrap(err, 0, "failed to delete stale index keys: %s/%s", namespace, c.Collection())
+			}
+		}
+	}
+	return nil
+}
+
+// writeCollectionIndexes streams the documents in the collection's primary index & writes their index keys with the current encoding
+func (d *defaultDB) writeCollectionIndexes(ctx context.Context, c CollectionSchema) error {
+	var after []byte
+	for {
+		keys, values, err := d.readIndexBatch(ctx, indexPrefix(ctx, c.Collection(), c.PrimaryIndex().Name), after, true)
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+		if err := d.kv.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+			for _, bits := range values {
+				doc, err := decodeDocument(bits)
+				if err != nil {
+					return err
+				}
+				if err := writeIndexes(ctx, tx, c, doc); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+// deleteStaleIndexKeys streams the index keys of the collection & deletes the keys that don't match the current index keys of the
+// document they reference (keys written with a previous encoding, keys of documents that no longer exist & keys of dropped indexes)
+func (d *defaultDB) deleteStaleIndexKeys(ctx context.Context, c CollectionSchema) error {
+	var after []byte
+	for {
+		keys, _, err := d.readIndexBatch(ctx, collectionPrefix(ctx, c.Collection()), after, false)
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+		stale, err := d.staleIndexKeys(ctx, c, keys)
+		if err != nil {
+			return err
+		}
+		if len(stale) > 0 {
+			if err := d.kv.Tx(kv.TxOpts{IsBatch: true}, func(tx kv.Tx) error {
+				for _, key := range stale {
+					if err := tx.Delete(ctx, key); err != nil {
+						return err
+					}
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+// staleIndexKeys returns the index keys that are not current index keys of the document they reference
+func (d *defaultDB) staleIndexKeys(ctx context.Context, c CollectionSchema, keys [][]byte) ([][]byte, error) {
+	var (
+		stale      [][]byte
+		candidates [][]byte
+		lookups    [][]byte
+	)
+	for _, key := range keys {
+		id, err := indexKeyDocID(key)
+		if err != nil {
+			// the document id of keys written with an older encoding can't be decoded
+			stale = append(stale, key)
+			continue
+		}
+		candidates = append(candidates, key)
+		lookups = append(lookups, primaryKey(ctx, c, id))
+	}
+	if len(lookups) == 0 {
+		return stale, nil
+	}
+	var values [][]byte
+	if err := d.kv.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		var err error
+		values, err = tx.MultiGet(ctx, lookups)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	for i, bits := range values {
+		if bits == nil {
+			stale = append(stale, candidates[i])
+			continue
+		}
+		doc, err := decodeDocument(bits)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := documentIndexKeys(ctx, c, doc)[string(candidates[i])]; !ok {
+			stale = append(stale, candidates[i])
+		}
+	}
+	return stale, nil
+}
+
+// readIndexBatch reads up to migrationBatchSize keys (and their values if withValues is true) with the prefix that come after the
+// given key (if set)
+func (d *defaultDB) readIndexBatch(ctx context.Context, prefix []byte, after []byte, withValues bool) ([][]byte, [][]byte, error) {
+	var keys, values [][]byte
+	if err := d.kv.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		it, err := tx.NewIterator(kv.IterOpts{
+			Prefix: prefix,
+			Seek:   after,
+		})
+		if err != nil {
+			return err
+		}
+		defer it.Close()
+		for it.Valid() && len(keys) < migrationBatchSize {
+			if after == nil || bytes.Compare(it.Key(), after) > 0 {
+				keys = append(keys, append([]byte{}, it.Key()...))
+				if withValues {
+					bits, err := it.Value()
+					if err != nil {
+						return err
+					}
+					values = append(values, bits)
+				}
+			}
+			if err := it.Next(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+	return keys, values, nil
+}
+
+// indexedNamespaces scans the database for index keys & returns the namespaces that each collection has documents in
+func (d *defaultDB) indexedNamespaces(ctx context.Context, collections []CollectionSchema) (map[string][]string, error) {
+	var namespaces = map[string][]string{}
+	for _, c := range collections {
+		namespaces[c.Collection()] = nil
+	}
+	if err := d.kv.Tx(kv.TxOpts{IsReadOnly: true}, func(tx kv.Tx) error {
+		it, err := tx.NewIterator(kv.IterOpts{})
+		if err != nil {
+			return err
+		}
+		defer it.Close()
+		for it.Valid() {
+			split := bytes.SplitN(it.Key(), nullByte, 4)
+			if len(split) == 4 && string(split[1]) == "index" {
+				namespace, collection := unescapeComponent(split[0]), unescapeComponent(split[2])
+				if existing, ok := namespaces[collection]; ok {
+					namespaces[collection] = append(existing, namespace)
+					// skip the rest of the collection's keys in the namespace
+					it.Seek(append(bytes.Join(split[:3], nullByte), 0x01))
+					continue
+				}
+			}
+			if err := it.Next(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, 0, "failed to scan for namespaces")
+	}
+	return namespaces, nil
+}
+
+// writeIndexes writes the document to the primary index & its references to the collection's secondary indexes
+func writeIndexes(ctx context.Context, tx kv.Tx, c CollectionSchema, doc *Document) error {
+	for key, value := range documentIndexKeys(ctx, c, doc) {
+		if err := tx.Set(ctx, []byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// documentIndexKeys returns the keys & values of the document in the primary index & the collection's secondary indexes
+func documentIndexKeys(ctx context.Context, c CollectionSchema, doc *Document) map[string][]byte {
+	var (
+		docID = c.GetPrimaryKey(doc)
+		keys  = map[string][]byte{}
+	)
+	for _, idx := range c.Indexing() {
+		if idx.Primary {
+			keys[string(primaryKey(ctx, c, docID))] = encodeDocument(c.Compression(), doc)
+			continue
+		}
+		keys[string(typedSeekPrefix(ctx, c, idx, documentIndexFields(c, idx, doc)).Seek(docID).Path())] = []byte(docID)
+	}
+	return keys
+}
+
+// unescapeComponent unescapes an index key component. Components written before index version 2 were not escaped, so they are
+// returned as is if they cannot be unescaped
+func unescapeComponent(component []byte) string {
+	unescaped, err := util.UnescapeIndexComponent(component)
+	if err != nil {
+		return string(component)
+	}
+	return string(unescaped)
+}
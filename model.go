@@ -11,6 +11,7 @@ import (
 	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/util"
 	"github.com/samber/lo"
+	"github.com/spf13/cast"
 )
 
 // WhereOp is an operation belonging to a where clause
@@ -55,6 +56,28 @@ const WhereOpHasSuffix WhereOp = "hasSuffix"
 // WhereOpRegex is a check whtether a string value matches a regex expression
 const WhereOpRegex WhereOp = "regex"
 
+// WhereOpExists is a check whether a field exists - it doesn't require a value
+const WhereOpExists WhereOp = "exists"
+
+// WhereOpNotExists is a check whether a field doesn't exist - it doesn't require a value
+const WhereOpNotExists WhereOp = "notExists"
+
+// WhereOpType is a check whether a value is of a json type (string, number, boolean, array, object, null)
+const WhereOpType WhereOp = "type"
+
+// WhereOpBetween is a check whether a value is between (inclusive) the two values of a [min, max] array
+const WhereOpBetween WhereOp = "between"
+
+// WhereOpSize is a check whether an array has the given number of elements
+const WhereOpSize WhereOp = "size"
+
+// WhereOpNotIn is a check whether a value is not one of a list of values
+const WhereOpNotIn WhereOp = "notIn"
+
+// WhereOpElemMatch is a check whether any object in an array matches a list of where clauses - the where clauses are the value
+// of the clause & their fields are relative to the array element
+const WhereOpElemMatch WhereOp = "elemMatch"
+
 // OrderByDirection is the direction of an order by clause
 type OrderByDirection string
 
@@ -94,6 +117,9 @@ type Query struct {
 	Page int `json:"page" validate:"min=0"`
 	// Limit is used to limit the number of results returned
 	Limit int `json:"limit,omitempty" validate:"min=0"`
+	// Cursor resumes the query after the last document of a previous page (Page.NextCursor). Unlike Page, it doesn't scan the
+	// documents of the previous pages if the results are in index order (no OrderBy)
+	Cursor string `json:"cursor,omitempty"`
 	// OrderBy orders results
 	OrderBy []OrderBy `json:"orderBy,omitempty" validate:"dive"`
 	// Having applies a final filter after any aggregations have occured
@@ -118,11 +144,61 @@ type Select struct {
 	Field     string            `json:"field"`
 }
 
-// Where is a filter against documents returned from a query
+// Where is a filter against documents returned from a query. A where clause either compares a field to a value or is a boolean
+// group - Or matches documents that match any of its clauses & Not matches documents that don't match its clause
 type Where struct {
-	Field string      `json:"field" validate:"required"`
-	Op    WhereOp     `json:"op" validate:"oneof='eq' 'neq' 'gt' 'gte' 'lt' 'lte' 'contains' 'containsAny' 'containsAll' 'in'"`
-	Value interface{} `json:"value" validate:"required"`
+	Field string      `json:"field,omitempty"`
+	Op    WhereOp     `json:"op,omitempty" validate:"omitempty,oneof='eq' 'neq' 'gt' 'gte' 'lt' 'lte' 'contains' 'containsAny' 'containsAll' 'in' 'notIn' 'hasPrefix' 'hasSuffix' 'regex' 'exists' 'notExists' 'type' 'between' 'size' 'elemMatch'"`
+	Value interface{} `json:"value,omitempty"`
+	Or    []Where     `json:"or,omitempty" validate:"dive"`
+	Not   *Where      `json:"not,omitempty"`
+}
+
+// IsGroup returns true if the where clause is a boolean group (or/not)
+func (w Where) IsGroup() bool {
+	return len(w.Or) > 0 || w.Not != nil
+}
+
+// Validate returns a validation error if the where clause (or any of its nested clauses) is malformed
+func (w Where) Validate() error {
+	switch {
+	case len(w.Or) > 0 && w.Not != nil:
+		return errors.New(errors.Validation, "where clause may not contain both 'or' and 'not'")
+	case w.IsGroup() && (w.Field != "" || w.Op != ""):
+		return errors.New(errors.Validation, "where group may not contain a field comparison")
+	case !w.IsGroup() && w.Field == "":
+		return errors.New(errors.Validation, "empty required field: 'where.field'")
+	case !w.IsGroup() && w.Op == "":
+		return errors.New(errors.Validation, "empty required field: 'where.op'")
+	case !w.IsGroup() && w.Value == nil && w.Op != WhereOpExists && w.Op != WhereOpNotExists:
+		return errors.New(errors.Validation, "empty required field: 'where.value'")
+	case w.Op == WhereOpBetween:
+		if _, _, err := betweenValues(w.Value); err != nil {
+			return err
+		}
+	case w.Op == WhereOpElemMatch:
+		wheres, err := elemMatchValue(w.Value)
+		if err != nil {
+			return err
+		}
+		for _, w := range wheres {
+			if err := util.ValidateStruct(&w); err != nil {
+				return err
+			}
+			if err := w.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, or := range w.Or {
+		if err := or.Validate(); err != nil {
+			return err
+		}
+	}
+	if w.Not != nil {
+		return w.Not.Validate()
+	}
+	return nil
 }
 
 // Join is a join against another collection
@@ -140,6 +216,18 @@ func (q Query) Validate(ctx context.Context) error {
 	if len(q.Select) == 0 {
 		return errors.New(errors.Validation, "query validation error: at least one select is required")
 	}
+	if q.Cursor != "" && q.Page > 0 {
+		return errors.New(errors.Validation, "query validation error: cursor and page are mutually exclusive")
+	}
+	wheres := append(append([]Where{}, q.Where...), q.Having...)
+	for _, j := range q.Join {
+		wheres = append(wheres, j.On...)
+	}
+	for _, w := range wheres {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
 	isAggregate := false
 	for _, a := range q.Select {
 		if a.Field == "" {
@@ -150,6 +238,9 @@ func (q Query) Validate(ctx context.Context) error {
 		}
 	}
 	if isAggregate {
+		if q.Cursor != "" {
+			return errors.New(errors.Validation, "query validation error: cursors are not supported by aggregate queries")
+		}
 		for _, a := range q.Select {
 			if a.Aggregate == "" {
 				if !lo.Contains(q.GroupBy, a.Field) {
@@ -174,6 +265,9 @@ type Page struct {
 	Documents Documents `json:"documents"`
 	// Next page
 	NextPage int `json:"nextPage"`
+	// NextCursor is an opaque cursor to the next page (Query.Cursor). It is empty if there are no more results or if the query
+	// doesn't have a Limit
+	NextCursor string `json:"nextCursor,omitempty"`
 	// Document count
 	Count int `json:"count"`
 	// Stats are statistics collected from a document aggregation query
@@ -202,8 +296,13 @@ type Explain struct {
 	SeekFields []string `json:"seek,omitempty"`
 	// SeekValues are the values to seek
 	SeekValues map[string]any `json:"seekValues,omitempty"`
+	// UpperBoundValues are the (inclusive) values that the seek ends at
+	UpperBoundValues map[string]any `json:"upperBoundValues,omitempty"`
 	// Reverse indicates that the index should be scanned in reverse
 	Reverse bool `json:"reverse,omitempty"`
+	// Union holds the index scans that are unioned to satisfy a top level or group - documents found by more than one scan are
+	// only returned once. The other fields are empty when it is set
+	Union []Explain `json:"union,omitempty"`
 }
 
 // Action is an action that causes a mutation to the database
@@ -242,6 +341,8 @@ type persistCommand struct {
 	Document   *Document `json:"document" validate:"required"`
 	Timestamp  int64     `json:"timestamp" validate:"required"`
 	Metadata   *Document `json:"metadata" validate:"required"`
+	// ExpectedVersion is the version the document must be at for the command to be applied (0 = unconditional)
+	ExpectedVersion int64 `json:"expectedVersion,omitempty"`
 }
 
 // Index is a database index used to optimize queries against a collection
@@ -294,6 +395,34 @@ type JSONFieldOp struct {
 	BeforeValue any `json:"beforeValue,omitempty"`
 }
 
+// UpdateOp is an update operator that is applied against a document's current value by Tx.Update. Operators are top level keys of
+// the update mapped to the fields (dot notation) they apply to ex: {"$inc": {"stats.logins": 1}}
+type UpdateOp string
+
+const (
+	// UpdateOpInc increments a numeric field by the given amount - missing fields are treated as 0
+	UpdateOpInc UpdateOp = "$inc"
+	// UpdateOpMul multiplies a numeric field by the given amount - missing fields are treated as 0
+	UpdateOpMul UpdateOp = "$mul"
+	// UpdateOpPush appends a value to an array field - use {"$each": [...]} to append multiple values
+	UpdateOpPush UpdateOp = "$push"
+	// UpdateOpPull removes every element that is equal to the given value from an array field (missing fields are left unset)
+	UpdateOpPull UpdateOp = "$pull"
+	// UpdateOpAddToSet appends a value to an array field if it isn't already an element - use {"$each": [...]} to add multiple values
+	UpdateOpAddToSet UpdateOp = "$addToSet"
+	// UpdateOpUnset removes a field
+	UpdateOpUnset UpdateOp = "$unset"
+	// UpdateOpMin sets a field to the given value if the value is less than the field's current value or the field is missing
+	UpdateOpMin UpdateOp = "$min"
+	// UpdateOpMax sets a field to the given value if the value is greater than the field's current value or the field is missing
+	UpdateOpMax UpdateOp = "$max"
+	// UpdateOpCurrentDate sets a field to the current time
+	UpdateOpCurrentDate UpdateOp = "$currentDate"
+)
+
+// updateOpEach is a modifier of push & addToSet that applies the operator to every element of an array
+const updateOpEach = "$each"
+
 //go:embed cdc.yaml
 var cdcSchema string
 
@@ -317,6 +446,15 @@ type CDC struct {
 	Metadata *Document `json:"metadata" validate:"required"`
 }
 
+// ChangeStreamCursor is a position in a change stream that can be used to resume the stream (ex: after a restart)
+type ChangeStreamCursor struct {
+	// ID is the id of the last cdc entry that was processed - the stream resumes with the entries that follow it. Entries created
+	// shortly (up to 5s) before it are replayed as well since their transactions may have been committed after it
+	ID string `json:"id,omitempty"`
+	// Timestamp is a unix nanosecond timestamp - the stream resumes with the entries created at or after it. It is ignored if ID is set
+	Timestamp int64 `json:"timestamp,omitempty"`
+}
+
 // ForeignKey is a reference/relationship to another collection by primary key
 type ForeignKey struct {
 	// Collection is the foreign collection
@@ -325,6 +463,41 @@ type ForeignKey struct {
 	Cascade bool `json:"cascade"`
 }
 
+// defaultTTLField is the field documents are stamped with when a collection's ttl only has a duration
+const defaultTTLField = "_expires_at"
+
+// TTL configures the expiration of documents in a collection. Expired documents are hidden from reads & deleted in the background
+type TTL struct {
+	// Field is the document field that holds the time the document expires at - it must be a date-time string or a unix timestamp (seconds).
+	// It defaults to _expires_at if a duration is set
+	Field string `json:"field,omitempty"`
+	// Duration is how long documents live after they are written (ex: 24h) - if set, Field is set to now + Duration every time a document is written
+	Duration string `json:"duration,omitempty"`
+	duration time.Duration
+}
+
+// ExpiresAt returns the time the document expires at (if it has an expiration)
+func (t TTL) ExpiresAt(doc *Document) (time.Time, bool) {
+	if doc == nil || t.Field == "" {
+		return time.Time{}, false
+	}
+	val := doc.Get(t.Field)
+	if val == nil {
+		return time.Time{}, false
+	}
+	expiresAt, err := cast.ToTimeE(val)
+	if err != nil || expiresAt.IsZero() {
+		return time.Time{}, false
+	}
+	return expiresAt, true
+}
+
+// IsExpired returns true if the document expired before the given time
+func (t TTL) IsExpired(doc *Document, now time.Time) bool {
+	expiresAt, ok := t.ExpiresAt(doc)
+	return ok && !expiresAt.After(now)
+}
+
 // SchemaProperty is a property belonging to a JSON Schema
 type SchemaProperty struct {
 	// Primary indicates the property is the primary key
@@ -335,6 +508,8 @@ type SchemaProperty struct {
 	Description string `json:"description,omitempty"`
 	// Type is the type of the property
 	Type string `json:"type" validate:"required"`
+	// Format is the json schema format of the property (ex: date-time). date-time properties are compared, ordered & indexed as times
+	Format string `json:"format,omitempty"`
 	// Path is a dot notation path to the property
 	Path string `json:"path" validate:"required"`
 	// Immutable indicates the field value is immutable - it will be ignored on updates
@@ -388,6 +563,8 @@ type TxCmd struct {
 	Update *UpdateCmd `json:"update,omitempty"`
 	// Delete is a delete command
 	Delete *DeleteCmd `json:"delete,omitempty"`
+	// Upsert is an upsert command
+	Upsert *UpsertCmd `json:"upsert,omitempty"`
 	// Query is a query command
 	Query *QueryCmd `json:"query,omitempty"`
 	// Revert is a revert command
@@ -412,6 +589,8 @@ type TxResponse struct {
 	Update *Document `json:"update,omitempty"`
 	// Delete is an empty delete response
 	Delete *struct{} `json:"delete,omitempty"`
+	// Upsert is an upsert response - it contains the document after the upsert was applied
+	Upsert *Document `json:"upsert,omitempty"`
 	// Query is a query response - it contains the documents returned from the query
 	Query *Page `json:"page,omitempty"`
 	// Revert is a revert response - it contains the document after the revert was applied
@@ -432,6 +611,8 @@ type DeleteCmd struct {
 	Collection string `json:"collection" validate:"required"`
 	// ID is the unique id of the document
 	ID string `json:"id" validate:"required"`
+	// Version is the version the document must be at for it to be deleted (0 = unconditional)
+	Version int64 `json:"version,omitempty"`
 }
 
 // GetCmd is a serializable get command
@@ -448,6 +629,8 @@ type SetCmd struct {
 	Collection string `json:"collection" validate:"required"`
 	// Document is the document to set
 	Document *Document `json:"document" validate:"required"`
+	// Version is the version the document must be at for it to be set (0 = unconditional)
+	Version int64 `json:"version,omitempty"`
 }
 
 // CreateCmd is a serializable create command
@@ -464,8 +647,22 @@ type UpdateCmd struct {
 	Collection string `json:"collection" validate:"required"`
 	// ID is the unique id of the document
 	ID string `json:"id" validate:"required"`
-	// Update is the set of fields to set
+	// Update is the set of fields to set - it may contain update operators ex: {"$inc": {"count": 1}}
+	Update map[string]any `json:"update,omitempty"`
+	// Version is the version the document must be at for it to be updated (0 = unconditional)
+	Version int64 `json:"version,omitempty"`
+}
+
+// UpsertCmd is a serializable upsert command
+type UpsertCmd struct {
+	// Collection is the collection the document belongs to
+	Collection string `json:"collection" validate:"required"`
+	// ID is the unique id of the document
+	ID string `json:"id" validate:"required"`
+	// Update is the set of fields to set - it may contain update operators ex: {"$inc": {"count": 1}}
 	Update map[string]any `json:"update,omitempty"`
+	// OnInsert is the set of fields to set only if the document is created
+	OnInsert map[string]any `json:"onInsert,omitempty"`
 }
 
 // QueryCmd is a serializable query command
@@ -104,6 +104,30 @@ func TestQuery(t *testing.T) {
 		}
 		assert.NotNil(t, a.Validate(context.Background()))
 	})
+	t.Run("validate where ops", func(t *testing.T) {
+		var query = func(where ...Where) Query {
+			return Query{
+				Select: []Select{{Field: "*"}},
+				Where:  where,
+			}
+		}
+		assert.Nil(t, query(Where{Field: "name", Op: WhereOpHasPrefix, Value: "a"}).Validate(context.Background()))
+		assert.Nil(t, query(Where{Field: "name", Op: WhereOpRegex, Value: "^a"}).Validate(context.Background()))
+		assert.Nil(t, query(Where{Field: "name", Op: WhereOpExists}).Validate(context.Background()))
+		assert.Nil(t, query(Where{Field: "name", Op: WhereOpNotExists}).Validate(context.Background()))
+		assert.Nil(t, query(Where{Field: "age", Op: WhereOpBetween, Value: []int{1, 10}}).Validate(context.Background()))
+		assert.NotNil(t, query(Where{Field: "age", Op: WhereOpBetween, Value: 1}).Validate(context.Background()))
+		assert.Nil(t, query(Where{Field: "items", Op: WhereOpElemMatch, Value: []Where{
+			{Field: "sku", Op: WhereOpEq, Value: "a"},
+		}}).Validate(context.Background()))
+		assert.Nil(t, query(Where{Field: "items", Op: WhereOpElemMatch, Value: []any{
+			map[string]any{"field": "sku", "op": "eq", "value": "a"},
+		}}).Validate(context.Background()))
+		assert.NotNil(t, query(Where{Field: "items", Op: WhereOpElemMatch, Value: []Where{
+			{Field: "sku", Op: "=="},
+		}}).Validate(context.Background()))
+		assert.NotNil(t, query(Where{Field: "items", Op: WhereOpElemMatch, Value: "sku"}).Validate(context.Background()))
+	})
 	t.Run("validate bad limit", func(t *testing.T) {
 		a := Query{
 			Select: []Select{
@@ -126,6 +150,20 @@ func TestQuery(t *testing.T) {
 		}
 		assert.NotNil(t, a.Validate(context.Background()))
 	})
+	t.Run("validate cursor", func(t *testing.T) {
+		a := Query{
+			Select: []Select{
+				{
+					Field: "*",
+				},
+			},
+			Cursor: queryCursor{Key: []byte("key")}.encode(),
+			Page:   1,
+		}
+		assert.NotNil(t, a.Validate(context.Background()))
+		a.Page = 0
+		assert.Nil(t, a.Validate(context.Background()))
+	})
 	t.Run("validate good query", func(t *testing.T) {
 		a := Query{
 			Select: []Select{
@@ -20,22 +20,77 @@ func defaultExplain(c CollectionSchema) Explain {
 }
 
 func (o defaultOptimizer) Optimize(c CollectionSchema, where []Where) (Explain, error) {
+	explain, indexed, err := o.optimize(c, where)
+	if err != nil || indexed || len(where) == 0 {
+		return explain, err
+	}
+	union, ok, err := o.union(c, where)
+	if err != nil {
+		return Explain{}, err
+	}
+	if ok {
+		return union, nil
+	}
+	if c.RequireQueryIndex() {
+		return Explain{}, errors.New(errors.Forbidden, "index is required for query in collection: %s", c.Collection())
+	}
+	return explain, nil
+}
+
+// union returns an explain that unions an index scan for each clause of the first top level or group. ok is false if
+// there is no or group or if any of its clauses can't be satisfied by an index
+func (o defaultOptimizer) union(c CollectionSchema, where []Where) (Explain, bool, error) {
+	var (
+		group Where
+		rest  []Where
+	)
+	for _, w := range where {
+		if len(group.Or) == 0 && len(w.Or) > 0 {
+			group = w
+			continue
+		}
+		rest = append(rest, w)
+	}
+	if len(group.Or) == 0 {
+		return Explain{}, false, nil
+	}
+	var union = Explain{
+		Collection: c.Collection(),
+	}
+	for _, or := range group.Or {
+		if or.IsGroup() {
+			return Explain{}, false, nil
+		}
+		explain, indexed, err := o.optimize(c, append([]Where{or}, rest...))
+		if err != nil {
+			return Explain{}, false, err
+		}
+		if !indexed {
+			return Explain{}, false, nil
+		}
+		union.Union = append(union.Union, explain)
+	}
+	return union, true, nil
+}
+
+// optimize returns the best index scan for the where clauses. indexed is false if no index matches the where clauses
+func (o defaultOptimizer) optimize(c CollectionSchema, where []Where) (Explain, bool, error) {
 	if len(c.PrimaryIndex().Fields) == 0 {
-		return Explain{}, errors.New(errors.Internal, "zero configured indexes")
+		return Explain{}, false, errors.New(errors.Internal, "zero configured indexes")
 	}
 	indexes := c.Indexing()
 	if len(indexes) == 0 {
-		return Explain{}, errors.New(errors.Internal, "zero configured indexes")
+		return Explain{}, false, errors.New(errors.Internal, "zero configured indexes")
 	}
 	if len(where) == 0 {
-		return defaultExplain(c), nil
+		return defaultExplain(c), false, nil
 	}
 	if c.PrimaryIndex().Fields[0] == where[0].Field && where[0].Op == WhereOpEq {
 		return Explain{
 			Index:         c.PrimaryIndex(),
 			MatchedFields: []string{c.PrimaryKey()},
 			MatchedValues: getMatchedFieldValues([]string{c.PrimaryKey()}, where),
-		}, nil
+		}, true, nil
 	}
 	var (
 		opt = &Explain{
@@ -47,9 +102,11 @@ func (o defaultOptimizer) Optimize(c CollectionSchema, where []Where) (Explain,
 			continue
 		}
 		var (
-			matchedFields []string
-			seekFields    []string
-			reverse       bool
+			matchedFields    []string
+			seekFields       []string
+			seekValues       = map[string]any{}
+			upperBoundValues map[string]any
+			reverse          bool
 		)
 		for i, field := range index.Fields {
 			if len(where) > i {
@@ -59,14 +116,26 @@ func (o defaultOptimizer) Optimize(c CollectionSchema, where []Where) (Explain,
 					switch {
 					case where[i].Op == WhereOpGt:
 						seekFields = append(seekFields, field)
+						seekValues[field] = where[i].Value
 					case where[i].Op == WhereOpGte:
 						seekFields = append(seekFields, field)
+						seekValues[field] = where[i].Value
 					case where[i].Op == WhereOpLt:
 						seekFields = append(seekFields, field)
+						seekValues[field] = where[i].Value
 						reverse = true
 					case where[i].Op == WhereOpLte:
 						seekFields = append(seekFields, field)
+						seekValues[field] = where[i].Value
 						reverse = true
+					case where[i].Op == WhereOpBetween:
+						min, max, err := betweenValues(where[i].Value)
+						if err != nil {
+							return Explain{}, false, err
+						}
+						seekFields = append(seekFields, field)
+						seekValues[field] = min
+						upperBoundValues = map[string]any{field: max}
 					}
 				}
 			}
@@ -77,17 +146,60 @@ func (o defaultOptimizer) Optimize(c CollectionSchema, where []Where) (Explain,
 			opt.MatchedFields = matchedFields
 			opt.Reverse = reverse
 			opt.SeekFields = seekFields
+			opt.SeekValues = seekValues
+			opt.UpperBoundValues = upperBoundValues
 		}
 	}
 	if len(opt.MatchedFields)+len(opt.SeekFields) > 0 {
 		opt.MatchedValues = getMatchedFieldValues(opt.MatchedFields, where)
-		opt.SeekValues = getMatchedFieldValues(opt.SeekFields, where)
-		return *opt, nil
+		return *opt, true, nil
 	}
-	if c.RequireQueryIndex() {
-		return Explain{}, errors.New(errors.Forbidden, "index is required for query in collection: %s", c.Collection())
+	return defaultExplain(c), false, nil
+}
+
+// indexOrder reports whether scanning the index of the explain returns documents in the order of the order by clauses & whether
+// the index must be scanned in reverse to do so. Fields that are matched by equality have a single value, so they are ignored
+func indexOrder(explain Explain, orderBy []OrderBy) (reverse bool, ok bool) {
+	if len(explain.Union) > 0 {
+		return false, false
+	}
+	if len(orderBy) == 0 {
+		return explain.Reverse, true
+	}
+	if len(explain.MatchedFields) > len(explain.Index.Fields) {
+		return false, false
+	}
+	for _, field := range explain.Index.Fields[:len(explain.MatchedFields)] {
+		if !lo.Contains(explain.MatchedFields, field) {
+			return false, false
+		}
+	}
+	var (
+		fields    = explain.Index.Fields[len(explain.MatchedFields):]
+		direction OrderByDirection
+	)
+	for _, o := range orderBy {
+		if lo.Contains(explain.MatchedFields, o.Field) {
+			continue
+		}
+		if len(fields) == 0 || fields[0] != o.Field {
+			return false, false
+		}
+		if direction != "" && o.Direction != direction {
+			return false, false
+		}
+		direction = o.Direction
+		fields = fields[1:]
+	}
+	if direction == "" {
+		return explain.Reverse, true
+	}
+	reverse = direction == OrderByDirectionDesc
+	// seeks only support the scan direction chosen by the optimizer
+	if len(explain.SeekFields) > 0 && reverse != explain.Reverse {
+		return false, false
 	}
-	return defaultExplain(c), nil
+	return reverse, true
 }
 
 func getMatchedFieldValues(fields []string, where []Where) map[string]any {
@@ -113,6 +113,24 @@ func TestOptimizer(t *testing.T) {
 		assert.Equal(t, "timestamp", explain.SeekFields[0])
 		assert.NotEmpty(t, explain.SeekValues["timestamp"])
 	})
+	t.Run("select secondary index (between)", func(t *testing.T) {
+		cdc, err := newCollectionSchema([]byte(cdcSchema))
+		assert.NoError(t, err)
+		start, end := time.Now().Add(-time.Hour).String(), time.Now().String()
+		explain, err := o.Optimize(cdc, []Where{
+			{
+				Field: "timestamp",
+				Op:    WhereOpBetween,
+				Value: []string{start, end},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, false, explain.Index.Primary)
+		assert.Equal(t, false, explain.Reverse)
+		assert.Equal(t, "timestamp", explain.SeekFields[0])
+		assert.Equal(t, start, explain.SeekValues["timestamp"])
+		assert.Equal(t, end, explain.UpperBoundValues["timestamp"])
+	})
 	t.Run("select primary index (neq)", func(t *testing.T) {
 		explain, err := o.Optimize(indexes, []Where{
 			{
@@ -179,4 +197,174 @@ func TestOptimizer(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, true, explain.Index.Primary)
 	})
+	t.Run("union of secondary indexes (or)", func(t *testing.T) {
+		explain, err := o.Optimize(indexes, []Where{
+			{
+				Or: []Where{
+					{
+						Field: "contact.email",
+						Op:    WhereOpEq,
+						Value: gofakeit.Email(),
+					},
+					{
+						Field: "language",
+						Op:    WhereOpEq,
+						Value: "english",
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, explain.Union, 2)
+		assert.Equal(t, "contact.email", explain.Union[0].MatchedFields[0])
+		assert.Equal(t, "language", explain.Union[1].MatchedFields[0])
+	})
+	t.Run("union of primary & secondary index (or)", func(t *testing.T) {
+		explain, err := o.Optimize(indexes, []Where{
+			{
+				Or: []Where{
+					{
+						Field: "_id",
+						Op:    WhereOpEq,
+						Value: "1",
+					},
+					{
+						Field: "language",
+						Op:    WhereOpEq,
+						Value: "english",
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, explain.Union, 2)
+		assert.Equal(t, true, explain.Union[0].Index.Primary)
+		assert.Equal(t, false, explain.Union[1].Index.Primary)
+	})
+	t.Run("no union if a clause isn't indexed (or)", func(t *testing.T) {
+		explain, err := o.Optimize(indexes, []Where{
+			{
+				Or: []Where{
+					{
+						Field: "contact.email",
+						Op:    WhereOpEq,
+						Value: gofakeit.Email(),
+					},
+					{
+						Field: "age",
+						Op:    WhereOpEq,
+						Value: 10,
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, explain.Union)
+		assert.Equal(t, true, explain.Index.Primary)
+	})
+	t.Run("prefer an indexed and clause over a union (or)", func(t *testing.T) {
+		explain, err := o.Optimize(indexes, []Where{
+			{
+				Field: "language",
+				Op:    WhereOpEq,
+				Value: "english",
+			},
+			{
+				Or: []Where{
+					{
+						Field: "contact.email",
+						Op:    WhereOpEq,
+						Value: gofakeit.Email(),
+					},
+					{
+						Field: "_id",
+						Op:    WhereOpEq,
+						Value: "1",
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, explain.Union)
+		assert.Equal(t, "language", explain.MatchedFields[0])
+	})
+}
+
+func TestIndexOrder(t *testing.T) {
+	o := defaultOptimizer{}
+	schema, err := newCollectionSchema([]byte(userSchema))
+	assert.NoError(t, err)
+	t.Run("no order by", func(t *testing.T) {
+		explain, err := o.Optimize(schema, nil)
+		assert.NoError(t, err)
+		reverse, ok := indexOrder(explain, nil)
+		assert.True(t, ok)
+		assert.False(t, reverse)
+	})
+	t.Run("primary key (desc)", func(t *testing.T) {
+		explain, err := o.Optimize(schema, nil)
+		assert.NoError(t, err)
+		reverse, ok := indexOrder(explain, []OrderBy{{Field: "_id", Direction: OrderByDirectionDesc}})
+		assert.True(t, ok)
+		assert.True(t, reverse)
+	})
+	t.Run("unindexed order by", func(t *testing.T) {
+		explain, err := o.Optimize(schema, nil)
+		assert.NoError(t, err)
+		_, ok := indexOrder(explain, []OrderBy{{Field: "age", Direction: OrderByDirectionAsc}})
+		assert.False(t, ok)
+	})
+	t.Run("matched field & next index field", func(t *testing.T) {
+		explain, err := o.Optimize(schema, []Where{
+			{
+				Field: "account_id",
+				Op:    WhereOpEq,
+				Value: "1",
+			},
+			{
+				Field: "contact.email",
+				Op:    WhereOpGte,
+				Value: "a",
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "account_email_idx", explain.Index.Name)
+		reverse, ok := indexOrder(explain, []OrderBy{
+			{Field: "account_id", Direction: OrderByDirectionDesc},
+			{Field: "contact.email", Direction: OrderByDirectionAsc},
+		})
+		assert.True(t, ok)
+		assert.False(t, reverse)
+		_, ok = indexOrder(explain, []OrderBy{{Field: "name", Direction: OrderByDirectionDesc}})
+		assert.False(t, ok)
+	})
+	t.Run("seek direction", func(t *testing.T) {
+		explain, err := o.Optimize(schema, []Where{
+			{
+				Field: "timestamp",
+				Op:    WhereOpGt,
+				Value: time.Now().Format(time.RFC3339),
+			},
+		})
+		assert.NoError(t, err)
+		reverse, ok := indexOrder(explain, []OrderBy{{Field: "timestamp", Direction: OrderByDirectionAsc}})
+		assert.True(t, ok)
+		assert.False(t, reverse)
+		_, ok = indexOrder(explain, []OrderBy{{Field: "timestamp", Direction: OrderByDirectionDesc}})
+		assert.False(t, ok)
+	})
+	t.Run("union", func(t *testing.T) {
+		explain, err := o.Optimize(schema, []Where{
+			{
+				Or: []Where{
+					{Field: "language", Op: WhereOpEq, Value: "english"},
+					{Field: "_id", Op: WhereOpEq, Value: "1"},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.NotEmpty(t, explain.Union)
+		_, ok := indexOrder(explain, nil)
+		assert.False(t, ok)
+	})
 }
@@ -3,6 +3,7 @@ package myjson
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // DBOpt is an option for configuring a collection
@@ -28,3 +29,26 @@ func WithGlobalJavascriptFunctions(scripts []string) DBOpt {
 		d.globalScripts = fmt.Sprintln(strings.Join(scripts, "\n"))
 	}
 }
+
+// WithTTLReaper configures the background goroutine that deletes expired documents from collections with an x-ttl.
+// The reaper runs every interval, deletes at most batchSize documents per transaction & scans the given namespaces (default: "default")
+func WithTTLReaper(interval time.Duration, batchSize int, namespaces ...string) DBOpt {
+	return func(d *defaultDB) {
+		if interval > 0 {
+			d.ttlReaper.interval = interval
+		}
+		if batchSize > 0 {
+			d.ttlReaper.batchSize = batchSize
+		}
+		if len(namespaces) > 0 {
+			d.ttlReaper.namespaces = namespaces
+		}
+	}
+}
+
+// WithRetryPolicy configures Database.Tx to re-run transactions that fail with a conflict error. It may be overridden per call with SetTxRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) DBOpt {
+	return func(d *defaultDB) {
+		d.retryPolicy = policy
+	}
+}
@@ -0,0 +1,68 @@
+package myjson
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/autom8ter/myjson/errors"
+)
+
+// RetryPolicy configures how Database.Tx re-runs transactions that fail with an errors.Conflict error. The zero value
+// disables retries
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the transaction is run - values less than 2 disable retries
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries (0 = no cap)
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after every retry (default: 2)
+	Multiplier float64
+	// Jitter is the fraction (0-1) of each delay that is randomized so that conflicting transactions don't retry in lockstep
+	Jitter float64
+}
+
+// DefaultRetryPolicy is a retry policy suitable for most workloads
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	Jitter:         0.5,
+}
+
+// backoff returns the delay before the given retry (starting at 1)
+func (r RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := r.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(r.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if r.MaxBackoff > 0 && delay > float64(r.MaxBackoff) {
+		delay = float64(r.MaxBackoff)
+	}
+	if r.Jitter > 0 {
+		delay -= delay * math.Min(r.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// shouldRetry returns true if a transaction that failed with the given error on the given attempt (starting at 1) should be run again
+func (r RetryPolicy) shouldRetry(attempt int, err error) bool {
+	if err == nil || attempt >= r.MaxAttempts {
+		return false
+	}
+	return errors.Extract(err).Code == errors.Conflict
+}
+
+// SetTxRetryPolicy overrides the database's retry policy for calls to Tx made with the returned context
+func SetTxRetryPolicy(ctx context.Context, policy RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey, policy)
+}
+
+func getTxRetryPolicy(ctx context.Context) (RetryPolicy, bool) {
+	policy, ok := ctx.Value(retryPolicyKey).(RetryPolicy)
+	return policy, ok
+}
@@ -0,0 +1,55 @@
+package myjson
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/autom8ter/myjson/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	t.Run("backoff grows exponentially", func(t *testing.T) {
+		policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond, Multiplier: 2}
+		assert.Equal(t, 10*time.Millisecond, policy.backoff(1))
+		assert.Equal(t, 20*time.Millisecond, policy.backoff(2))
+		assert.Equal(t, 40*time.Millisecond, policy.backoff(3))
+	})
+	t.Run("backoff defaults to a multiplier of 2", func(t *testing.T) {
+		policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond}
+		assert.Equal(t, 40*time.Millisecond, policy.backoff(3))
+	})
+	t.Run("backoff is capped", func(t *testing.T) {
+		policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 25 * time.Millisecond}
+		assert.Equal(t, 25*time.Millisecond, policy.backoff(10))
+	})
+	t.Run("backoff is jittered", func(t *testing.T) {
+		policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, Jitter: 0.5}
+		for i := 0; i < 100; i++ {
+			delay := policy.backoff(1)
+			assert.LessOrEqual(t, delay, 100*time.Millisecond)
+			assert.GreaterOrEqual(t, delay, 50*time.Millisecond)
+		}
+	})
+	t.Run("only conflicts are retried", func(t *testing.T) {
+		policy := RetryPolicy{MaxAttempts: 3}
+		assert.True(t, policy.shouldRetry(1, errors.New(errors.Conflict, "conflict")))
+		assert.True(t, policy.shouldRetry(2, errors.Wrap(errors.New(errors.Conflict, "conflict"), 0, "rolled back")))
+		assert.False(t, policy.shouldRetry(3, errors.New(errors.Conflict, "conflict")))
+		assert.False(t, policy.shouldRetry(1, errors.New(errors.Validation, "invalid")))
+		assert.False(t, policy.shouldRetry(1, fmt.Errorf("unknown")))
+		assert.False(t, policy.shouldRetry(1, nil))
+	})
+	t.Run("zero value disables retries", func(t *testing.T) {
+		assert.False(t, RetryPolicy{}.shouldRetry(1, errors.New(errors.Conflict, "conflict")))
+	})
+	t.Run("context override", func(t *testing.T) {
+		_, ok := getTxRetryPolicy(context.Background())
+		assert.False(t, ok)
+		policy, ok := getTxRetryPolicy(SetTxRetryPolicy(context.Background(), DefaultRetryPolicy))
+		assert.True(t, ok)
+		assert.Equal(t, DefaultRetryPolicy, policy)
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/util"
@@ -31,6 +32,8 @@ type collectionSchema struct {
 	readOnly       bool
 	mu             sync.RWMutex
 	authz          Authz
+	ttl            *TTL
+	compression    Compression
 }
 
 type schemaPath string
@@ -49,6 +52,8 @@ const (
 	refPrefix                   = "common."
 	authzPath        schemaPath = "x-authorization"
 	preventDeletes   schemaPath = "x-prevent-deletes"
+	ttlPath          schemaPath = "x-ttl"
+	compressionPath  schemaPath = "x-compression"
 )
 
 func newCollectionSchema(yamlContent []byte) (CollectionSchema, error) {
@@ -74,6 +79,10 @@ func newCollectionSchema(yamlContent []byte) (CollectionSchema, error) {
 		readOnly:       r.Get(string(readOnlyPath)).Bool(),
 		immutable:      r.Get(string(immutablePath)).Bool(),
 		preventDeletes: r.Get(string(preventDeletes)).Bool(),
+		compression:    Compression(r.Get(string(compressionPath)).String()),
+	}
+	if !s.compression.valid() {
+		return nil, errors.New(errors.Validation, "invalid x-compression: unsupported codec: %s", s.compression)
 	}
 	if err := s.loadProperties(s.properties, s.raw.Get("properties")); err != nil {
 		return nil, err
@@ -118,6 +127,34 @@ func newCollectionSchema(yamlContent []byte) (CollectionSchema, error) {
 			return nil, errors.Wrap(err, errors.Validation, "invalid x-authorization")
 		}
 	}
+	if ttl := s.raw.Get(string(ttlPath)); ttl.Exists() {
+		var t TTL
+		if err := util.Decode(ttl.Value(), &t); err != nil {
+			return nil, errors.Wrap(err, errors.Validation, "invalid x-ttl")
+		}
+		if t.Field == "" && t.Duration == "" {
+			return nil, errors.New(errors.Validation, "invalid x-ttl: a field or duration is required")
+		}
+		if t.Duration != "" {
+			t.duration, err = time.ParseDuration(t.Duration)
+			if err != nil || t.duration <= 0 {
+				return nil, errors.New(errors.Validation, "invalid x-ttl: bad duration: %s", t.Duration)
+			}
+			if t.Field == "" {
+				t.Field = defaultTTLField
+			}
+		}
+		if s.immutable || s.preventDeletes {
+			return nil, errors.New(errors.Validation, "invalid x-ttl: expired documents cannot be deleted from collection: %s", s.collection)
+		}
+		s.ttl = &t
+		// the expiry field is indexed so that expired documents can be found with a range scan
+		idxName := fmt.Sprintf("%s.ttlidx", t.Field)
+		s.indexing[idxName] = Index{
+			Name:   idxName,
+			Fields: []string{t.Field},
+		}
+	}
 	return s, nil
 }
 
@@ -150,6 +187,7 @@ func (c *collectionSchema) loadProperties(properties map[string]SchemaProperty,
 			Name:        key,
 			Description: value.Get("description").String(),
 			Type:        value.Get("type").String(),
+			Format:      value.Get("format").String(),
 			Unique:      value.Get(string(uniquePath)).Bool(),
 			Immutable:   value.Get(string(immutablePath)).Bool(),
 			Path:        path,
@@ -253,6 +291,8 @@ func (c *collectionSchema) refreshSchema(jsonContent []byte) error {
 	c.preventDeletes = newSchema.preventDeletes
 	c.triggers = newSchema.triggers
 	c.primaryIndex = newSchema.primaryIndex
+	c.ttl = newSchema.ttl
+	c.compression = newSchema.compression
 	return nil
 }
 
@@ -314,6 +354,20 @@ func (c *collectionSchema) PreventDeletes() bool {
 	return c.preventDeletes
 }
 
+// TTL returns the collection's document expiration configuration (if it exists)
+func (c *collectionSchema) TTL() *TTL {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ttl
+}
+
+// Compression returns the codec used to compress the collection's documents
+func (c *collectionSchema) Compression() Compression {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.compression
+}
+
 func (c *collectionSchema) ValidateDocument(ctx context.Context, doc *Document) error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -4,7 +4,9 @@ import (
 	"context"
 	// import embed package
 	_ "embed"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -19,6 +21,8 @@ func TestSchema(t *testing.T) {
 		assert.NotEmpty(t, schema.Indexing()["contact.email.uniqueidx"])
 		assert.NotEmpty(t, schema.Indexing()["account_email_idx"])
 		assert.NotEmpty(t, schema.Indexing()["language_idx"])
+		assert.NotEmpty(t, schema.Indexing()["timestamp_idx"])
+		assert.Equal(t, "date-time", schema.PropertyPaths()["timestamp"].Format)
 	})
 	t.Run("json schema validation", func(t *testing.T) {
 		schema, err := newCollectionSchema([]byte(userSchema))
@@ -83,4 +87,57 @@ func TestSchema(t *testing.T) {
 		assert.Equal(t, "contact.email", schema.PropertyPaths()["contact.email"].Path)
 	})
 
+	t.Run("ttl", func(t *testing.T) {
+		const ttlSchema = `
+type: object
+x-collection: session
+x-ttl:
+  duration: 1h
+required:
+  - _id
+properties:
+  _id:
+    type: string
+    x-primary: true
+`
+		schema, err := newCollectionSchema([]byte(ttlSchema))
+		assert.NoError(t, err)
+		assert.NotNil(t, schema.TTL())
+		assert.Equal(t, "_expires_at", schema.TTL().Field)
+		assert.Equal(t, time.Hour, schema.TTL().duration)
+		assert.Equal(t, []string{"_expires_at"}, schema.Indexing()["_expires_at.ttlidx"].Fields)
+
+		_, err = newCollectionSchema([]byte(strings.Replace(ttlSchema, "1h", "forever", 1)))
+		assert.Error(t, err)
+		_, err = newCollectionSchema([]byte(strings.Replace(ttlSchema, "x-ttl:", "x-immutable: true\nx-ttl:", 1)))
+		assert.Error(t, err)
+
+		schema, err = newCollectionSchema([]byte(taskSchema))
+		assert.NoError(t, err)
+		assert.Nil(t, schema.TTL())
+	})
+
+	t.Run("compression", func(t *testing.T) {
+		const compressedSchema = `
+type: object
+x-collection: event
+x-compression: zstd
+required:
+  - _id
+properties:
+  _id:
+    type: string
+    x-primary: true
+`
+		schema, err := newCollectionSchema([]byte(compressedSchema))
+		assert.NoError(t, err)
+		assert.Equal(t, CompressionZstd, schema.Compression())
+
+		_, err = newCollectionSchema([]byte(strings.Replace(compressedSchema, "zstd", "gzip", 1)))
+		assert.Error(t, err)
+
+		schema, err = newCollectionSchema([]byte(taskSchema))
+		assert.NoError(t, err)
+		assert.Equal(t, Compression(""), schema.Compression())
+	})
 }
@@ -17,6 +17,8 @@ import (
 
 	// import badger kv provider
 	_ "github.com/autom8ter/myjson/kv/badger"
+	// import memory kv provider
+	_ "github.com/autom8ter/myjson/kv/memory"
 )
 
 var (
@@ -94,7 +96,7 @@ func Test(t *testing.T, cfg TestConfig, fn TestFunc) func(*testing.T) {
 			"storage_path": dir,
 		}, cfg.Opts...)
 	} else {
-		db, err = myjson.Open(ctx, "badger", map[string]any{}, cfg.Opts...)
+		db, err = myjson.Open(ctx, "memory", map[string]any{}, cfg.Opts...)
 	}
 	assert.NoError(t, err)
 	closers = append(closers, func() {
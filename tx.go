@@ -1,12 +1,13 @@
 package myjson
 
 import (
+	"bytes"
 	"context"
+	"sort"
 	"time"
 
 	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/kv"
-	"github.com/autom8ter/myjson/util"
 	"github.com/dop251/goja"
 	"github.com/samber/lo"
 	"github.com/segmentio/ksuid"
@@ -45,6 +46,17 @@ func (t *transaction) Rollback(ctx context.Context) error {
 }
 
 func (t *transaction) Update(ctx context.Context, collection string, id string, update map[string]any) error {
+	return t.update(ctx, collection, id, update, 0)
+}
+
+func (t *transaction) UpdateIfVersion(ctx context.Context, collection string, id string, version int64, update map[string]any) error {
+	if version <= 0 {
+		return errors.New(errors.Validation, "tx: expected version must be greater than 0")
+	}
+	return t.update(ctx, collection, id, update, version)
+}
+
+func (t *transaction) update(ctx context.Context, collection string, id string, update map[string]any, version int64) error {
 	schema, ctx := t.db.getSchema(ctx, collection)
 	if schema == nil {
 		return errors.New(errors.Validation, "tx: unsupported collection: %s", collection)
@@ -57,11 +69,12 @@ func (t *transaction) Update(ctx context.Context, collection string, id string,
 		return errors.Wrap(err, 0, "tx: failed to set primary key")
 	}
 	if err := t.persistCommand(ctx, &persistCommand{
-		Collection: collection,
-		Action:     UpdateAction,
-		Document:   doc,
-		Timestamp:  time.Now().UnixNano(),
-		Metadata:   ExtractMetadata(ctx),
+		Collection:      collection,
+		Action:          UpdateAction,
+		Document:        doc,
+		Timestamp:       time.Now().UnixNano(),
+		Metadata:        ExtractMetadata(ctx),
+		ExpectedVersion: version,
 	}); err != nil {
 		return errors.Wrap(err, 0, "tx: failed to commit update")
 	}
@@ -94,23 +107,81 @@ func (t *transaction) Create(ctx context.Context, collection string, document *D
 }
 
 func (t *transaction) Set(ctx context.Context, collection string, document *Document) error {
+	return t.set(ctx, collection, document, 0)
+}
+
+func (t *transaction) SetIfVersion(ctx context.Context, collection string, version int64, document *Document) error {
+	if version <= 0 {
+		return errors.New(errors.Validation, "tx: expected version must be greater than 0")
+	}
+	return t.set(ctx, collection, document, version)
+}
+
+func (t *transaction) set(ctx context.Context, collection string, document *Document, version int64) error {
 	schema, ctx := t.db.getSchema(ctx, collection)
 	if schema == nil {
 		return errors.New(errors.Validation, "tx: unsupported collection: %s", collection)
 	}
+	if err := t.persistCommand(ctx, &persistCommand{
+		Collection:      collection,
+		Action:          SetAction,
+		Document:        document,
+		Timestamp:       time.Now().UnixNano(),
+		Metadata:        ExtractMetadata(ctx),
+		ExpectedVersion: version,
+	}); err != nil {
+		return errors.Wrap(err, 0, "tx: failed to commit set")
+	}
+	return nil
+}
+
+func (t *transaction) Upsert(ctx context.Context, collection, id string, update map[string]any, onInsert map[string]any) error {
+	schema, ctx := t.db.getSchema(ctx, collection)
+	if schema == nil {
+		return errors.New(errors.Validation, "tx: unsupported collection: %s", collection)
+	}
+	if id == "" {
+		return errors.New(errors.Validation, "tx: upsert command - empty document id")
+	}
+	if _, err := t.Get(ctx, collection, id); err == nil {
+		return t.update(ctx, collection, id, update, 0)
+	} else if errors.Extract(err).Code != errors.NotFound {
+		return errors.Wrap(err, 0, "tx: failed to commit upsert")
+	}
+	doc := NewDocument()
+	if err := doc.ApplyUpdate(onInsert); err != nil {
+		return errors.Wrap(err, 0, "tx: failed to commit upsert")
+	}
+	if err := doc.ApplyUpdate(update); err != nil {
+		return errors.Wrap(err, 0, "tx: failed to commit upsert")
+	}
+	if err := schema.SetPrimaryKey(doc, id); err != nil {
+		return errors.Wrap(err, 0, "tx: failed to set primary key")
+	}
 	if err := t.persistCommand(ctx, &persistCommand{
 		Collection: collection,
-		Action:     SetAction,
-		Document:   document,
+		Action:     CreateAction,
+		Document:   doc,
 		Timestamp:  time.Now().UnixNano(),
 		Metadata:   ExtractMetadata(ctx),
 	}); err != nil {
-		return errors.Wrap(err, 0, "tx: failed to commit set")
+		return errors.Wrap(err, 0, "tx: failed to commit upsert")
 	}
 	return nil
 }
 
 func (t *transaction) Delete(ctx context.Context, collection string, id string) error {
+	return t.delete(ctx, collection, id, 0)
+}
+
+func (t *transaction) DeleteIfVersion(ctx context.Context, collection string, id string, version int64) error {
+	if version <= 0 {
+		return errors.New(errors.Validation, "tx: expected version must be greater than 0")
+	}
+	return t.delete(ctx, collection, id, version)
+}
+
+func (t *transaction) delete(ctx context.Context, collection string, id string, version int64) error {
 	schema, ctx := t.db.getSchema(ctx, collection)
 	if schema == nil {
 		return errors.New(errors.Validation, "tx: unsupported collection: %s", collection)
@@ -119,11 +190,12 @@ func (t *transaction) Delete(ctx context.Context, collection string, id string)
 		t.db.GetSchema(ctx, collection).PrimaryKey(): id,
 	})
 	if err := t.persistCommand(ctx, &persistCommand{
-		Collection: collection,
-		Action:     DeleteAction,
-		Document:   d,
-		Timestamp:  time.Now().UnixNano(),
-		Metadata:   ExtractMetadata(ctx),
+		Collection:      collection,
+		Action:          DeleteAction,
+		Document:        d,
+		Timestamp:       time.Now().UnixNano(),
+		Metadata:        ExtractMetadata(ctx),
+		ExpectedVersion: version,
 	}); err != nil {
 		return errors.Wrap(err, 0, "tx: failed to commit delete")
 	}
@@ -155,26 +227,102 @@ func (t *transaction) Query(ctx context.Context, collection string, query Query)
 	defer cancel()
 	now := time.Now()
 
-	var results Documents
-	fullScan := true
-	match, err := t.queryScan(ctx, collection, query.Where, query.Join, func(d *Document) (bool, error) {
-		results = append(results, d)
-		if query.Page == 0 && len(query.OrderBy) == 0 && query.Limit > 0 && len(results) >= query.Limit {
-			fullScan = false
-			return false, nil
+	var (
+		results  Documents
+		fullScan = true
+		cursor   queryCursor
+		after    []byte
+		orderBy  = query.OrderBy
+		// paginate is true if the page should end with a cursor to the next page
+		paginate = query.Limit > 0 && query.Page == 0
+		// hasMore is true if there are more results after the page
+		hasMore bool
+		lastKey []byte
+	)
+	if query.Cursor != "" {
+		cursor, err = decodeQueryCursor(query.Cursor)
+		if err != nil {
+			return Page{}, err
 		}
-		return true, nil
-	})
+	}
+	explain, err := t.db.optimizer.Optimize(schema, query.Where)
 	if err != nil {
 		return Page{}, err
 	}
-	results = orderByDocs(results, query.OrderBy)
+	// results in index order are paginated by their index key so that the next page can seek the index directly - results that
+	// are ordered in memory are paginated by their order by values
+	reverse, keyset := indexOrder(explain, query.OrderBy)
+	if keyset {
+		explain.Reverse = reverse
+	} else {
+		// the primary key breaks ties so that the same documents are kept regardless of the order they were scanned in
+		orderBy = cursorOrderBy(schema, orderBy)
+	}
+	if query.Cursor != "" {
+		switch {
+		case keyset && (len(cursor.Key) == 0 || cursor.Index != explain.Index.Name):
+			return Page{}, errors.New(errors.Validation, "cursor does not match query")
+		case !keyset && len(cursor.Values) == 0:
+			return Page{}, errors.New(errors.Validation, "cursor does not match query")
+		}
+		after = cursor.Key
+	}
+	var (
+		// ordered holds the documents that are ordered in memory - only the documents up to the end of the page (and one more
+		// to detect if there are more results) are kept
+		ordered = &documentHeap{c: schema, orderBy: orderBy}
+		size    int
+	)
+	if query.Limit > 0 {
+		size = query.Limit*(query.Page+1) + 1
+	}
+	scanner := t.newQueryScanner(ctx, schema, explain, query.Where, query.Join, after)
+	defer scanner.close()
+	for {
+		scanned, ok, err := scanner.next()
+		if err != nil {
+			return Page{}, err
+		}
+		if !ok {
+			break
+		}
+		if !keyset {
+			if len(cursor.Values) > 0 && !cursor.after(schema, scanned.doc, orderBy) {
+				continue
+			}
+			ordered.keep(scanned.doc, size)
+			continue
+		}
+		// documents joined from the same index entry are kept on the same page so that the next page may resume after the entry
+		if paginate && len(results) >= query.Limit && !bytes.Equal(scanned.key, lastKey) {
+			fullScan = false
+			hasMore = true
+			break
+		}
+		results = append(results, scanned.doc)
+		lastKey = scanned.key
+	}
+	if !keyset {
+		results = ordered.documents
+		sort.Slice(results, func(i, j int) bool {
+			return compareDocs(schema, results[i], results[j], orderBy) < 0
+		})
+	}
 
 	if fullScan && query.Limit > 0 && query.Page > 0 {
 		results = lo.Slice(results, query.Limit*query.Page, (query.Limit*query.Page)+query.Limit)
 	}
-	if query.Limit > 0 && len(results) > query.Limit {
+	if !keyset && query.Limit > 0 && len(results) > query.Limit {
 		results = results[:query.Limit]
+		hasMore = true
+	}
+	var nextCursor string
+	if paginate && hasMore {
+		if keyset {
+			nextCursor = queryCursor{Index: explain.Index.Name, Key: lastKey}.encode()
+		} else {
+			nextCursor = queryCursor{Values: cursorValues(results[len(results)-1], orderBy)}.encode()
+		}
 	}
 
 	if len(query.Select) > 0 && query.Select[0].Field != "*" {
@@ -187,12 +335,13 @@ func (t *transaction) Query(ctx context.Context, collection string, query Query)
 	}
 
 	return Page{
-		Documents: results,
-		NextPage:  query.Page + 1,
-		Count:     len(results),
+		Documents:  results,
+		NextPage:   query.Page + 1,
+		NextCursor: nextCursor,
+		Count:      len(results),
 		Stats: PageStats{
 			ExecutionTime: time.Since(now),
-			Explain:       &match,
+			Explain:       &explain,
 		},
 	}, nil
 }
@@ -241,7 +390,7 @@ func (t *transaction) Cmd(ctx context.Context, cmd TxCmd) TxResponse {
 			Create: cmd.Create.Document,
 		}
 	case cmd.Set != nil:
-		err := t.Set(ctx, cmd.Set.Collection, cmd.Set.Document)
+		err := t.set(ctx, cmd.Set.Collection, cmd.Set.Document, cmd.Set.Version)
 		if err != nil {
 			return TxResponse{Error: errors.Extract(err)}
 		}
@@ -249,7 +398,7 @@ func (t *transaction) Cmd(ctx context.Context, cmd TxCmd) TxResponse {
 			Set: cmd.Set.Document,
 		}
 	case cmd.Delete != nil:
-		err := t.Delete(ctx, cmd.Delete.Collection, cmd.Delete.ID)
+		err := t.delete(ctx, cmd.Delete.Collection, cmd.Delete.ID, cmd.Delete.Version)
 		if err != nil {
 			return TxResponse{Error: errors.Extract(err)}
 		}
@@ -265,7 +414,7 @@ func (t *transaction) Cmd(ctx context.Context, cmd TxCmd) TxResponse {
 			Get: doc,
 		}
 	case cmd.Update != nil:
-		err := t.Update(ctx, cmd.Update.Collection, cmd.Update.ID, cmd.Update.Update)
+		err := t.update(ctx, cmd.Update.Collection, cmd.Update.ID, cmd.Update.Update, cmd.Update.Version)
 		if err != nil {
 			return TxResponse{Error: errors.Extract(err)}
 		}
@@ -276,6 +425,18 @@ func (t *transaction) Cmd(ctx context.Context, cmd TxCmd) TxResponse {
 		return TxResponse{
 			Update: doc,
 		}
+	case cmd.Upsert != nil:
+		err := t.Upsert(ctx, cmd.Upsert.Collection, cmd.Upsert.ID, cmd.Upsert.Update, cmd.Upsert.OnInsert)
+		if err != nil {
+			return TxResponse{Error: errors.Extract(err)}
+		}
+		doc, err := t.Get(ctx, cmd.Upsert.Collection, cmd.Upsert.ID)
+		if err != nil {
+			return TxResponse{Error: errors.Extract(err)}
+		}
+		return TxResponse{
+			Upsert: doc,
+		}
 	case cmd.TimeTravel != nil:
 		doc, err := t.TimeTravel(ctx, cmd.TimeTravel.Collection, cmd.TimeTravel.ID, cmd.TimeTravel.Timestamp)
 		if err != nil {
@@ -305,7 +466,7 @@ func (t *transaction) aggregate(ctx context.Context, collection string, query Qu
 	defer cancel()
 	now := time.Now()
 	var results Documents
-	match, err := t.queryScan(ctx, collection, query.Where, query.Join, func(d *Document) (bool, error) {
+	match, err := t.queryScan(ctx, collection, query.Where, query.Join, nil, func(d *Document, key []byte) (bool, error) {
 		results = append(results, d)
 		return true, nil
 	})
@@ -320,11 +481,11 @@ func (t *transaction) aggregate(ctx context.Context, collection string, query Qu
 		}
 		reduced = append(reduced, value)
 	}
-	reduced, err = docsHaving(query.Having, reduced)
+	reduced, err = docsHaving(c, query.Having, reduced)
 	if err != nil {
 		return Page{}, errors.Wrap(err, errors.Internal, "")
 	}
-	reduced = orderByDocs(reduced, query.OrderBy)
+	reduced = orderByDocs(c, reduced, query.OrderBy)
 	if query.Limit > 0 && query.Page > 0 {
 		reduced = lo.Slice(reduced, query.Limit*query.Page, (query.Limit*query.Page)+query.Limit)
 	}
@@ -342,19 +503,21 @@ func (t *transaction) aggregate(ctx context.Context, collection string, query Qu
 	}, nil
 }
 
-func docsHaving(where []Where, results Documents) (Documents, error) {
-	if len(where) > 0 {
-		for i, document := range results {
-			pass, err := document.Where(where)
-			if err != nil {
-				return nil, err
-			}
-			if pass {
-				results = util.RemoveElement(i, results)
-			}
+func docsHaving(c CollectionSchema, where []Where, results Documents) (Documents, error) {
+	if len(where) == 0 {
+		return results, nil
+	}
+	var having Documents
+	for _, document := range results {
+		pass, err := document.whereSchema(c, where)
+		if err != nil {
+			return nil, err
+		}
+		if pass {
+			having = append(having, document)
 		}
 	}
-	return results, nil
+	return having, nil
 }
 
 func (t *transaction) ForEach(ctx context.Context, collection string, opts ForEachOpts, fn ForEachFunc) (Explain, error) {
@@ -368,7 +531,9 @@ func (t *transaction) ForEach(ctx context.Context, collection string, opts ForEa
 	if !pass {
 		return Explain{}, errors.New(errors.Forbidden, "not authorized: %s", QueryAction)
 	}
-	return t.queryScan(ctx, collection, opts.Where, opts.Join, fn)
+	return t.queryScan(ctx, collection, opts.Where, opts.Join, nil, func(d *Document, key []byte) (bool, error) {
+		return fn(d)
+	})
 }
 
 func (t *transaction) Close(ctx context.Context) {
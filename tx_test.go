@@ -2,10 +2,14 @@ package myjson_test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/autom8ter/myjson"
+	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/kv"
 	"github.com/autom8ter/myjson/testutil"
 	"github.com/brianvoe/gofakeit/v6"
@@ -239,3 +243,348 @@ func TestTx(t *testing.T) {
 		}))
 	})
 }
+
+func TestTxVersions(t *testing.T) {
+	t.Run("versions are maintained", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			doc := testutil.NewUserDoc()
+			id := doc.GetString("_id")
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				assert.NoError(t, tx.Set(ctx, "user", doc))
+				assert.Equal(t, int64(1), doc.Version())
+				// versions set by the caller are ignored
+				assert.NoError(t, tx.Update(ctx, "user", id, map[string]any{"age": 20, myjson.VersionField: 100}))
+				return nil
+			}))
+			doc, err := db.Get(ctx, "user", id)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), doc.Version())
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				return tx.Set(ctx, "user", doc)
+			}))
+			doc, err = db.Get(ctx, "user", id)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(3), doc.Version())
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				created := myjson.D().Set(map[string]any{"name": "versioned"}).Doc()
+				_, err := tx.Create(ctx, "account", created)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), created.Version())
+				return nil
+			}))
+		}))
+	})
+	t.Run("conditional writes", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			doc := testutil.NewUserDoc()
+			id := doc.GetString("_id")
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				return tx.Set(ctx, "user", doc)
+			}))
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				err := tx.SetIfVersion(ctx, "user", 2, doc)
+				assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+				assert.NoError(t, tx.SetIfVersion(ctx, "user", 1, doc))
+
+				err = tx.UpdateIfVersion(ctx, "user", id, 1, map[string]any{"age": 20})
+				assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+				assert.NoError(t, tx.UpdateIfVersion(ctx, "user", id, 2, map[string]any{"age": 20}))
+
+				err = tx.DeleteIfVersion(ctx, "user", id, 2)
+				assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+				assert.NoError(t, tx.DeleteIfVersion(ctx, "user", id, 3))
+				return nil
+			}))
+			_, err := db.Get(ctx, "user", id)
+			assert.Error(t, err)
+		}))
+	})
+	t.Run("conditional writes to missing documents conflict", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				err := tx.SetIfVersion(ctx, "user", 1, testutil.NewUserDoc())
+				assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+				err = tx.UpdateIfVersion(ctx, "user", "missing", 1, map[string]any{"age": 20})
+				assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+				err = tx.DeleteIfVersion(ctx, "user", "missing", 1)
+				assert.Equal(t, errors.Conflict, errors.Extract(err).Code)
+				return nil
+			}))
+		}))
+	})
+	t.Run("expected versions must be positive", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				err := tx.SetIfVersion(ctx, "user", 0, testutil.NewUserDoc())
+				assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+				return nil
+			}))
+		}))
+	})
+	t.Run("cmd - conditional writes", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				result := tx.Cmd(ctx, myjson.TxCmd{
+					Set: &myjson.SetCmd{Collection: "user", Document: testutil.NewUserDoc()},
+				})
+				assert.Nil(t, result.Error)
+				id := result.Set.GetString("_id")
+				assert.Equal(t, int64(1), result.Set.Version())
+				result = tx.Cmd(ctx, myjson.TxCmd{
+					Update: &myjson.UpdateCmd{Collection: "user", ID: id, Update: map[string]any{"age": 20}, Version: 2},
+				})
+				if assert.NotNil(t, result.Error) {
+					assert.Equal(t, errors.Conflict, result.Error.Code)
+				}
+				result = tx.Cmd(ctx, myjson.TxCmd{
+					Update: &myjson.UpdateCmd{Collection: "user", ID: id, Update: map[string]any{"age": 20}, Version: 1},
+				})
+				assert.Nil(t, result.Error)
+				assert.Equal(t, int64(2), result.Update.Version())
+				result = tx.Cmd(ctx, myjson.TxCmd{
+					Delete: &myjson.DeleteCmd{Collection: "user", ID: id, Version: 1},
+				})
+				if assert.NotNil(t, result.Error) {
+					assert.Equal(t, errors.Conflict, result.Error.Code)
+				}
+				result = tx.Cmd(ctx, myjson.TxCmd{
+					Delete: &myjson.DeleteCmd{Collection: "user", ID: id, Version: 2},
+				})
+				assert.Nil(t, result.Error)
+				return nil
+			}))
+		}))
+	})
+}
+
+func TestTxUpdateOperators(t *testing.T) {
+	t.Run("operators are applied against the current document", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			doc := testutil.NewUserDoc()
+			assert.NoError(t, doc.Set("age", 10))
+			id := doc.GetString("_id")
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				return tx.Set(ctx, "user", doc)
+			}))
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				return tx.Update(ctx, "user", id, map[string]any{
+					"name":                             "updated",
+					string(myjson.UpdateOpInc):         map[string]any{"age": 5},
+					string(myjson.UpdateOpAddToSet):    map[string]any{"annotations.tags": "vip"},
+					string(myjson.UpdateOpCurrentDate): map[string]any{"annotations.updated_at": true},
+				})
+			}))
+			updated, err := db.Get(ctx, "user", id)
+			assert.NoError(t, err)
+			assert.Equal(t, "updated", updated.GetString("name"))
+			assert.Equal(t, 15, updated.GetInt("age"))
+			assert.Equal(t, []any{"vip"}, updated.GetArray("annotations.tags"))
+			assert.True(t, updated.Exists("annotations.updated_at"))
+			assert.Equal(t, doc.GetString("contact.email"), updated.GetString("contact.email"))
+		}))
+	})
+	t.Run("updated documents are validated", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			doc := testutil.NewUserDoc()
+			assert.NoError(t, doc.Set("age", 1))
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				return tx.Set(ctx, "user", doc)
+			}))
+			err := db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				return tx.Update(ctx, "user", doc.GetString("_id"), map[string]any{
+					string(myjson.UpdateOpInc): map[string]any{"age": -2},
+				})
+			})
+			assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+		}))
+	})
+	t.Run("concurrent increments are not lost", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			doc := testutil.NewUserDoc()
+			assert.NoError(t, doc.Set("age", 0))
+			id := doc.GetString("_id")
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				return tx.Set(ctx, "user", doc)
+			}))
+			ctx = myjson.SetTxRetryPolicy(ctx, myjson.RetryPolicy{
+				MaxAttempts:    100,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     20 * time.Millisecond,
+				Jitter:         1,
+			})
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+						return tx.Update(ctx, "user", id, map[string]any{
+							string(myjson.UpdateOpInc): map[string]any{"age": 1},
+						})
+					}))
+				}()
+			}
+			wg.Wait()
+			updated, err := db.Get(ctx, "user", id)
+			assert.NoError(t, err)
+			assert.Equal(t, 10, updated.GetInt("age"))
+		}))
+	})
+	t.Run("defaults don't override operators", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			counterSchema := `
+type: object
+x-collection: counter
+required:
+  - _id
+properties:
+  _id:
+    type: string
+    x-primary: true
+  count:
+    type: number
+    default: 0
+  status:
+    type: string
+    default: inactive
+`
+			assert.NoError(t, db.Configure(ctx, "", append(testutil.AllCollections, counterSchema)))
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				return tx.Set(ctx, "counter", myjson.D().Set(map[string]any{"_id": "1", "status": "active"}).Doc())
+			}))
+			for i := 0; i < 2; i++ {
+				assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+					return tx.Update(ctx, "counter", "1", map[string]any{
+						string(myjson.UpdateOpInc): map[string]any{"count": 1},
+					})
+				}))
+			}
+			updated, err := db.Get(ctx, "counter", "1")
+			assert.NoError(t, err)
+			assert.Equal(t, 2, updated.GetInt("count"))
+			// fields that are already set aren't reset to their default
+			assert.Equal(t, "active", updated.GetString("status"))
+			// defaults are applied to fields that are missing after the update
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				return tx.Update(ctx, "counter", "1", map[string]any{
+					string(myjson.UpdateOpUnset): map[string]any{"status": true},
+				})
+			}))
+			updated, err = db.Get(ctx, "counter", "1")
+			assert.NoError(t, err)
+			assert.Equal(t, "inactive", updated.GetString("status"))
+		}))
+	})
+	t.Run("cmd - update operators are serializable", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			doc := testutil.NewUserDoc()
+			assert.NoError(t, doc.Set("age", 10))
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				return tx.Set(ctx, "user", doc)
+			}))
+			var cmd myjson.TxCmd
+			assert.NoError(t, json.Unmarshal([]byte(fmt.Sprintf(`{
+				"update": {
+					"collection": "user",
+					"id": %q,
+					"update": {"$inc": {"age": 1}, "$push": {"annotations.history": "incremented"}}
+				}
+			}`, doc.GetString("_id"))), &cmd))
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				result := tx.Cmd(ctx, cmd)
+				assert.Nil(t, result.Error)
+				assert.Equal(t, 11, result.Update.GetInt("age"))
+				assert.Equal(t, []any{"incremented"}, result.Update.GetArray("annotations.history"))
+				return nil
+			}))
+		}))
+	})
+}
+
+func TestTxUpsert(t *testing.T) {
+	// actions returns the cdc actions recorded for the document in order
+	actions := func(ctx context.Context, t *testing.T, db myjson.Database, id string) []string {
+		results, err := db.Query(ctx, "system_cdc", myjson.Q().Where(myjson.Where{
+			Field: "documentID",
+			Op:    myjson.WhereOpEq,
+			Value: id,
+		}).OrderBy(myjson.OrderBy{Field: "timestamp", Direction: myjson.OrderByDirectionAsc}).Query())
+		assert.NoError(t, err)
+		var found []string
+		for _, doc := range results.Documents {
+			found = append(found, doc.GetString("action"))
+		}
+		return found
+	}
+	t.Run("upsert creates then updates", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			usr := testutil.NewUserDoc()
+			id := usr.GetString("_id")
+			assert.NoError(t, usr.Del("_id"))
+			upsert := func() {
+				assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+					return tx.Upsert(ctx, "user", id, map[string]any{
+						"name":                     "upserted",
+						string(myjson.UpdateOpInc): map[string]any{"age": 1},
+					}, usr.Value())
+				}))
+			}
+			upsert()
+			doc, err := db.Get(ctx, "user", id)
+			assert.NoError(t, err)
+			assert.Equal(t, "upserted", doc.GetString("name"))
+			assert.Equal(t, usr.GetInt("age")+1, doc.GetInt("age"))
+			assert.Equal(t, usr.GetString("contact.email"), doc.GetString("contact.email"))
+			assert.Equal(t, int64(1), doc.Version())
+
+			assert.NoError(t, usr.Set("contact.email", "ignored@example.com"))
+			upsert()
+			doc, err = db.Get(ctx, "user", id)
+			assert.NoError(t, err)
+			assert.Equal(t, usr.GetInt("age")+2, doc.GetInt("age"))
+			// insert only fields are ignored when the document exists
+			assert.NotEqual(t, "ignored@example.com", doc.GetString("contact.email"))
+			assert.Equal(t, int64(2), doc.Version())
+			assert.Equal(t, []string{string(myjson.CreateAction), string(myjson.UpdateAction)}, actions(ctx, t, db, id))
+		}))
+	})
+	t.Run("upsert requires an id", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				err := tx.Upsert(ctx, "user", "", map[string]any{"name": "upserted"}, nil)
+				assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+				return nil
+			}))
+		}))
+	})
+	t.Run("created documents are validated", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				err := tx.Upsert(ctx, "user", "missing", map[string]any{"name": "upserted"}, nil)
+				assert.Equal(t, errors.Validation, errors.Extract(err).Code)
+				return nil
+			}))
+		}))
+	})
+	t.Run("cmd - upsert", func(t *testing.T) {
+		assert.Nil(t, testutil.TestDB(func(ctx context.Context, db myjson.Database) {
+			usr := testutil.NewUserDoc()
+			id := usr.GetString("_id")
+			assert.Nil(t, db.Tx(ctx, kv.TxOpts{}, func(ctx context.Context, tx myjson.Tx) error {
+				for i := 1; i <= 2; i++ {
+					result := tx.Cmd(ctx, myjson.TxCmd{
+						Upsert: &myjson.UpsertCmd{
+							Collection: "user",
+							ID:         id,
+							Update:     map[string]any{"$inc": map[string]any{"annotations.upserts": 1}},
+							OnInsert:   usr.Value(),
+						},
+					})
+					assert.Nil(t, result.Error)
+					assert.Equal(t, i, result.Upsert.GetInt("annotations.upserts"))
+				}
+				return nil
+			}))
+		}))
+	})
+}
@@ -9,14 +9,17 @@ import (
 
 	"github.com/autom8ter/myjson/errors"
 	"github.com/autom8ter/myjson/kv"
+	"github.com/autom8ter/myjson/kv/kvutil"
 	"github.com/autom8ter/myjson/util"
-	"github.com/nqd/flat"
 	"github.com/samber/lo"
 	"github.com/segmentio/ksuid"
 	"github.com/spf13/cast"
 	"golang.org/x/sync/errgroup"
 )
 
+// scanBatchSize is the maximum number of documents looked up in the primary index at once while scanning a secondary index
+const scanBatchSize = 100
+
 func (t *transaction) updateDocument(ctx context.Context, c CollectionSchema, docID string, before *Document, command *persistCommand) error {
 	if before == nil {
 		return errors.New(errors.Internal, "tx: updateDocument - empty before value")
@@ -24,43 +27,45 @@ func (t *transaction) updateDocument(ctx context.Context, c CollectionSchema, do
 	if c.Immutable() {
 		return errors.New(errors.Forbidden, "tx: collection: %s is immutable", c.Collection())
 	}
+	primaryIndex := c.PrimaryIndex()
+	after := before.Clone()
+	// update operators are applied against the current value of the document
+	if err := after.ApplyUpdate(command.Document.Value()); err != nil {
+		return err
+	}
+	// computed values & defaults are applied to the updated document - never to the update (which may hold operators)
 	for p, v := range c.PropertyPaths() {
 		if v.Compute != nil && v.Compute.Write {
 			val, err := t.vm.RunString(v.Compute.Expr)
 			if err != nil {
 				return errors.Wrap(err, errors.Internal, "failed to compute value")
 			}
-			if err := command.Document.Set(p, val.Export()); err != nil {
+			if err := after.Set(p, val.Export()); err != nil {
 				return errors.Wrap(err, errors.Internal, "failed to set computed property: %s = %v", p, v.Compute)
 			}
 		}
-		if v.Default != nil && !command.Document.Exists(p) {
-			if err := command.Document.Set(p, v.Default); err != nil {
-				return errors.Wrap(err, errors.Internal, "failed to set default property: %s = %v", p, v.Compute)
+		if v.Default != nil && !after.Exists(p) {
+			if err := after.Set(p, v.Default); err != nil {
+				return errors.Wrap(err, errors.Internal, "failed to set default property: %s = %v", p, v.Default)
 			}
 		}
 		if v.Immutable {
-			if err := command.Document.Set(p, before.Get(p)); err != nil {
+			if err := after.Set(p, before.Get(p)); err != nil {
 				return errors.Wrap(err, errors.Internal, "failed to set immutable property")
 			}
 		}
 	}
-	primaryIndex := c.PrimaryIndex()
-	after := before.Clone()
-	flattened, err := flat.Flatten(command.Document.Value(), nil)
-	if err != nil {
-		return err
-	}
-	err = after.SetAll(flattened)
-	if err != nil {
-		return err
+	if err := after.Set(VersionField, nextVersion(before)); err != nil {
+		return errors.Wrap(err, errors.Internal, "failed to set document version")
 	}
 	if err := c.ValidateDocument(ctx, after); err != nil {
 		return err
 	}
+	// secondary indexes & the change data capture diff are computed from the updated document
+	command.Document = after
 	if err := t.tx.Set(ctx, seekPrefix(ctx, c.Collection(), primaryIndex, map[string]any{
 		c.PrimaryKey(): docID,
-	}).Seek(docID).Path(), after.Bytes()); err != nil {
+	}).Seek(docID).Path(), encodeDocument(c.Compression(), after)); err != nil {
 		return errors.Wrap(err, errors.Internal, "failed to batch set documents to primary index")
 	}
 	return nil
@@ -91,6 +96,12 @@ func (t *transaction) createDocument(ctx context.Context, c CollectionSchema, co
 	if err := c.SetPrimaryKey(command.Document, docID); err != nil {
 		return err
 	}
+	// restored documents keep their version
+	if !isRestoring(ctx) || command.Document.Version() == 0 {
+		if err := command.Document.Set(VersionField, nextVersion(nil)); err != nil {
+			return errors.Wrap(err, errors.Internal, "failed to set document version")
+		}
+	}
 	for p, v := range c.PropertyPaths() {
 		if v.Compute != nil && v.Compute.Write {
 			val, err := t.vm.RunString(cast.ToString(v.Compute.Expr))
@@ -112,7 +123,7 @@ func (t *transaction) createDocument(ctx context.Context, c CollectionSchema, co
 	}
 	if err := t.tx.Set(ctx, seekPrefix(ctx, c.Collection(), primaryIndex, map[string]any{
 		c.PrimaryKey(): docID,
-	}).Seek(docID).Path(), command.Document.Bytes()); err != nil {
+	}).Seek(docID).Path(), encodeDocument(c.Compression(), command.Document)); err != nil {
 		return errors.Wrap(err, errors.Internal, "failed to batch set documents to primary index")
 	}
 	return nil
@@ -125,8 +136,15 @@ func (t *transaction) setDocument(ctx context.Context, c CollectionSchema, docID
 	if c.Immutable() && before != nil {
 		return errors.New(errors.Forbidden, "tx: collection: %s is immutable", command.Collection)
 	}
+	// restored documents keep their version
+	if !isRestoring(ctx) || command.Document.Version() == 0 {
+		if err := command.Document.Set(VersionField, nextVersion(before)); err != nil {
+			return errors.Wrap(err, errors.Internal, "failed to set document version")
+		}
+	}
 	for p, v := range c.PropertyPaths() {
-		if v.Compute != nil && v.Compute.Write {
+		// restored documents keep their computed values
+		if v.Compute != nil && v.Compute.Write && !isRestoring(ctx) {
 			val, err := t.vm.RunString(v.Compute.Expr)
 			if err != nil {
 				return errors.Wrap(err, errors.Internal, "failed to compute value")
@@ -152,12 +170,34 @@ func (t *transaction) setDocument(ctx context.Context, c CollectionSchema, docID
 	primaryIndex := c.PrimaryIndex()
 	if err := t.tx.Set(ctx, seekPrefix(ctx, c.Collection(), primaryIndex, map[string]any{
 		c.PrimaryKey(): docID,
-	}).Seek(docID).Path(), command.Document.Bytes()); err != nil {
+	}).Seek(docID).Path(), encodeDocument(c.Compression(), command.Document)); err != nil {
 		return errors.Wrap(err, errors.Internal, "failed to set documents to primary index")
 	}
 	return nil
 }
 
+// checkVersion returns a conflict error if an expected version is given & it doesn't match the current version of the document
+func checkVersion(collection, docID string, before *Document, expected int64) error {
+	if expected == 0 {
+		return nil
+	}
+	if before == nil {
+		return errors.New(errors.Conflict, "tx: document %s/%s does not exist - expected version %v", collection, docID, expected)
+	}
+	if current := before.Version(); current != expected {
+		return errors.New(errors.Conflict, "tx: document %s/%s version mismatch - expected %v but found %v", collection, docID, expected, current)
+	}
+	return nil
+}
+
+// nextVersion returns the version of a document that is written over before (nil if the document doesn't exist)
+func nextVersion(before *Document) int64 {
+	if before == nil {
+		return 1
+	}
+	return before.Version() + 1
+}
+
 func (t *transaction) persistCommand(ctx context.Context, command *persistCommand) error {
 	c := t.db.GetSchema(ctx, command.Collection)
 	if c == nil {
@@ -177,7 +217,8 @@ func (t *transaction) persistCommand(ctx context.Context, command *persistComman
 	if err := util.ValidateStruct(c); err != nil {
 		return err
 	}
-	before, _ := t.Get(ctx, command.Collection, docID)
+	// expired documents are included so their index references are cleaned up when they are overwritten or deleted
+	before, _ := t.Get(setIncludeExpired(ctx), command.Collection, docID)
 	if isIndexing(ctx) {
 		for _, i := range c.Indexing() {
 			if i.Primary {
@@ -189,11 +230,27 @@ func (t *transaction) persistCommand(ctx context.Context, command *persistComman
 		}
 		return nil
 	}
+	// conditional writes are checked before triggers are executed so that a stale write has no side effects
+	if err := checkVersion(command.Collection, docID, before, command.ExpectedVersion); err != nil {
+		return err
+	}
 	//if t.db.collectionIsLocked(ctx, command.Collection) {
 	//	return errors.New(errors.Forbidden, "collection %s is locked", command.Collection)
 	//}
-	if err := t.evaluate(ctx, c, command); err != nil {
-		return err
+	if !isRestoring(ctx) {
+		if err := t.evaluate(ctx, c, command); err != nil {
+			return err
+		}
+	}
+	if ttl := c.TTL(); ttl != nil && !isRestoring(ctx) {
+		if command.Action == UpdateAction && ttl.IsExpired(before, time.Now()) {
+			return errors.New(errors.NotFound, "tx: document %s/%s has expired", command.Collection, docID)
+		}
+		if ttl.duration > 0 && command.Action != DeleteAction {
+			if err := command.Document.Set(ttl.Field, time.Now().Add(ttl.duration)); err != nil {
+				return errors.Wrap(err, errors.Internal, "failed to set document expiration")
+			}
+		}
 	}
 
 	switch command.Action {
@@ -232,7 +289,7 @@ func (t *transaction) persistCommand(ctx context.Context, command *persistComman
 			return errors.Wrap(err, 0, "failed to update secondary index")
 		}
 	}
-	if command.Collection != cdcCollectionName {
+	if command.Collection != cdcCollectionName && !isRestoring(ctx) {
 		cdc := CDC{
 			ID:         ksuid.New().String(),
 			Collection: command.Collection,
@@ -307,7 +364,7 @@ func (t *transaction) updateSecondaryIndex(ctx context.Context, schema Collectio
 	}
 	switch command.Action {
 	case DeleteAction:
-		if err := t.tx.Delete(ctx, seekPrefix(ctx, command.Collection, idx, before.Value()).Seek(docID).Path()); err != nil {
+		if err := t.tx.Delete(ctx, typedSeekPrefix(ctx, schema, idx, documentIndexFields(schema, idx, before)).Seek(docID).Path()); err != nil {
 			return errors.Wrap(
 				err,
 				errors.Internal,
@@ -319,7 +376,7 @@ func (t *transaction) updateSecondaryIndex(ctx context.Context, schema Collectio
 		delete(t.docs, fmt.Sprintf("%s/%s", command.Collection, docID))
 	case SetAction, UpdateAction, CreateAction:
 		if before != nil {
-			if err := t.tx.Delete(ctx, seekPrefix(ctx, command.Collection, idx, before.Value()).Seek(docID).Path()); err != nil {
+			if err := t.tx.Delete(ctx, typedSeekPrefix(ctx, schema, idx, documentIndexFields(schema, idx, before)).Seek(docID).Path()); err != nil {
 				return errors.Wrap(
 					err,
 					errors.Internal,
@@ -329,7 +386,8 @@ func (t *transaction) updateSecondaryIndex(ctx context.Context, schema Collectio
 				)
 			}
 		}
-		if idx.ForeignKey != nil && command.Document.Get(idx.Fields[0]) != nil {
+		// restored documents may be written before the documents they reference
+		if idx.ForeignKey != nil && command.Document.Get(idx.Fields[0]) != nil && !isRestoring(ctx) {
 			fcollection, ctx := t.db.getSchema(ctx, idx.ForeignKey.Collection)
 			if fcollection == nil {
 				return errors.New(errors.Validation, "foreign_key collection does not exist: %s", idx.ForeignKey.Collection)
@@ -348,16 +406,18 @@ func (t *transaction) updateSecondaryIndex(ctx context.Context, schema Collectio
 		}
 		if idx.Unique && !idx.Primary && command.Document != nil {
 			it, err := t.tx.NewIterator(kv.IterOpts{
-				Prefix: seekPrefix(ctx, command.Collection, idx, command.Document.Value()).Path(),
+				Prefix: typedSeekPrefix(ctx, schema, idx, documentIndexFields(schema, idx, command.Document)).Path(),
 			})
 			if err != nil {
 				return err
 			}
 			defer it.Close()
 			for it.Valid() {
-				split := bytes.Split(it.Key(), []byte("\x00"))
-				id := split[len(split)-1]
-				if string(id) != docID {
+				id, err := indexKeyDocID(it.Key())
+				if err != nil {
+					return err
+				}
+				if id != docID {
 					return errors.New(errors.Validation, "duplicate value( %s ) found for unique index: %s", docID, idx.Name)
 				}
 				if err := it.Next(); err != nil {
@@ -366,7 +426,7 @@ func (t *transaction) updateSecondaryIndex(ctx context.Context, schema Collectio
 			}
 		}
 		// only persist ids in secondary index - lookup full document in primary index
-		if err := t.tx.Set(ctx, seekPrefix(ctx, command.Collection, idx, command.Document.Value()).Seek(docID).Path(), []byte(docID)); err != nil {
+		if err := t.tx.Set(ctx, typedSeekPrefix(ctx, schema, idx, documentIndexFields(schema, idx, command.Document)).Seek(docID).Path(), []byte(docID)); err != nil {
 			return errors.Wrap(
 				err,
 				errors.Internal,
@@ -380,7 +440,27 @@ func (t *transaction) updateSecondaryIndex(ctx context.Context, schema Collectio
 	return nil
 }
 
-func (t *transaction) queryScan(ctx context.Context, collection string, where []Where, join []Join, fn ForEachFunc) (Explain, error) {
+// resolveSelfRefs replaces the self referencing values ($.{field}) of the where clauses (and their nested groups) with the
+// values of the document's fields
+func resolveSelfRefs(wheres []Where, document *Document) []Where {
+	var resolved []Where
+	for _, w := range wheres {
+		switch {
+		case len(w.Or) > 0:
+			w.Or = resolveSelfRefs(w.Or, document)
+		case w.Not != nil:
+			w.Not = &resolveSelfRefs([]Where{*w.Not}, document)[0]
+		case strings.HasPrefix(cast.ToString(w.Value), selfRefPrefix):
+			w.Value = document.Get(strings.TrimPrefix(cast.ToString(w.Value), selfRefPrefix))
+		}
+		resolved = append(resolved, w)
+	}
+	return resolved
+}
+
+// queryScan scans the documents that match the where clauses & passes them to fn along with the index key they were found at.
+// If after is set, the scan resumes after the index key
+func (t *transaction) queryScan(ctx context.Context, collection string, where []Where, join []Join, after []byte, fn func(d *Document, key []byte) (bool, error)) (Explain, error) {
 	if fn == nil {
 		return Explain{}, errors.New(errors.Validation, "empty scan handler")
 	}
@@ -388,137 +468,305 @@ func (t *transaction) queryScan(ctx context.Context, collection string, where []
 	if c == nil {
 		return Explain{}, errors.New(errors.Validation, "tx: unsupported collection: %s", collection)
 	}
-	var computed = map[string]*ComputedField{}
-	for p, v := range c.PropertyPaths() {
-		if v.Compute != nil && v.Compute.Read {
-			computed[p] = v.Compute
-		}
-	}
-	var err error
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	//if t.db.collectionIsLocked(ctx, collection) {
 	//	return Explain{}, errors.New(errors.Forbidden, "collection %s is locked", collection)
 	//}
-	explain, err := t.db.optimizer.Optimize(t.db.GetSchema(ctx, collection), where)
+	explain, err := t.db.optimizer.Optimize(c, where)
 	if err != nil {
 		return Explain{}, err
 	}
+	scanner := t.newQueryScanner(ctx, c, explain, where, join, after)
+	defer scanner.close()
+	for {
+		scanned, ok, err := scanner.next()
+		if err != nil {
+			return Explain{}, err
+		}
+		if !ok {
+			return explain, nil
+		}
+		shouldContinue, err := fn(scanned.doc, scanned.key)
+		if err != nil {
+			return Explain{}, err
+		}
+		if !shouldContinue {
+			return explain, nil
+		}
+	}
+}
+
+// scannedDocument is a document that matched a scan & the index key it was found at
+type scannedDocument struct {
+	doc *Document
+	key []byte
+}
+
+// queryScanner pulls the documents that match the where clauses from the index(es) of an explain one index entry (or batch of
+// secondary index entries) at a time, so that results may be streamed without holding them in memory
+type queryScanner struct {
+	t        *transaction
+	ctx      context.Context
+	c        CollectionSchema
+	where    []Where
+	join     []Join
+	after    []byte
+	computed map[string]*ComputedField
+	ttl      *TTL
+	now      time.Time
+	// scans are the index scans that haven't been started yet
+	scans []Explain
+	// scan is the index scan that is in progress
+	scan Explain
+	it   kv.Iterator
+	// seen holds the primary keys of the documents that have been scanned when the results of several index scans are
+	// unioned so that each document is only processed once
+	seen map[string]struct{}
+	// pending holds the documents that have been processed but not returned yet
+	pending []scannedDocument
+}
+
+// newQueryScanner returns a scanner over the index(es) of the explain. If after is set, the scan resumes after the index key
+func (t *transaction) newQueryScanner(ctx context.Context, c CollectionSchema, explain Explain, where []Where, join []Join, after []byte) *queryScanner {
+	s := &queryScanner{
+		t:        t,
+		ctx:      ctx,
+		c:        c,
+		where:    where,
+		join:     join,
+		after:    after,
+		computed: map[string]*ComputedField{},
+		ttl:      c.TTL(),
+		now:      time.Now(),
+		scans:    explain.Union,
+	}
+	for p, v := range c.PropertyPaths() {
+		if v.Compute != nil && v.Compute.Read {
+			s.computed[p] = v.Compute
+		}
+	}
+	if includeExpired(ctx) {
+		s.ttl = nil
+	}
+	if len(s.scans) == 0 {
+		s.scans = []Explain{explain}
+	} else {
+		s.seen = map[string]struct{}{}
+	}
+	return s
+}
+
+// next returns the next document that matches the scan. ok is false once the scan is complete
+func (s *queryScanner) next() (scannedDocument, bool, error) {
+	for {
+		if len(s.pending) > 0 {
+			scanned := s.pending[0]
+			s.pending = s.pending[1:]
+			return scanned, true, nil
+		}
+		if s.it == nil {
+			if len(s.scans) == 0 {
+				return scannedDocument{}, false, nil
+			}
+			s.scan, s.scans = s.scans[0], s.scans[1:]
+			if err := s.open(); err != nil {
+				return scannedDocument{}, false, err
+			}
+		}
+		if !s.it.Valid() {
+			s.it.Close()
+			s.it = nil
+			continue
+		}
+		if err := s.read(); err != nil {
+			return scannedDocument{}, false, err
+		}
+	}
+}
 
-	pfx := seekPrefix(ctx, collection, explain.Index, explain.MatchedValues)
+// close closes the index iterator of the scan in progress (if any)
+func (s *queryScanner) close() {
+	if s.it != nil {
+		s.it.Close()
+		s.it = nil
+	}
+	s.scans = nil
+	s.pending = nil
+}
+
+// open opens an iterator over the index of the current scan
+func (s *queryScanner) open() error {
+	pfx := typedSeekPrefix(s.ctx, s.c, s.scan.Index, s.scan.MatchedValues)
 	opts := kv.IterOpts{
 		Prefix:  pfx.Path(),
-		Reverse: explain.Reverse,
+		Reverse: s.scan.Reverse,
 	}
-	if explain.SeekFields != nil {
-		for _, field := range explain.SeekFields {
-			pfx = pfx.Append(field, explain.SeekValues[field])
+	if s.scan.SeekFields != nil {
+		upper := pfx
+		for _, field := range s.scan.SeekFields {
+			pfx = pfx.Append(field, indexValue(s.c, field, s.scan.SeekValues[field]))
+			upper = upper.Append(field, indexValue(s.c, field, s.scan.UpperBoundValues[field]))
 		}
 		opts.Seek = pfx.Path()
-	} else {
+		if s.scan.Reverse {
+			// reverse scans seek to the last key <= the seek key - the keys of documents with the seek values are longer than the
+			// prefix, so the scan starts from the end of it
+			opts.Seek = kvutil.NextPrefix(opts.Seek)
+		}
+		if len(s.scan.UpperBoundValues) > 0 {
+			// the upper bound must include the keys of every document with the upper bound values
+			opts.UpperBound = kvutil.NextPrefix(upper.Path())
+		}
+	} else if !s.scan.Reverse {
+		// reverse scans without a seek start from the end of the prefix
 		opts.Seek = opts.Prefix
 	}
-	it, err := t.tx.NewIterator(opts)
+	if s.after != nil {
+		opts.Seek = s.after
+	}
+	it, err := s.t.tx.NewIterator(opts)
 	if err != nil {
-		return Explain{}, err
+		return err
 	}
-	defer it.Close()
-	for it.Valid() {
-		var document *Document
-		if explain.Index.Primary {
-			bits, err := it.Value()
-			if err != nil {
-				return explain, err
-			}
-			document, err = NewDocumentFromBytes(bits)
-			if err != nil {
-				return explain, err
-			}
-		} else {
-			split := bytes.Split(it.Key(), []byte("\x00"))
-			id := split[len(split)-1]
-			document, err = t.Get(ctx, collection, string(id))
-			if err != nil {
-				return explain, err
-			}
+	s.it = it
+	// skip the keys up to (and including) the key the scan resumes after
+	for s.after != nil && it.Valid() {
+		cmp := bytes.Compare(it.Key(), s.after)
+		if !s.scan.Reverse && cmp > 0 || s.scan.Reverse && cmp < 0 {
+			break
 		}
-		for p, c := range computed {
-			val, err := t.vm.RunString(c.Expr)
-			if err != nil {
-				return explain, errors.Wrap(err, errors.Internal, "failed to compute field %s", p)
-			}
-			if err := document.Set(p, val.Export()); err != nil {
-				return explain, err
-			}
+		if err := it.Next(); err != nil {
+			return err
 		}
-		var documents = []*Document{document}
-		if len(join) > 0 {
+	}
+	return nil
+}
 
-			for _, j := range join {
-				alias := j.As
-				if alias == "" {
-					alias = j.Collection
-				}
-				var newJoin = Join{
-					Collection: j.Collection,
-					On:         nil,
-					As:         alias,
-				}
-				for i, o := range j.On {
-					if strings.HasPrefix(cast.ToString(o.Value), selfRefPrefix) {
-						newJoin.On = append(newJoin.On, Where{
-							Field: j.On[i].Field,
-							Op:    j.On[i].Op,
-							Value: documents[0].Get(strings.TrimPrefix(cast.ToString(o.Value), selfRefPrefix)),
-						})
-					} else {
-						newJoin.On = append(newJoin.On, o)
-					}
-				}
-				results, err := t.Query(ctx, j.Collection, Query{
-					Select: []Select{{Field: "*"}},
-					Join:   nil,
-					Where:  newJoin.On,
-				})
-				if err != nil {
-					return Explain{}, err
-				}
-				for i, d := range results.Documents {
-					if len(documents) > i {
-						if err := documents[i].MergeJoin(d, j.As); err != nil {
-							return Explain{}, err
-						}
-					} else {
-						cloned := documents[0].Clone()
-						if err := cloned.MergeJoin(d, j.As); err != nil {
-							return Explain{}, err
-						}
-						documents = append(documents, cloned)
-					}
+// read reads the next primary index entry (or batch of secondary index entries) from the iterator & processes the documents
+func (s *queryScanner) read() error {
+	if s.scan.Index.Primary {
+		bits, err := s.it.Value()
+		if err != nil {
+			return err
+		}
+		document, err := decodeDocument(bits)
+		if err != nil {
+			return err
+		}
+		key := append([]byte{}, s.it.Key()...)
+		if err := s.it.Next(); err != nil {
+			return err
+		}
+		return s.process(document, key)
+	}
+	// secondary indexes only hold document ids - the documents are looked up in the primary index in batches
+	var (
+		ids       []string
+		indexKeys [][]byte
+	)
+	for s.it.Valid() && len(ids) < scanBatchSize {
+		id, err := indexKeyDocID(s.it.Key())
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		indexKeys = append(indexKeys, append([]byte{}, s.it.Key()...))
+		if err := s.it.Next(); err != nil {
+			return err
+		}
+	}
+	keys := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, primaryKey(s.ctx, s.c, id))
+	}
+	values, err := s.t.tx.MultiGet(s.ctx, keys)
+	if err != nil {
+		return err
+	}
+	for i, bits := range values {
+		if bits == nil {
+			return errors.New(errors.NotFound, "%s not found", ids[i])
+		}
+		document, err := decodeDocument(bits)
+		if err != nil {
+			return err
+		}
+		if err := s.process(document, indexKeys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-				}
-			}
+// process filters, computes & joins a document - the documents that pass the where clauses are added to the pending documents
+func (s *queryScanner) process(document *Document, key []byte) error {
+	if s.seen != nil {
+		id := document.GetString(s.c.PrimaryKey())
+		if _, ok := s.seen[id]; ok {
+			return nil
 		}
-		for _, d := range documents {
-			pass, err := d.Where(where)
+		s.seen[id] = struct{}{}
+	}
+	if s.ttl != nil && s.ttl.IsExpired(document, s.now) {
+		return nil
+	}
+	for p, c := range s.computed {
+		val, err := s.t.vm.RunString(c.Expr)
+		if err != nil {
+			return errors.Wrap(err, errors.Internal, "failed to compute field %s", p)
+		}
+		if err := document.Set(p, val.Export()); err != nil {
+			return err
+		}
+	}
+	var documents = []*Document{document}
+	if len(s.join) > 0 {
+
+		for _, j := range s.join {
+			alias := j.As
+			if alias == "" {
+				alias = j.Collection
+			}
+			var newJoin = Join{
+				Collection: j.Collection,
+				On:         resolveSelfRefs(j.On, documents[0]),
+				As:         alias,
+			}
+			results, err := s.t.Query(s.ctx, j.Collection, Query{
+				Select: []Select{{Field: "*"}},
+				Join:   nil,
+				Where:  newJoin.On,
+			})
 			if err != nil {
-				return Explain{}, err
+				return err
 			}
-			if pass {
-				shouldContinue, err := fn(d)
-				if err != nil {
-					return Explain{}, err
-				}
-				if !shouldContinue {
-					return Explain{}, nil
+			for i, d := range results.Documents {
+				if len(documents) > i {
+					if err := documents[i].MergeJoin(d, j.As); err != nil {
+						return err
+					}
+				} else {
+					cloned := documents[0].Clone()
+					if err := cloned.MergeJoin(d, j.As); err != nil {
+						return err
+					}
+					documents = append(documents, cloned)
 				}
+
 			}
 		}
-		if err := it.Next(); err != nil {
-			return Explain{}, err
+	}
+	for _, d := range documents {
+		pass, err := d.whereSchema(s.c, s.where)
+		if err != nil {
+			return err
+		}
+		if pass {
+			s.pending = append(s.pending, scannedDocument{doc: d, key: key})
 		}
 	}
-	return explain, nil
+	return nil
 }
 
 func (t *transaction) evaluate(ctx context.Context, c CollectionSchema, command *persistCommand) error {
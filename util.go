@@ -2,6 +2,7 @@ package myjson
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"sort"
@@ -57,24 +58,112 @@ func defaultAs(function AggregateFunction, field string) string {
 	return field
 }
 
-func compareField(field string, i, j *Document) bool {
-	iFieldVal := i.Get(field)
-	jFieldVal := j.Get(field)
-	switch val := i.Get(field).(type) {
-	case time.Time:
-		return val.After(cast.ToTime(jFieldVal))
-	case bool:
-		return val && !cast.ToBool(jFieldVal)
-	case float64:
-		return val > cast.ToFloat64(jFieldVal)
-	case string:
-		return val > cast.ToString(jFieldVal)
+// dateTimeFormat is the json schema format of date-time properties - their values are compared & indexed as times
+const dateTimeFormat = "date-time"
+
+// typedValue converts the value of a field to the type of its property in the collection schema. date-time strings are
+// converted to times so that they are compared & indexed chronologically
+func typedValue(c CollectionSchema, field string, value any) any {
+	if c == nil {
+		return value
+	}
+	if str, ok := value.(string); ok && c.PropertyPaths()[field].Format == dateTimeFormat {
+		if t, err := cast.ToTimeE(str); err == nil {
+			return t
+		}
+	}
+	// expiry fields hold date-time strings or unix timestamps (seconds)
+	if ttl := c.TTL(); ttl != nil && ttl.Field == field && value != nil {
+		if t, err := cast.ToTimeE(value); err == nil && !t.IsZero() {
+			return t
+		}
+	}
+	return value
+}
+
+// integerType is the json schema type of integer properties - their values are indexed as exact integers
+const integerType = "integer"
+
+// indexValue converts the value of a field to the type it is indexed as. Numbers are indexed as exact int64s if their property is
+// an integer & as float64s otherwise, so that every value of a field is encoded with the same type tag
+func indexValue(c CollectionSchema, field string, value any) any {
+	value = typedValue(c, field, value)
+	switch value.(type) {
+	case int, int64, int32, int16, int8, uint, uint64, uint32, uint16, uint8, float64, float32, json.Number:
+		if c != nil && c.PropertyPaths()[field].Type == integerType {
+			if i, err := cast.ToInt64E(value); err == nil {
+				return i
+			}
+		}
+		return cast.ToFloat64(value)
 	default:
-		return util.JSONString(iFieldVal) > util.JSONString(jFieldVal)
+		return value
+	}
+}
+
+// compareValues returns -1 if a < b, 0 if a == b & 1 if a > b. Times are compared chronologically, strings lexically, objects &
+// arrays by their json & everything else numerically
+func compareValues(a, b any) int {
+	_, aIsTime := a.(time.Time)
+	_, bIsTime := b.(time.Time)
+	aStr, aIsStr := a.(string)
+	bStr, bIsStr := b.(string)
+	switch {
+	case aIsTime || bIsTime:
+		aTime, bTime := cast.ToTime(a), cast.ToTime(b)
+		switch {
+		case aTime.Before(bTime):
+			return -1
+		case aTime.After(bTime):
+			return 1
+		}
+		return 0
+	case aIsStr && bIsStr, aIsStr && b == nil, a == nil && bIsStr:
+		return strings.Compare(aStr, bStr)
+	case isJSONContainer(a) || isJSONContainer(b):
+		return strings.Compare(util.JSONString(a), util.JSONString(b))
+	}
+	aFloat, bFloat := cast.ToFloat64(a), cast.ToFloat64(b)
+	switch {
+	case aFloat < bFloat:
+		return -1
+	case aFloat > bFloat:
+		return 1
+	}
+	return 0
+}
+
+// isJSONContainer returns true if the value is a json object or array
+func isJSONContainer(value any) bool {
+	switch value.(type) {
+	case map[string]any, []any:
+		return true
+	}
+	return false
+}
+
+// compareField returns true if the field value of i is greater than the field value of j
+func compareField(c CollectionSchema, field string, i, j *Document) bool {
+	return compareValues(typedValue(c, field, i.Get(field)), typedValue(c, field, j.Get(field))) > 0
+}
+
+// compareDocs compares two documents by the order by clauses. It returns a negative number if a comes before b, a positive number
+// if a comes after b, and 0 if their order by values are equal
+func compareDocs(c CollectionSchema, a, b *Document, orderBys []OrderBy) int {
+	for _, o := range orderBys {
+		cmp := compareValues(typedValue(c, o.Field, a.Get(o.Field)), typedValue(c, o.Field, b.Get(o.Field)))
+		if cmp == 0 {
+			continue
+		}
+		if o.Direction == OrderByDirectionDesc {
+			return -cmp
+		}
+		return cmp
 	}
+	return 0
 }
 
-func orderByDocs(d Documents, orderBys []OrderBy) Documents {
+func orderByDocs(c CollectionSchema, d Documents, orderBys []OrderBy) Documents {
 	if len(orderBys) == 0 {
 		return d
 	}
@@ -84,17 +173,17 @@ func orderByDocs(d Documents, orderBys []OrderBy) Documents {
 		sort.Slice(d, func(i, j int) bool {
 			index := 1
 			if d[i].Get(orderBy.Field) != d[j].Get(orderBy.Field) {
-				return compareField(orderBy.Field, d[i], d[j])
+				return compareField(c, orderBy.Field, d[i], d[j])
 			}
 			for index < len(orderBys) {
 				order := orderBys[index]
 				if order.Direction == OrderByDirectionDesc {
 					if d[i].Get(order.Field) != d[j].Get(order.Field) {
-						return compareField(order.Field, d[i], d[j])
+						return compareField(c, order.Field, d[i], d[j])
 					}
 				} else {
 					if d[i].Get(order.Field) != d[j].Get(order.Field) {
-						return !compareField(order.Field, d[i], d[j])
+						return !compareField(c, order.Field, d[i], d[j])
 					}
 				}
 				index++
@@ -105,18 +194,18 @@ func orderByDocs(d Documents, orderBys []OrderBy) Documents {
 		sort.Slice(d, func(i, j int) bool {
 			index := 1
 			if d[i].Get(orderBy.Field) != d[j].Get(orderBy.Field) {
-				return !compareField(orderBy.Field, d[i], d[j])
+				return !compareField(c, orderBy.Field, d[i], d[j])
 			}
 			for index < len(orderBys) {
 				order := orderBys[index]
 				if d[i].Get(order.Field) != d[j].Get(order.Field) {
 					if order.Direction == OrderByDirectionDesc {
 						if d[i].Get(order.Field) != d[j].Get(order.Field) {
-							return compareField(order.Field, d[i], d[j])
+							return compareField(c, order.Field, d[i], d[j])
 						}
 					} else {
 						if d[i].Get(order.Field) != d[j].Get(order.Field) {
-							return !compareField(order.Field, d[i], d[j])
+							return !compareField(c, order.Field, d[i], d[j])
 						}
 					}
 				}
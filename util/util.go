@@ -3,6 +3,7 @@ package util
 import (
 	"encoding/binary"
 	"encoding/json"
+	"math"
 	"time"
 
 	"github.com/autom8ter/myjson/errors"
@@ -45,26 +46,195 @@ func PrettyJSONString(input any) string {
 	return string(bits)
 }
 
+// index value type tags - values of different types never collide & sort as:
+// null < false < true < floats < strings < everything else (json) < integers < times
+const (
+	nullTag   byte = 0x01
+	falseTag  byte = 0x02
+	trueTag   byte = 0x03
+	numberTag byte = 0x04
+	stringTag byte = 0x05
+	jsonTag   byte = 0x06
+	intTag    byte = 0x07
+	timeTag   byte = 0x08
+)
+
+// escape bytes are used to remove null bytes from encoded values so that they never contain the index key separator
+const (
+	escapeByte  byte = 0x01
+	escapedNull byte = 0x01
+	escapedByte byte = 0x02
+)
+
+// EncodeIndexValue encodes the value as a type tagged, order preserving byte string. Floats are encoded as sign-flipped IEEE754
+// float64s (so negative numbers & fractions sort correctly), integers & times (unix nanoseconds) as exact sign-flipped int64s,
+// strings are escaped, and the encoded value never contains a null byte
 func EncodeIndexValue(value any) []byte {
-	if value == nil {
-		return []byte("")
-	}
 	switch value := value.(type) {
+	case nil:
+		return []byte{nullTag}
 	case bool:
-		return EncodeIndexValue(cast.ToString(value))
+		if value {
+			return []byte{trueTag}
+		}
+		return []byte{falseTag}
 	case string:
-		return []byte(value)
-	case int, int64, int32, float64, float32, uint64, uint32, uint16:
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, cast.ToUint64(value))
-		return buf
+		return escape(stringTag, []byte(value))
+	case int, int64, int32, int16, int8, uint, uint32, uint16, uint8:
+		return encodeInt(intTag, cast.ToInt64(value))
+	case uint64:
+		if value > math.MaxInt64 {
+			return encodeFloat(float64(value))
+		}
+		return encodeInt(intTag, int64(value))
+	case float64, float32, json.Number:
+		return encodeFloat(cast.ToFloat64(value))
 	case time.Time:
-		return EncodeIndexValue(value.UnixNano())
+		return encodeInt(timeTag, value.UnixNano())
 	case time.Duration:
-		return EncodeIndexValue(int(value))
+		return encodeInt(intTag, int64(value))
+	default:
+		return escape(jsonTag, []byte(JSONString(value)))
+	}
+}
+
+// DecodeIndexValue decodes a value that was encoded with EncodeIndexValue. Floats are decoded as float64s, integers as int64s,
+// times as UTC times & json values as their json types
+func DecodeIndexValue(bits []byte) (any, error) {
+	if len(bits) == 0 {
+		return nil, errors.New(errors.Internal, "empty index value")
+	}
+	switch bits[0] {
+	case nullTag:
+		return nil, nil
+	case falseTag:
+		return false, nil
+	case trueTag:
+		return true, nil
+	case numberTag:
+		unescaped, err := unescape(bits[1:])
+		if err != nil {
+			return nil, err
+		}
+		if len(unescaped) != 8 {
+			return nil, errors.New(errors.Internal, "invalid index value: bad number length")
+		}
+		u := binary.BigEndian.Uint64(unescaped)
+		if u&(1<<63) != 0 {
+			u ^= 1 << 63
+		} else {
+			u = ^u
+		}
+		return math.Float64frombits(u), nil
+	case intTag, timeTag:
+		unescaped, err := unescape(bits[1:])
+		if err != nil {
+			return nil, err
+		}
+		if len(unescaped) != 8 {
+			return nil, errors.New(errors.Internal, "invalid index value: bad integer length")
+		}
+		i := int64(binary.BigEndian.Uint64(unescaped) ^ (1 << 63))
+		if bits[0] == timeTag {
+			return time.Unix(0, i).UTC(), nil
+		}
+		return i, nil
+	case stringTag:
+		unescaped, err := unescape(bits[1:])
+		if err != nil {
+			return nil, err
+		}
+		return string(unescaped), nil
+	case jsonTag:
+		unescaped, err := unescape(bits[1:])
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		if err := json.Unmarshal(unescaped, &value); err != nil {
+			return nil, errors.Wrap(err, errors.Internal, "invalid index value")
+		}
+		return value, nil
 	default:
-		return EncodeIndexValue(JSONString(value))
+		return nil, errors.New(errors.Internal, "invalid index value: unknown type tag: %v", bits[0])
+	}
+}
+
+func encodeFloat(f float64) []byte {
+	if f == 0 {
+		// normalize negative zero
+		f = 0
+	}
+	u := math.Float64bits(f)
+	if u&(1<<63) == 0 {
+		u ^= 1 << 63
+	} else {
+		u = ^u
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, u)
+	return escape(numberTag, buf)
+}
+
+// encodeInt encodes the integer as a sign-flipped big endian int64 so that negative integers sort before positive ones
+func encodeInt(tag byte, i int64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(i)^(1<<63))
+	return escape(tag, buf)
+}
+
+// EscapeIndexComponent escapes null bytes in an index key component so that it may be safely joined with other components by a
+// null byte separator. Escaping preserves the ordering of components
+func EscapeIndexComponent(component []byte) []byte {
+	return appendEscaped(make([]byte, 0, len(component)), component)
+}
+
+// UnescapeIndexComponent reverses EscapeIndexComponent
+func UnescapeIndexComponent(component []byte) ([]byte, error) {
+	return unescape(component)
+}
+
+// escape prepends the tag to the escaped value
+func escape(tag byte, value []byte) []byte {
+	return appendEscaped(append(make([]byte, 0, len(value)+1), tag), value)
+}
+
+// appendEscaped appends the value to the buffer after replacing null & escape bytes with two byte sequences that preserve ordering
+func appendEscaped(buf []byte, value []byte) []byte {
+	for _, b := range value {
+		switch b {
+		case 0x00:
+			buf = append(buf, escapeByte, escapedNull)
+		case escapeByte:
+			buf = append(buf, escapeByte, escapedByte)
+		default:
+			buf = append(buf, b)
+		}
+	}
+	return buf
+}
+
+func unescape(value []byte) ([]byte, error) {
+	buf := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != escapeByte {
+			buf = append(buf, value[i])
+			continue
+		}
+		if i+1 >= len(value) {
+			return nil, errors.New(errors.Internal, "invalid index value: truncated escape sequence")
+		}
+		i++
+		switch value[i] {
+		case escapedNull:
+			buf = append(buf, 0x00)
+		case escapedByte:
+			buf = append(buf, escapeByte)
+		default:
+			return nil, errors.New(errors.Internal, "invalid index value: bad escape sequence")
+		}
 	}
+	return buf, nil
 }
 
 func YAMLToJSON(yamlContent []byte) ([]byte, error) {
@@ -3,7 +3,9 @@ package util_test
 import (
 	"bytes"
 	"encoding/json"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/autom8ter/myjson"
 	"github.com/autom8ter/myjson/testutil"
@@ -79,6 +81,84 @@ func TestUtil(t *testing.T) {
 		compare := bytes.Compare(val1, val2)
 		assert.Equal(t, 0, compare)
 	})
+	t.Run("encode value (ordering)", func(t *testing.T) {
+		ordered := []any{
+			nil,
+			false,
+			true,
+			math.Inf(-1),
+			-1000000.0,
+			-10.5,
+			-10.0,
+			-1.0,
+			-0.5,
+			0.0,
+			0.25,
+			1.0,
+			1.5,
+			2.0,
+			1000000.0,
+			math.Inf(1),
+			"",
+			"\x00",
+			"\x01",
+			"a",
+			"a\x00",
+			"a\x00b",
+			"ab",
+			"b",
+			map[string]any{"message": "hello"},
+			int64(math.MinInt64),
+			-1000000,
+			-1,
+			0,
+			1,
+			int64(1 << 53),
+			int64(1<<53 + 1),
+			int64(math.MaxInt64),
+			time.Unix(0, 1<<62),
+			time.Unix(0, 1<<62+1),
+		}
+		for i := 1; i < len(ordered); i++ {
+			assert.Equal(t, -1, bytes.Compare(util.EncodeIndexValue(ordered[i-1]), util.EncodeIndexValue(ordered[i])), "%#v < %#v", ordered[i-1], ordered[i])
+		}
+	})
+	t.Run("encode value (types)", func(t *testing.T) {
+		assert.Equal(t, util.EncodeIndexValue(1), util.EncodeIndexValue(int64(1)))
+		assert.Equal(t, util.EncodeIndexValue(float64(-3)), util.EncodeIndexValue(float32(-3)))
+		assert.NotEqual(t, util.EncodeIndexValue(1), util.EncodeIndexValue(1.0))
+		assert.NotEqual(t, util.EncodeIndexValue(int64(1<<53)), util.EncodeIndexValue(int64(1<<53+1)))
+		assert.NotEqual(t, util.EncodeIndexValue(time.Unix(0, 1<<62)), util.EncodeIndexValue(time.Unix(0, 1<<62+1)))
+		assert.NotEqual(t, util.EncodeIndexValue(time.Unix(0, 1)), util.EncodeIndexValue(int64(1)))
+		assert.Equal(t, util.EncodeIndexValue(0.0), util.EncodeIndexValue(math.Copysign(0, -1)))
+		assert.NotEqual(t, util.EncodeIndexValue(1), util.EncodeIndexValue("1"))
+		assert.NotEqual(t, util.EncodeIndexValue(true), util.EncodeIndexValue("true"))
+		assert.NotContains(t, string(util.EncodeIndexValue("a\x00b")), "\x00")
+		assert.NotContains(t, string(util.EncodeIndexValue(1.0)), "\x00")
+	})
+	t.Run("decode value", func(t *testing.T) {
+		for _, value := range []any{nil, false, true, -10.5, 0.0, 3.0, int64(-3), int64(1<<53 + 1), time.Unix(0, 1<<62+1).UTC(), "", "a\x00\x01b", map[string]any{"message": "hello"}} {
+			decoded, err := util.DecodeIndexValue(util.EncodeIndexValue(value))
+			assert.NoError(t, err)
+			assert.Equal(t, value, decoded)
+		}
+		_, err := util.DecodeIndexValue([]byte{})
+		assert.Error(t, err)
+		_, err = util.DecodeIndexValue([]byte{0xff})
+		assert.Error(t, err)
+	})
+	t.Run("escape index component", func(t *testing.T) {
+		for _, component := range []string{"", "user", "a\x00b", "\x01\x00\x02"} {
+			escaped := util.EscapeIndexComponent([]byte(component))
+			assert.NotContains(t, string(escaped), "\x00")
+			unescaped, err := util.UnescapeIndexComponent(escaped)
+			assert.NoError(t, err)
+			assert.Equal(t, component, string(unescaped))
+		}
+		assert.Equal(t, -1, bytes.Compare(util.EscapeIndexComponent([]byte("a\x00")), util.EscapeIndexComponent([]byte("a\x01"))))
+		_, err := util.UnescapeIndexComponent([]byte{0x01})
+		assert.Error(t, err)
+	})
 	t.Run("remove element", func(t *testing.T) {
 		var index = []int{1, 2, 3, 4, 5}
 		index = util.RemoveElement(1, index)
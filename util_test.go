@@ -87,24 +87,99 @@ func TestUtil(t *testing.T) {
 		})
 		assert.NoError(t, err)
 		t.Run("compare age", func(t *testing.T) {
-			assert.False(t, compareField("age", d, d1))
+			assert.False(t, compareField(nil, "age", d, d1))
 		})
 		t.Run("compare age (reverse)", func(t *testing.T) {
-			assert.True(t, compareField("age", d1, d))
+			assert.True(t, compareField(nil, "age", d1, d))
 		})
 		t.Run("compare name", func(t *testing.T) {
-			assert.False(t, compareField("name", d, d1))
+			assert.False(t, compareField(nil, "name", d, d1))
 		})
 		t.Run("compare name (reverse)", func(t *testing.T) {
-			assert.True(t, compareField("name", d1, d))
+			assert.True(t, compareField(nil, "name", d1, d))
 		})
 		t.Run("compare isMale", func(t *testing.T) {
-			assert.True(t, compareField("isMale", d, d1))
+			assert.True(t, compareField(nil, "isMale", d, d1))
 		})
 		t.Run("compare name (reverse)", func(t *testing.T) {
-			assert.False(t, compareField("isMale", d1, d))
+			assert.False(t, compareField(nil, "isMale", d1, d))
 		})
 	})
+	t.Run("compareValues", func(t *testing.T) {
+		now := time.Now()
+		assert.Equal(t, -1, compareValues(1, 2))
+		assert.Equal(t, 1, compareValues(2.5, "2"))
+		assert.Equal(t, 0, compareValues(2, 2.0))
+		assert.Equal(t, -1, compareValues("10", "9"))
+		assert.Equal(t, 1, compareValues("b", nil))
+		assert.Equal(t, 1, compareValues(now, now.Add(-time.Second).Format(time.RFC3339Nano)))
+		assert.Equal(t, 0, compareValues(now.UTC(), now.In(time.FixedZone("", 5*3600))))
+		assert.Equal(t, 1, compareValues(map[string]any{"a": 2}, map[string]any{"a": 1}))
+	})
+	t.Run("indexValue", func(t *testing.T) {
+		cdc, err := newCollectionSchema([]byte(cdcSchema))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), indexValue(cdc, "timestamp", 3.0))
+		assert.Equal(t, int64(3), indexValue(cdc, "timestamp", 3))
+		assert.Equal(t, 3.0, indexValue(cdc, "documentID", 3))
+		assert.Equal(t, 3.0, indexValue(nil, "timestamp", 3))
+		assert.Equal(t, "3", indexValue(cdc, "timestamp", "3"))
+
+		idx := cdc.Indexing()["timestamp_idx"]
+		d1, err := NewDocumentFromBytes([]byte(`{"_id": "1", "timestamp": 1672531200000000000}`))
+		assert.NoError(t, err)
+		d2, err := NewDocumentFromBytes([]byte(`{"_id": "2", "timestamp": 1672531200000000001}`))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1672531200000000001), documentIndexFields(cdc, idx, d2)["timestamp"])
+		// nanosecond timestamps are above 2^53, so they would collide as float64s
+		assert.NotEqual(t,
+			typedSeekPrefix(context.Background(), cdc, idx, documentIndexFields(cdc, idx, d1)).Path(),
+			typedSeekPrefix(context.Background(), cdc, idx, documentIndexFields(cdc, idx, d2)).Path(),
+		)
+		assert.Equal(t,
+			typedSeekPrefix(context.Background(), cdc, idx, documentIndexFields(cdc, idx, d2)).Path(),
+			typedSeekPrefix(context.Background(), cdc, idx, map[string]any{"timestamp": int64(1672531200000000001)}).Path(),
+		)
+	})
+	t.Run("typedValue (date-time)", func(t *testing.T) {
+		schema, err := newCollectionSchema([]byte(userSchema))
+		assert.NoError(t, err)
+		ts := "2023-01-01T10:00:00+05:00"
+		assert.Equal(t, ts, typedValue(nil, "timestamp", ts))
+		assert.Equal(t, ts, typedValue(schema, "name", ts))
+		assert.IsType(t, time.Time{}, typedValue(schema, "timestamp", ts))
+		assert.Equal(t, "not a time", typedValue(schema, "timestamp", "not a time"))
+
+		d, err := NewDocumentFrom(map[string]any{"timestamp": ts})
+		assert.NoError(t, err)
+		d1, err := NewDocumentFrom(map[string]any{"timestamp": "2023-01-01T06:00:00Z"})
+		assert.NoError(t, err)
+		// lexically "10:00" > "06:00" but 10:00+05:00 is before 06:00Z
+		assert.True(t, compareField(nil, "timestamp", d, d1))
+		assert.False(t, compareField(schema, "timestamp", d, d1))
+		assert.Equal(t, "2023-01-01T06:00:00Z", orderByDocs(schema, Documents{d1, d}, []OrderBy{
+			{Field: "timestamp", Direction: OrderByDirectionDesc},
+		})[0].GetString("timestamp"))
+
+		for _, test := range []struct {
+			where Where
+			pass  bool
+		}{
+			{Where{Field: "timestamp", Op: WhereOpLt, Value: "2023-01-01T06:00:00Z"}, true},
+			{Where{Field: "timestamp", Op: WhereOpGte, Value: "2023-01-01T06:00:00Z"}, false},
+			{Where{Field: "timestamp", Op: WhereOpEq, Value: "2023-01-01T05:00:00.000Z"}, true},
+			{Where{Field: "timestamp", Op: WhereOpNeq, Value: "2023-01-01T05:00:00Z"}, false},
+			{Where{Field: "timestamp", Op: WhereOpBetween, Value: []string{"2023-01-01T04:00:00Z", "2023-01-01T05:00:00Z"}}, true},
+			{Where{Field: "timestamp", Op: WhereOpGt, Value: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}, true},
+		} {
+			pass, err := d.whereSchema(schema, []Where{test.where})
+			assert.NoError(t, err)
+			assert.Equal(t, test.pass, pass, test.where)
+		}
+		pass, err := d.Where([]Where{{Field: "timestamp", Op: WhereOpLt, Value: "2023-01-01T06:00:00Z"}})
+		assert.NoError(t, err)
+		assert.False(t, pass, "strings are compared lexically without a schema")
+	})
 	t.Run("decode", func(t *testing.T) {
 		d, err := NewDocumentFrom(map[string]any{
 			"age":    50,
@@ -149,7 +224,7 @@ func TestUtil(t *testing.T) {
 			assert.Nil(t, doc.Set("account_id", gofakeit.IntRange(1, 5)))
 			docs = append(docs, doc)
 		}
-		docs = orderByDocs(docs, []OrderBy{
+		docs = orderByDocs(nil, docs, []OrderBy{
 			{
 				Field:     "account_id",
 				Direction: OrderByDirectionDesc,
@@ -175,7 +250,7 @@ func TestUtil(t *testing.T) {
 			assert.Nil(t, doc.Set("account_id", gofakeit.IntRange(1, 5)))
 			docs = append(docs, doc)
 		}
-		docs = orderByDocs(docs, []OrderBy{
+		docs = orderByDocs(nil, docs, []OrderBy{
 			{
 				Field:     "account_id",
 				Direction: OrderByDirectionAsc,
@@ -201,7 +276,7 @@ func TestUtil(t *testing.T) {
 			assert.Nil(t, doc.Set("account_id", gofakeit.IntRange(1, 5)))
 			docs = append(docs, doc)
 		}
-		docs = orderByDocs(docs, []OrderBy{
+		docs = orderByDocs(nil, docs, []OrderBy{
 			{
 				Field:     "account_id",
 				Direction: OrderByDirectionAsc,
@@ -227,7 +302,7 @@ func TestUtil(t *testing.T) {
 			assert.Nil(t, doc.Set("account_id", gofakeit.IntRange(1, 5)))
 			docs = append(docs, doc)
 		}
-		docs = orderByDocs(docs, []OrderBy{
+		docs = orderByDocs(nil, docs, []OrderBy{
 			{
 				Field:     "account_id",
 				Direction: OrderByDirectionAsc,